@@ -2,11 +2,16 @@
 package main
 
 import (
+	"encoding/json"
 	"nginx-reaper/internal/env"
 	"nginx-reaper/internal/log"
+	"nginx-reaper/internal/nginxconf"
+	"nginx-reaper/internal/procps"
+	"nginx-reaper/internal/procps/option"
 	"nginx-reaper/internal/reaper"
 	"nginx-reaper/internal/server"
 	"nginx-reaper/internal/ticker"
+	"strings"
 	"syscall"
 )
 
@@ -16,7 +21,40 @@ const (
 	envReaperInterval         = "REAPER_INTERVAL"
 	envMaxShutdownWorkers     = "MAX_SHUTDOWN_WORKERS"
 	envAvailableMemoryPercent = "AVAILABLE_MEMORY_PERCENT"
+	envAvailableMemoryBytes   = "AVAILABLE_MEMORY_BYTES"
+	envMemoryCalculation      = "MEMORY_CALCULATION"
+	envRecoveryMemoryPercent  = "RECOVERY_MEMORY_PERCENT"
+	envRecoveryMemoryBytes    = "RECOVERY_MEMORY_BYTES"
+	envVictimPolicy           = "VICTIM_POLICY"
+	envMaxShutdownAge         = "MAX_SHUTDOWN_AGE"
+	envTerminateSignals       = "TERMINATE_SIGNALS"
+	envReaperDryRun           = "REAPER_DRY_RUN"
+	envReaperScope            = "REAPER_SCOPE"
+	envMemoryEvents           = "MEMORY_EVENTS"
+	envMemoryEventsDebounce   = "MEMORY_EVENTS_DEBOUNCE"
+	envMemoryPressureMetric   = "MEMORY_PRESSURE_METRIC"
+	envMemoryPressurePercent  = "MEMORY_PRESSURE_PERCENT"
+	envProcessMatch           = "PROCESS_MATCH"
+	envReaperProfiles         = "REAPER_PROFILES"
+	envCustomProfiles         = "CUSTOM_PROFILES"
+	envMasterDiscovery        = "MASTER_DISCOVERY"
+	envMasterPidFiles         = "MASTER_PID_FILES"
+	envMasterExe              = "MASTER_EXE"
+	envReaperCgroup           = "REAPER_CGROUP"
+	envReapMode               = "REAP_MODE"
+	envGenerationGap          = "GENERATION_GAP"
+	envNginxConfFile          = "NGINX_CONF_FILE"
+	envNginxConfCommand       = "NGINX_CONF_COMMAND"
 	envServerAddr             = "SERVER_ADDR"
+	envServerToken            = "SERVER_TOKEN"
+	envServerTokenFile        = "SERVER_TOKEN_FILE"
+	envServerReadAuth         = "SERVER_READ_AUTH"
+	envServerTLSCert          = "SERVER_TLS_CERT"
+	envServerTLSKey           = "SERVER_TLS_KEY"
+	envServerClientCA         = "SERVER_CLIENT_CA"
+	envServerClientScopes     = "SERVER_CLIENT_SCOPES"
+	envHealthRunIntervals     = "HEALTH_RUN_INTERVALS"
+	envHealthRunTimeout       = "HEALTH_RUN_TIMEOUT"
 	envShutdownInterval       = "SHUTDOWN_INTERVAL"
 	envShutdownTimeout        = "SHUTDOWN_TIMEOUT"
 )
@@ -27,23 +65,192 @@ var (
 	reaperInterval         = env.GetDuration(envReaperInterval, "30s")
 	maxShutdownWorkers     = env.GetInt(envMaxShutdownWorkers, "255")
 	availableMemoryPercent = env.GetInt(envAvailableMemoryPercent, "0")
+	availableMemoryBytes   = env.GetBytes(envAvailableMemoryBytes, "0")
+	memoryCalculation      = env.Get(envMemoryCalculation, "usage", procps.ParseMemoryCalculation)
+	recoveryMemoryPercent  = env.GetInt(envRecoveryMemoryPercent, "0")
+	recoveryMemoryBytes    = env.GetBytes(envRecoveryMemoryBytes, "0")
+	victimPolicy           = env.Get(envVictimPolicy, "oldest-first", reaper.ParseVictimPolicy)
+	maxShutdownAge         = env.GetDuration(envMaxShutdownAge, "0s")
+	terminateSignals       = env.Get(envTerminateSignals, "SIGTERM:5s,SIGKILL:5s", reaper.ParseEscalation)
+	reaperDryRun           = env.GetBool(envReaperDryRun, "false")
+	reaperScope            = env.Get(envReaperScope, "master", reaper.ParseScope)
+	memoryEvents           = env.GetBool(envMemoryEvents, "false")
+	memoryEventsDebounce   = env.GetDuration(envMemoryEventsDebounce, "5s")
+	memoryPressureMetric   = env.Get(envMemoryPressureMetric, "some_avg10", reaper.ParsePressureMetric)
+	memoryPressurePercent  = env.GetInt(envMemoryPressurePercent, "0")
+	processMatch           = env.MustGet(envProcessMatch, "", option.ParseSpec)
+	customProfiles         = env.Get(envCustomProfiles, "[]", reaper.ParseCustomProfiles)
+	reaperProfiles         = env.Get(envReaperProfiles, "nginx", parseProfiles)
+	masterDiscovery        = env.Get(envMasterDiscovery, "cmdline", reaper.ParseDiscoveryMode)
+	masterPidFiles         = env.GetString(envMasterPidFiles, "/var/run/nginx.pid")
+	masterExe              = env.GetString(envMasterExe, "")
+	reaperCgroup           = env.MustGet(envReaperCgroup, "", reaper.ParseCgroupFilter)
+	reapMode               = env.Get(envReapMode, "worker", reaper.ParseReapMode)
+	generationGap          = env.GetDuration(envGenerationGap, "1s")
+	nginxConfFile          = env.GetString(envNginxConfFile, "")
+	nginxConfCommand       = env.GetString(envNginxConfCommand, "")
 	serverAddr             = env.GetString(envServerAddr, ":11254")
+	serverToken            = env.GetString(envServerToken, "")
+	serverTokenFile        = env.GetString(envServerTokenFile, "")
+	serverReadAuth         = env.GetBool(envServerReadAuth, "false")
+	serverTLSCert          = env.GetString(envServerTLSCert, "")
+	serverTLSKey           = env.GetString(envServerTLSKey, "")
+	serverClientCA         = env.GetString(envServerClientCA, "")
+	serverClientScopes     = env.MustGet(envServerClientScopes, "", server.ParseClientScopes)
+	healthRunIntervals     = env.GetInt(envHealthRunIntervals, "3")
+	healthRunTimeout       = env.GetDuration(envHealthRunTimeout, "10m")
 	shutdownInterval       = env.GetDuration(envShutdownInterval, "10s")
 	shutdownTimeout        = env.GetDuration(envShutdownTimeout, "5m")
 )
 
+// Configuration parameters of the Reaper by environment variable, reported with their sources by GET /config.
+var reaperParameters = map[string]string{
+	envReaperInterval:         "interval",
+	envMaxShutdownWorkers:     "max_shutdown_workers",
+	envAvailableMemoryPercent: "available_memory_percent",
+	envAvailableMemoryBytes:   "available_memory_bytes",
+	envRecoveryMemoryPercent:  "recovery_memory_percent",
+	envRecoveryMemoryBytes:    "recovery_memory_bytes",
+	envMemoryPressurePercent:  "memory_pressure_percent",
+	envMaxShutdownAge:         "max_shutdown_age",
+	envVictimPolicy:           "victim_policy",
+	envReapMode:               "reap_mode",
+	envGenerationGap:          "generation_gap",
+	envReaperDryRun:           "dry_run",
+}
+
+// parseProfiles parses the profile names, including the custom profiles.
+func parseProfiles(names string) ([]*reaper.Profile, error) {
+	return reaper.ParseProfiles(names, customProfiles...)
+}
+
+// envSources returns the sources of the Reaper configuration parameters set by environment variables.
+func envSources() map[string]reaper.ConfigSource {
+	sources := make(map[string]reaper.ConfigSource)
+	for envName, name := range reaperParameters {
+		if env.IsSet(envName) {
+			sources[name] = reaper.SourceEnv
+		}
+	}
+	return sources
+}
+
+// readNginxConfig reads the Nginx configuration from the file or the command, if any, and uses its worker settings
+// as defaults of the environment variables that are not set. Updates the sources of the changed parameters.
+func readNginxConfig(sources map[string]reaper.ConfigSource) {
+	var conf *nginxconf.Config
+	var err error
+	args := strings.Fields(nginxConfCommand)
+	switch {
+	case nginxConfFile != "":
+		conf, err = nginxconf.ReadFile(nginxConfFile)
+	case len(args) > 0:
+		conf, err = nginxconf.ReadCommand(args[0], args[1:]...)
+	default:
+		return
+	}
+	if err != nil {
+		log.Errorf("Failed to read Nginx configuration, using defaults: %v", err)
+		return
+	}
+	log.Infof("Nginx configuration: %v", conf)
+	server.SetConfigValue("nginx", conf)
+
+	// Keep one generation of shutting down workers, and terminate them when Nginx would. Directives that are not set
+	// keep the defaults of the Reaper rather than the defaults of Nginx, e.g. a single worker process.
+	// worker_connections is reported only, since the connections of a draining worker are not visible in /proc.
+	switch {
+	case env.IsSet(envMaxShutdownWorkers) || !conf.IsSet("worker_processes"):
+	case conf.WorkerProcessesAuto:
+		// The CPUs of the Reaper may differ from the CPUs of Nginx, e.g. in a sidecar container.
+		log.Warningf("Nginx worker_processes auto resolved to the %d CPUs of the Reaper, keeping %s %d, set it "+
+			"explicitly to the workers of Nginx", conf.WorkerProcesses, envMaxShutdownWorkers, maxShutdownWorkers)
+	default:
+		maxShutdownWorkers = conf.WorkerProcesses
+		sources[reaperParameters[envMaxShutdownWorkers]] = reaper.SourceNginx
+	}
+	if !env.IsSet(envMaxShutdownAge) && conf.IsSet("worker_shutdown_timeout") {
+		maxShutdownAge = conf.WorkerShutdownTimeout
+		sources[reaperParameters[envMaxShutdownAge]] = reaper.SourceNginx
+	}
+}
+
 func main() {
 	// Set the log level.
 	log.SetLevel(logLevel)
 
+	// Use the worker settings of the Nginx configuration as defaults.
+	sources := envSources()
+	readNginxConfig(sources)
+
+	discovery := &reaper.MasterDiscovery{
+		Mode:     masterDiscovery,
+		PidFiles: strings.Split(masterPidFiles, ","),
+		Exe:      masterExe,
+	}
+
 	// Start the Reaper as a goroutine at a regular interval.
-	nginxReaper := reaper.NewReaper(reaperInterval, maxShutdownWorkers, availableMemoryPercent)
+	nginxReaper := reaper.NewReaper(reaperInterval, maxShutdownWorkers, availableMemoryPercent,
+		reaper.WithAvailableMemoryBytes(availableMemoryBytes),
+		reaper.WithMemoryCalculation(memoryCalculation),
+		reaper.WithMemoryRecovery(recoveryMemoryPercent, recoveryMemoryBytes),
+		reaper.WithVictimPolicy(victimPolicy),
+		reaper.WithMaxShutdownAge(maxShutdownAge),
+		reaper.WithEscalation(terminateSignals),
+		reaper.WithDryRun(reaperDryRun),
+		reaper.WithScope(reaperScope),
+		reaper.WithMemoryEvents(memoryEvents, memoryEventsDebounce),
+		reaper.WithMemoryPressure(memoryPressureMetric, memoryPressurePercent),
+		reaper.WithProcessMatch(processMatch),
+		reaper.WithProfiles(reaperProfiles...),
+		reaper.WithMasterDiscovery(discovery),
+		reaper.WithCgroupFilter(reaperCgroup),
+		reaper.WithReapMode(reapMode),
+		reaper.WithGenerationGap(generationGap),
+		reaper.WithConfigSources(sources),
+	)
 	go ticker.Start(nginxReaper)
 
-	// Start the HTTP Server as a goroutine.
+	// Report and change the Reaper configuration at runtime with GET and PATCH /config.
+	server.SetConfigValue("reaper", nginxReaper)
+
+	// Report the masters and workers the Reaper sees with GET /workers.
+	server.SetWorkersTree(func() (server.Tree, error) { return nginxReaper.Tree() })
+
+	// Require credentials of the write scope for PUT and PATCH /config and POST /reap, and of the read scope for
+	// GET /config and /workers if enabled.
+	server.SetToken(serverToken)
+	server.SetTokenFile(serverTokenFile)
+	server.SetReadAuth(serverReadAuth)
+	server.SetClientScopes(serverClientScopes)
+
+	// Run the Reaper right away with POST /reap.
+	server.SetReapFunc(func(body json.RawMessage) (any, error) { return nginxReaper.Reap(body) })
+
+	// Report the health checks of the Reaper with GET /healthz and /readyz.
+	server.SetHealth(
+		func() server.Health { return nginxReaper.Liveness(healthRunIntervals, healthRunTimeout) },
+		func() server.Health { return nginxReaper.Readiness(healthRunIntervals, healthRunTimeout) },
+	)
+
+	// Start the HTTP Server as a goroutine, with TLS and optionally client certificates if configured.
 	httpServer := server.CreateServer(serverAddr, nginxReaper.Metrics()...)
-	go server.StartServer(httpServer)
+	switch {
+	case serverClientScopes != nil && serverClientCA == "":
+		log.Panicf("%s is required by %s", envServerClientCA, envServerClientScopes)
+	case serverTLSCert != "" && serverTLSKey != "":
+		config, err := server.NewTLSConfig(serverClientCA)
+		if err != nil {
+			log.Panicf("Failed to read client CA certificates: %v", err)
+		}
+		httpServer.TLSConfig = config
+		go server.StartServerTLS(httpServer, serverTLSCert, serverTLSKey)
+	case serverTLSCert != "" || serverTLSKey != "" || serverClientCA != "":
+		log.Panicf("%s and %s are required for TLS", envServerTLSCert, envServerTLSKey)
+	default:
+		go server.StartServer(httpServer)
+	}
 
 	// Wait for SIGTERM for a graceful shutdown.
-	reaper.WaitShutdown(shutdownInterval, shutdownTimeout, syscall.SIGTERM)
+	reaper.WaitShutdown(shutdownInterval, shutdownTimeout, syscall.SIGTERM, nginxReaper)
 }
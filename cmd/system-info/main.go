@@ -3,22 +3,21 @@ package main
 
 import (
 	"fmt"
-	"github.com/shirou/gopsutil/v3/process"
 	"nginx-reaper/internal/procps"
 	"os"
 )
 
 func main() {
-	processes, err := process.Processes()
+	snapshot, err := procps.NewSnapshot()
 	if err != nil {
 		panic(err)
 	}
 	fmt.Println("Processes information:")
-	for _, proc := range processes {
-		fmt.Println(procps.NewProcessInfo(proc))
+	for _, proc := range snapshot.Processes() {
+		fmt.Println(snapshot.ProcessInfo(proc))
 	}
 	fmt.Println()
 
 	fmt.Println("Memory information:")
-	fmt.Println(procps.NewMemoryInfo(os.Getpid()))
+	fmt.Println(procps.NewMemoryInfo(os.Getpid(), procps.MemoryWorkingSet))
 }
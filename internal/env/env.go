@@ -2,12 +2,67 @@
 package env
 
 import (
+	"fmt"
+	"math/big"
 	"nginx-reaper/internal/log"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// Pattern of a Kubernetes-style quantity, e.g. "512Mi" or "1.5G".
+var bytesPattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([a-zA-Z]*)$`)
+
+// Quantity suffix to multiplier mapping.
+var bytesSuffixes = map[string]uint64{
+	"":   1,
+	"k":  1e3,
+	"M":  1e6,
+	"G":  1e9,
+	"T":  1e12,
+	"P":  1e15,
+	"E":  1e18,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+	"Pi": 1 << 50,
+	"Ei": 1 << 60,
+}
+
+// Get retrieves a value from the specified environment variable using the provided parser function.
+func Get[T any](envName string, defaultValue string, parser func(string) (T, error)) T {
+	return parseValue(envName, defaultValue, parser)
+}
+
+// MustGet retrieves a value from the specified environment variable using the provided parser function.
+// Unlike Get, the program panics if the value is invalid, e.g. for settings whose default would target other
+// processes than configured.
+func MustGet[T any](envName string, defaultValue string, parser func(string) (T, error)) T {
+	if envValue, ok := os.LookupEnv(envName); ok {
+		value, err := parser(envValue)
+		if err != nil {
+			log.Panicf("Invalid environment variable %v, %v", envName, err)
+		}
+		return value
+	}
+	return parseValue(envName, defaultValue, parser)
+}
+
+// GetBool retrieves a bool from the specified environment variable.
+// Accepts 1, t, T, TRUE, true, True, 0, f, F, FALSE, false, False.
+func GetBool(envName string, defaultValue string) bool {
+	return parseValue(envName, defaultValue, strconv.ParseBool)
+}
+
+// GetBytes retrieves a number of bytes from the specified environment variable.
+// The value is a Kubernetes-style quantity, e.g. "512Mi" or "2G".
+func GetBytes(envName string, defaultValue string) uint64 {
+	return parseValue(envName, defaultValue, ParseBytes)
+}
+
 // GetDuration retrieves a time.Duration from the specified environment variable.
 func GetDuration(envName string, defaultValue string) time.Duration {
 	return parseValue(envName, defaultValue, time.ParseDuration)
@@ -28,6 +83,38 @@ func GetString(envName string, defaultValue string) string {
 	return parseValue(envName, defaultValue, func(s string) (string, error) { return s, nil })
 }
 
+// IsSet returns a bool indicating whether the specified environment variable is set, e.g. to keep an explicit value
+// instead of a default derived from elsewhere.
+func IsSet(envName string) bool {
+	_, ok := os.LookupEnv(envName)
+	return ok
+}
+
+// ParseBytes converts a Kubernetes-style quantity to a number of bytes. Returns error if invalid.
+// Fractional bytes are rounded up, e.g. "1.5Gi" becomes 1610612736 and "0.5k" becomes 500.
+func ParseBytes(value string) (uint64, error) {
+	match := bytesPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, fmt.Errorf("invalid quantity: %q", value)
+	}
+	multiplier, ok := bytesSuffixes[match[2]]
+	if !ok {
+		return 0, fmt.Errorf("invalid quantity suffix: %q", value)
+	}
+
+	number, _ := new(big.Rat).SetString(match[1])
+	number.Mul(number, new(big.Rat).SetUint64(multiplier))
+
+	result := new(big.Int).Quo(number.Num(), number.Denom())
+	if !number.IsInt() {
+		result.Add(result, big.NewInt(1))
+	}
+	if !result.IsUint64() {
+		return 0, fmt.Errorf("quantity out of range: %q", value)
+	}
+	return result.Uint64(), nil
+}
+
 // parseValue parses the environment variable value using the provided parser function.
 // If the environment variable is not set or the value is invalid, the provided default value is returned.
 // If the default value is invalid, the program panics.
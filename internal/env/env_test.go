@@ -1,6 +1,7 @@
 package env
 
 import (
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"nginx-reaper/internal/log"
 	"testing"
@@ -18,6 +19,349 @@ type args struct {
 	defaultValue string
 }
 
+func TestGet(t *testing.T) {
+	parser := func(s string) (int, error) {
+		if s == "" {
+			return 0, errors.New("empty value")
+		}
+		return len(s), nil
+	}
+	tests := []struct {
+		name      string
+		args      args
+		want      int
+		wantPanic bool
+	}{
+		{
+			name: "NilValue",
+			args: args{
+				envName:      envName,
+				envValue:     nilValue,
+				defaultValue: "default",
+			},
+			want: 7,
+		},
+		{
+			name: "ValidValue",
+			args: args{
+				envName:      envName,
+				envValue:     "value",
+				defaultValue: "default",
+			},
+			want: 5,
+		},
+		{
+			name: "InvalidValue",
+			args: args{
+				envName:      envName,
+				envValue:     "",
+				defaultValue: "default",
+			},
+			want: 7,
+		},
+		{
+			name: "InvalidDefaultValue",
+			args: args{
+				envName:      envName,
+				envValue:     "value",
+				defaultValue: "",
+			},
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.args.envValue != nilValue {
+				t.Setenv(tt.args.envName, tt.args.envValue)
+			}
+			if tt.wantPanic {
+				assert.Panics(t, func() { Get(tt.args.envName, tt.args.defaultValue, parser) })
+			} else {
+				got := Get(tt.args.envName, tt.args.defaultValue, parser)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMustGet(t *testing.T) {
+	parser := func(s string) (int, error) {
+		if s == "" {
+			return 0, errors.New("empty value")
+		}
+		return len(s), nil
+	}
+	tests := []struct {
+		name      string
+		args      args
+		want      int
+		wantPanic bool
+	}{
+		{
+			name: "NilValue",
+			args: args{
+				envName:      envName,
+				envValue:     nilValue,
+				defaultValue: "default",
+			},
+			want: 7,
+		},
+		{
+			name: "ValidValue",
+			args: args{
+				envName:      envName,
+				envValue:     "value",
+				defaultValue: "default",
+			},
+			want: 5,
+		},
+		{
+			name: "InvalidValue",
+			args: args{
+				envName:      envName,
+				envValue:     "",
+				defaultValue: "default",
+			},
+			wantPanic: true,
+		},
+		{
+			name: "InvalidDefaultValue",
+			args: args{
+				envName:      envName,
+				envValue:     nilValue,
+				defaultValue: "",
+			},
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.args.envValue != nilValue {
+				t.Setenv(tt.args.envName, tt.args.envValue)
+			}
+			if tt.wantPanic {
+				assert.Panics(t, func() { MustGet(tt.args.envName, tt.args.defaultValue, parser) })
+			} else {
+				got := MustGet(tt.args.envName, tt.args.defaultValue, parser)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGetBool(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      args
+		want      bool
+		wantPanic bool
+	}{
+		{
+			name: "NilValue",
+			args: args{
+				envName:      envName,
+				envValue:     nilValue,
+				defaultValue: "false",
+			},
+			want: false,
+		},
+		{
+			name: "ValidValue",
+			args: args{
+				envName:      envName,
+				envValue:     "TRUE",
+				defaultValue: "false",
+			},
+			want: true,
+		},
+		{
+			name: "InvalidValue",
+			args: args{
+				envName:      envName,
+				envValue:     "yes",
+				defaultValue: "true",
+			},
+			want: true,
+		},
+		{
+			name: "EmptyValue",
+			args: args{
+				envName:      envName,
+				envValue:     "",
+				defaultValue: "false",
+			},
+			want: false,
+		},
+		{
+			name: "InvalidDefaultValue",
+			args: args{
+				envName:      envName,
+				envValue:     "true",
+				defaultValue: "invalid",
+			},
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.args.envValue != nilValue {
+				t.Setenv(tt.args.envName, tt.args.envValue)
+			}
+			if tt.wantPanic {
+				assert.Panics(t, func() { GetBool(tt.args.envName, tt.args.defaultValue) })
+			} else {
+				got := GetBool(tt.args.envName, tt.args.defaultValue)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGetBytes(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      args
+		want      uint64
+		wantPanic bool
+	}{
+		{
+			name: "NilValue",
+			args: args{
+				envName:      envName,
+				envValue:     nilValue,
+				defaultValue: "1Ki",
+			},
+			want: 1024,
+		},
+		{
+			name: "ValidValue",
+			args: args{
+				envName:      envName,
+				envValue:     "512Mi",
+				defaultValue: "1Ki",
+			},
+			want: 512 * 1024 * 1024,
+		},
+		{
+			name: "InvalidValue",
+			args: args{
+				envName:      envName,
+				envValue:     "invalid",
+				defaultValue: "1Ki",
+			},
+			want: 1024,
+		},
+		{
+			name: "InvalidDefaultValue",
+			args: args{
+				envName:      envName,
+				envValue:     "512Mi",
+				defaultValue: "invalid",
+			},
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.args.envValue != nilValue {
+				t.Setenv(tt.args.envName, tt.args.envValue)
+			}
+			if tt.wantPanic {
+				assert.Panics(t, func() { GetBytes(tt.args.envName, tt.args.defaultValue) })
+			} else {
+				got := GetBytes(tt.args.envName, tt.args.defaultValue)
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    uint64
+		wantErr bool
+	}{
+		{
+			name:  "Bytes",
+			value: "1000",
+			want:  1000,
+		},
+		{
+			name:  "Zero",
+			value: "0",
+		},
+		{
+			name:  "Decimal",
+			value: "2G",
+			want:  2_000_000_000,
+		},
+		{
+			name:  "Binary",
+			value: "512Mi",
+			want:  512 << 20,
+		},
+		{
+			name:  "Fraction",
+			value: "1.5Gi",
+			want:  3 << 29,
+		},
+		{
+			name:  "RoundUp",
+			value: "0.0001k",
+			want:  1,
+		},
+		{
+			name:  "Spaces",
+			value: " 1k ",
+			want:  1000,
+		},
+		{
+			name:  "MaxBinary",
+			value: "15Ei",
+			want:  15 << 60,
+		},
+		{
+			name:    "Empty",
+			value:   "",
+			wantErr: true,
+		},
+		{
+			name:    "Negative",
+			value:   "-1Gi",
+			wantErr: true,
+		},
+		{
+			name:    "InvalidSuffix",
+			value:   "1GB",
+			wantErr: true,
+		},
+		{
+			name:    "LowercaseSuffix",
+			value:   "1mi",
+			wantErr: true,
+		},
+		{
+			name:    "OutOfRange",
+			value:   "16Ei",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBytes(tt.value)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestGetDuration(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -302,3 +646,9 @@ func TestGetString(t *testing.T) {
 		})
 	}
 }
+
+func TestIsSet(t *testing.T) {
+	assert.False(t, IsSet(envName))
+	t.Setenv(envName, "")
+	assert.True(t, IsSet(envName))
+}
@@ -0,0 +1,259 @@
+// Package memevents provides a Watcher to receive memory event notifications of a cgroup.
+package memevents
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/containerd/cgroups/v3"
+	"golang.org/x/sys/unix"
+	"nginx-reaper/internal/log"
+	"nginx-reaper/internal/procps"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	EventHigh      = "high"
+	EventMax       = "max"
+	EventOOM       = "oom"
+	EventOOMKill   = "oom_kill"
+	EventThreshold = "threshold"
+
+	v2EventsFile       = "memory.events"
+	v1EventControlFile = "cgroup.event_control"
+	v1OOMControlFile   = "memory.oom_control"
+	v1UsageFile        = "memory.usage_in_bytes"
+)
+
+var (
+	cgroupsMode           = cgroups.Mode
+	procpsCgroupMemoryDir = procps.CgroupMemoryDir
+)
+
+// Event is a memory event notification of a cgroup.
+type Event struct {
+	Name string // Name of the event, e.g. "high" or "threshold".
+	Path string // Path of the cgroup directory.
+}
+
+// String returns a string representation of the Event.
+func (e Event) String() string {
+	return fmt.Sprintf("%s in %s", e.Name, e.Path)
+}
+
+// Watcher delivers memory events of a cgroup until closed or failed.
+type Watcher struct {
+	events chan Event
+	files  []*os.File
+	wg     sync.WaitGroup
+	done   chan struct{}
+	once   sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+// Watch starts watching memory events of the cgroup of the specified pid. Returns error, if any.
+// For cgroup v2, memory.high, memory.max, OOM and OOM kill events are delivered.
+// For cgroup v1, OOM events are delivered, and threshold events when memory usage crosses the threshold in bytes,
+// unless zero.
+func Watch(pid int, threshold uint64) (*Watcher, error) {
+	dir, err := procpsCgroupMemoryDir(pid)
+	if err != nil {
+		return nil, err
+	}
+	if cgroupsMode() == cgroups.Unified {
+		return watchV2(dir)
+	}
+	return watchV1(dir, threshold)
+}
+
+// Events returns the channel of memory events, closed when the Watcher stops.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Err returns the error that stopped the Watcher, if any.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close stops the Watcher and releases its resources.
+func (w *Watcher) Close() error {
+	var errs []error
+	w.once.Do(func() {
+		close(w.done)
+		for _, file := range w.files {
+			errs = append(errs, file.Close())
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// send delivers the event unless the Watcher is closed.
+func (w *Watcher) send(event Event) {
+	select {
+	case w.events <- event:
+	case <-w.done:
+	}
+}
+
+// start reads each file with the read function in a separate goroutine until any of them fails.
+// The events channel is closed when all goroutines stop.
+func (w *Watcher) start(read func(file *os.File) error) {
+	for _, file := range w.files {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			err := read(file)
+			w.mu.Lock()
+			if w.err == nil && !errors.Is(err, os.ErrClosed) {
+				w.err = err
+			}
+			w.mu.Unlock()
+			_ = w.Close()
+		}()
+	}
+	go func() {
+		w.wg.Wait()
+		close(w.events)
+	}()
+}
+
+// watchV2 watches the memory.events file of the cgroup v2 directory with inotify.
+// The kernel notifies file modified events whenever any counter of the file changes.
+func watchV2(dir string) (*Watcher, error) {
+	eventsFile := path.Join(dir, v2EventsFile)
+	counters, err := readEvents(eventsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = unix.InotifyAddWatch(fd, eventsFile, unix.IN_MODIFY); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+
+	w := &Watcher{events: make(chan Event), done: make(chan struct{})}
+	w.files = append(w.files, os.NewFile(uintptr(fd), eventsFile))
+	w.start(func(file *os.File) error {
+		buf := make([]byte, 4096)
+		for {
+			if _, err := file.Read(buf); err != nil {
+				return err
+			}
+			current, err := readEvents(eventsFile)
+			if err != nil {
+				return err
+			}
+			// Counters only increase, a lower value is a partially written file.
+			for _, name := range []string{EventHigh, EventMax, EventOOM, EventOOMKill} {
+				if current[name] > counters[name] {
+					counters[name] = current[name]
+					w.send(Event{Name: name, Path: dir})
+				}
+			}
+		}
+	})
+	log.Infof("Watching memory events of %s", eventsFile)
+	return w, nil
+}
+
+// watchV1 registers eventfd notifications of the cgroup v1 directory for OOM and the usage threshold.
+func watchV1(dir string, threshold uint64) (*Watcher, error) {
+	w := &Watcher{events: make(chan Event), done: make(chan struct{})}
+	names := make(map[*os.File]string)
+
+	register := func(name, file string, args ...string) error {
+		efd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+		if err != nil {
+			return err
+		}
+		eventFile := os.NewFile(uintptr(efd), name)
+		w.files = append(w.files, eventFile)
+		names[eventFile] = name
+
+		f, err := os.Open(path.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		control, err := os.OpenFile(path.Join(dir, v1EventControlFile), os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		defer control.Close()
+
+		_, err = control.WriteString(
+			strings.Join(append([]string{strconv.Itoa(efd), strconv.Itoa(int(f.Fd()))}, args...), " "),
+		)
+		return err
+	}
+
+	err := register(EventOOM, v1OOMControlFile)
+	if err == nil && threshold > 0 {
+		err = register(EventThreshold, v1UsageFile, strconv.FormatUint(threshold, 10))
+	}
+	if err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+
+	w.start(func(file *os.File) error {
+		for {
+			if _, err := readEventfd(file); err != nil {
+				return err
+			}
+			w.send(Event{Name: names[file], Path: dir})
+		}
+	})
+	log.Infof("Watching memory events of %s with threshold %d bytes", dir, threshold)
+	return w, nil
+}
+
+// readEventfd reads the counter of the eventfd file, a native endian uint64. Blocks until non-zero.
+func readEventfd(file *os.File) (uint64, error) {
+	buf := make([]byte, 8)
+	n, err := file.Read(buf)
+	if err != nil {
+		return 0, err
+	}
+	if n != len(buf) {
+		return 0, fmt.Errorf("invalid eventfd read of %d bytes", n)
+	}
+	return binary.NativeEndian.Uint64(buf), nil
+}
+
+// readEvents reads the "name value" counters of the cgroup v2 memory.events file.
+func readEvents(name string) (map[string]uint64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	counters := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), " ")
+		if !found {
+			continue
+		}
+		if counters[key], err = strconv.ParseUint(value, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	return counters, scanner.Err()
+}
@@ -0,0 +1,161 @@
+package memevents
+
+import (
+	"encoding/binary"
+	"github.com/containerd/cgroups/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/sys/unix"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// See https://github.com/stretchr/testify#mock-package
+type MockCgroupsMode struct {
+	mock.Mock
+}
+
+func (m *MockCgroupsMode) Call() cgroups.CGMode {
+	args := m.Called()
+	return args.Get(0).(cgroups.CGMode)
+}
+
+type MockCgroupMemoryDir struct {
+	mock.Mock
+}
+
+func (m *MockCgroupMemoryDir) Call(int) (string, error) {
+	args := m.Called()
+	return args.String(0), args.Error(1)
+}
+
+func mockCgroup(t *testing.T, mode cgroups.CGMode, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(path.Join(dir, name), []byte(content), 0644))
+	}
+
+	mockMode := &MockCgroupsMode{}
+	mockMode.On("Call").Return(mode)
+	cgroupsMode = mockMode.Call
+
+	mockDir := &MockCgroupMemoryDir{}
+	mockDir.On("Call").Return(dir, nil)
+	procpsCgroupMemoryDir = mockDir.Call
+	return dir
+}
+
+func receive(t *testing.T, w *Watcher) Event {
+	select {
+	case event := <-w.Events():
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for memory event")
+		return Event{}
+	}
+}
+
+func TestWatchV2(t *testing.T) {
+	dir := mockCgroup(t, cgroups.Unified, map[string]string{
+		v2EventsFile: "low 0\nhigh 0\nmax 0\noom 0\noom_kill 0\n",
+	})
+
+	w, err := Watch(1, 0)
+	assert.NoError(t, err)
+
+	err = os.WriteFile(path.Join(dir, v2EventsFile), []byte("low 1\nhigh 1\nmax 0\noom 0\noom_kill 0\n"), 0644)
+	assert.NoError(t, err)
+	assert.Equal(t, Event{Name: EventHigh, Path: dir}, receive(t, w))
+
+	err = os.WriteFile(path.Join(dir, v2EventsFile), []byte("low 1\nhigh 1\nmax 1\noom 0\noom_kill 0\n"), 0644)
+	assert.NoError(t, err)
+	assert.Equal(t, Event{Name: EventMax, Path: dir}, receive(t, w))
+
+	assert.NoError(t, w.Close())
+	for range w.Events() {
+	}
+	assert.NoError(t, w.Err())
+}
+
+func TestWatchV2Error(t *testing.T) {
+	mockCgroup(t, cgroups.Unified, nil)
+
+	_, err := Watch(1, 0)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWatchV1(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold uint64
+		want      Event
+		control   string
+	}{
+		{
+			name:      "OOM",
+			threshold: 0,
+			want:      Event{Name: EventOOM},
+		},
+		{
+			name:      "Threshold",
+			threshold: 1024,
+			want:      Event{Name: EventThreshold},
+			control:   "1024",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := mockCgroup(t, cgroups.Legacy, map[string]string{
+				v1EventControlFile: "",
+				v1OOMControlFile:   "oom_kill_disable 0\nunder_oom 0\n",
+				v1UsageFile:        "0\n",
+			})
+
+			w, err := Watch(1, tt.threshold)
+			assert.NoError(t, err)
+			defer w.Close()
+
+			// The control file contains the last registration "<event_fd> <fd> [threshold]".
+			content, err := os.ReadFile(path.Join(dir, v1EventControlFile))
+			assert.NoError(t, err)
+			fields := strings.Fields(string(content))
+			assert.Equal(t, tt.control, strings.Join(fields[2:], " "))
+
+			// Notify the eventfd as the kernel would.
+			efd, err := strconv.Atoi(fields[0])
+			assert.NoError(t, err)
+			_, err = unix.Write(efd, binary.NativeEndian.AppendUint64(nil, 1))
+			assert.NoError(t, err)
+
+			tt.want.Path = dir
+			assert.Equal(t, tt.want, receive(t, w))
+		})
+	}
+}
+
+func TestWatchV1Error(t *testing.T) {
+	mockCgroup(t, cgroups.Legacy, map[string]string{
+		v1OOMControlFile: "oom_kill_disable 0\nunder_oom 0\n",
+	})
+
+	_, err := Watch(1, 0)
+	assert.Error(t, err)
+}
+
+func TestReadEvents(t *testing.T) {
+	dir := t.TempDir()
+	name := path.Join(dir, v2EventsFile)
+
+	assert.NoError(t, os.WriteFile(name, []byte("low 1\nhigh 2\nmax 3\noom 4\noom_kill 5\n"), 0644))
+	counters, err := readEvents(name)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"low": 1, "high": 2, "max": 3, "oom": 4, "oom_kill": 5}, counters)
+
+	assert.NoError(t, os.WriteFile(name, []byte("high invalid\n"), 0644))
+	_, err = readEvents(name)
+	assert.Error(t, err)
+}
@@ -0,0 +1,176 @@
+package nginxconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// token is a word of the Nginx configuration, or one of ";", "{" and "}" outside quotes.
+type token struct {
+	text   string
+	quoted bool // Whether the word was quoted, so that it is not a ";", "{" or "}".
+	line   int
+}
+
+// special returns a bool indicating whether the token is the specified ";", "{" or "}".
+func (t token) special(s string) bool {
+	return !t.quoted && t.text == s
+}
+
+// Suffix of the directives of the lua-nginx-module with a block of Lua code, e.g. "init_by_lua_block".
+const luaBlockSuffix = "_by_lua_block"
+
+// tokenize splits the Nginx configuration into tokens, skipping comments. Quoted words may span lines and
+// contain escaped quotes, and the braces of variables, e.g. "${host}", are part of the word. The Lua code of
+// "*_by_lua_block" directives is a single quoted word followed by ";", as if it were the argument of the directive.
+// Returns error if a quote, a variable or a Lua block is not closed.
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	var word strings.Builder
+	inWord, line := false, 1
+	stmt := 0 // Index of the first token of the current directive.
+	flush := func() {
+		if inWord {
+			tokens = append(tokens, token{text: word.String(), line: line})
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\n':
+			flush()
+			line++
+		case c == ' ' || c == '\t' || c == '\r':
+			flush()
+		case c == '#' && !inWord:
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+			i--
+		case c == ';' || c == '{' || c == '}':
+			if c == '{' && inWord && strings.HasSuffix(word.String(), "$") {
+				end := strings.IndexByte(text[i:], '}')
+				if end < 0 {
+					return nil, fmt.Errorf("line %d: unclosed variable", line)
+				}
+				word.WriteString(text[i : i+end+1])
+				i += end
+				continue
+			}
+			flush()
+			if c == '{' && len(tokens) > stmt && !tokens[stmt].quoted &&
+				strings.HasSuffix(tokens[stmt].text, luaBlockSuffix) {
+				end, lines, err := skipLua(text, i+1)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				tokens = append(tokens, token{text: text[i+1 : end], quoted: true, line: line},
+					token{text: ";", line: line + lines})
+				line += lines
+				i = end
+				stmt = len(tokens)
+				continue
+			}
+			tokens = append(tokens, token{text: string(c), line: line})
+			stmt = len(tokens)
+		case (c == '"' || c == '\'') && !inWord:
+			start := line
+			var quoted strings.Builder
+			for i++; i < len(text) && text[i] != c; i++ {
+				if text[i] == '\\' && i+1 < len(text) && (text[i+1] == c || text[i+1] == '\\') {
+					i++
+				}
+				if text[i] == '\n' {
+					line++
+				}
+				quoted.WriteByte(text[i])
+			}
+			if i == len(text) {
+				return nil, fmt.Errorf("line %d: unclosed quote", start)
+			}
+			tokens = append(tokens, token{text: quoted.String(), quoted: true, line: start})
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	flush()
+	return tokens, nil
+}
+
+// skipLua returns the index of the "}" closing the Lua block starting at the index, after its "{", and the number of
+// lines of the block. Braces in Lua strings and comments are skipped. Returns error if the block is not closed.
+func skipLua(text string, i int) (int, int, error) {
+	depth, lines := 1, 0
+	// skipTo returns the index after the closing text, or the end of the text, and counts the lines skipped.
+	skipTo := func(from int, closing string) int {
+		n := strings.Index(text[from:], closing)
+		if n < 0 {
+			lines += strings.Count(text[from:], "\n")
+			return len(text)
+		}
+		lines += strings.Count(text[from:from+n], "\n")
+		return from + n + len(closing)
+	}
+	for i < len(text) {
+		switch c := text[i]; {
+		case c == '\n':
+			lines++
+			i++
+		case strings.HasPrefix(text[i:], "--"):
+			// A long comment, e.g. "--[[ ... ]]", or a line comment up to the newline.
+			if level, ok := longBracket(text, i+2); ok {
+				i = skipTo(i+level+4, "]"+strings.Repeat("=", level)+"]")
+			} else {
+				for i < len(text) && text[i] != '\n' {
+					i++
+				}
+			}
+		case c == '[':
+			// A long string, e.g. "[==[ ... ]==]", or an index.
+			if level, ok := longBracket(text, i); ok {
+				i = skipTo(i+level+2, "]"+strings.Repeat("=", level)+"]")
+			} else {
+				i++
+			}
+		case c == '"' || c == '\'':
+			// A short string, which ends at the line at the latest.
+			for i++; i < len(text) && text[i] != c && text[i] != '\n'; i++ {
+				if text[i] == '\\' && i+1 < len(text) && text[i+1] != '\n' {
+					i++
+				}
+			}
+			if i < len(text) && text[i] == c {
+				i++
+			}
+		case c == '{':
+			depth++
+			i++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i, lines, nil
+			}
+			i++
+		default:
+			i++
+		}
+	}
+	return 0, 0, fmt.Errorf("unclosed Lua block")
+}
+
+// longBracket returns the level of the opening long bracket of Lua at the index, e.g. 2 for "[==[", and a bool
+// indicating whether there is one.
+func longBracket(text string, i int) (int, bool) {
+	if i >= len(text) || text[i] != '[' {
+		return 0, false
+	}
+	level := 0
+	for i+1+level < len(text) && text[i+1+level] == '=' {
+		level++
+	}
+	return level, i+1+level < len(text) && text[i+1+level] == '['
+}
@@ -0,0 +1,102 @@
+package nginxconf
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/log"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "Empty",
+			text: "",
+		},
+		{
+			name: "Directives",
+			text: "worker_processes 4;\nevents {\n\tworker_connections 1024; # per worker\n}\n",
+			want: []string{"worker_processes", "4", ";", "events", "{", "worker_connections", "1024", ";", "}"},
+		},
+		{
+			name: "Quotes",
+			text: `log_format main '$remote_addr "$request"' "a \"b\" c";`,
+			want: []string{"log_format", "main", `$remote_addr "$request"`, `a "b" c`, ";"},
+		},
+		{
+			name: "Variable",
+			text: "return 200 ${host}{};",
+			want: []string{"return", "200", "${host}", "{", "}", ";"},
+		},
+		{
+			name: "HashInWord",
+			text: "rewrite ^/a#b /c;",
+			want: []string{"rewrite", "^/a#b", "/c", ";"},
+		},
+		{
+			name: "LuaBlock",
+			text: "init_by_lua_block { collectgarbage(\"collect\") }\nworker_processes 2;",
+			want: []string{"init_by_lua_block", ` collectgarbage("collect") `, ";", "worker_processes", "2", ";"},
+		},
+		{
+			name: "LuaBlockBraces",
+			text: "log_by_lua_block { t = { a = \"}\", b = '{' } -- }\n s = [[}]] --[==[ { ]==] }",
+			want: []string{"log_by_lua_block", " t = { a = \"}\", b = '{' } -- }\n s = [[}]] --[==[ { ]==] ", ";"},
+		},
+		{
+			name: "LuaBlockEscapedQuote",
+			text: `content_by_lua_block { ngx.say("\"}") }`,
+			want: []string{"content_by_lua_block", ` ngx.say("\"}") `, ";"},
+		},
+		{
+			name:    "UnclosedLuaBlock",
+			text:    "init_by_lua_block { if a then {",
+			wantErr: true,
+		},
+		{
+			name:    "UnclosedQuote",
+			text:    `set $a "b;`,
+			wantErr: true,
+		},
+		{
+			name:    "UnclosedVariable",
+			text:    `set $a ${b;`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := tokenize(tt.text)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			var got []string
+			for _, token := range tokens {
+				got = append(got, token.text)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("LuaBlockLines", func(t *testing.T) {
+		tokens, err := tokenize("init_by_lua_block {\n-- }\ns = [[\n]]\n}\nd;")
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 1, 5, 6, 6}, []int{tokens[0].line, tokens[1].line, tokens[2].line, tokens[3].line,
+			tokens[4].line})
+	})
+
+	t.Run("Lines", func(t *testing.T) {
+		tokens, err := tokenize("a\n'b\nc'\nd;")
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 4, 4}, []int{tokens[0].line, tokens[1].line, tokens[2].line, tokens[3].line})
+		assert.True(t, tokens[1].quoted)
+		assert.False(t, (token{text: ";", quoted: true}).special(";"))
+	})
+}
@@ -0,0 +1,297 @@
+// Package nginxconf provides functions to read worker settings of the effective Nginx configuration.
+package nginxconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Maximum depth of nested includes, guards against include cycles.
+const maxIncludeDepth = 32
+
+var (
+	execCommand = exec.Command
+
+	// Header of each configuration file in the output of `nginx -T`.
+	dumpHeader = regexp.MustCompile(`(?m)^# configuration file (.+):$`)
+	// Pattern of an Nginx time, e.g. "1h 30m", "90s" or "500ms".
+	timePattern = regexp.MustCompile(`^(?:([0-9]+)(ms|[smhdwMy]?) ?)+$`)
+	timePart    = regexp.MustCompile(`([0-9]+)(ms|[smhdwMy]?)`)
+	timeUnits   = map[string]time.Duration{
+		"ms": time.Millisecond,
+		"":   time.Second,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  24 * time.Hour,
+		"w":  7 * 24 * time.Hour,
+		"M":  30 * 24 * time.Hour,
+		"y":  365 * 24 * time.Hour,
+	}
+)
+
+// Config is the worker settings of the Nginx configuration. Unset directives have the defaults of Nginx.
+type Config struct {
+	Source                string        // Source of the configuration, a file path or a command.
+	WorkerProcesses       int           // WorkerProcesses is the number of worker processes, "auto" is the number of CPUs.
+	WorkerProcessesAuto   bool          // WorkerProcessesAuto is whether worker_processes is "auto".
+	WorkerConnections     int           // WorkerConnections is the maximum number of connections of a worker process.
+	WorkerShutdownTimeout time.Duration // WorkerShutdownTimeout is the timeout of a graceful shutdown, zero if none.
+
+	set map[string]bool // Directives set by the configuration, the others have the defaults of Nginx.
+}
+
+// IsSet returns a bool indicating whether the directive is set by the configuration rather than defaulted,
+// e.g. "worker_processes".
+func (c *Config) IsSet(directive string) bool {
+	return c.set[directive]
+}
+
+// String returns a string representation of the Config.
+func (c *Config) String() string {
+	return fmt.Sprintf("worker_processes %d, worker_connections %d, worker_shutdown_timeout %v from %s",
+		c.WorkerProcesses, c.WorkerConnections, c.WorkerShutdownTimeout, c.Source)
+}
+
+// MarshalJSON returns the JSON encoding of the Config with the directive names as keys.
+func (c *Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Source                string `json:"source"`
+		WorkerProcesses       int    `json:"worker_processes"`
+		WorkerConnections     int    `json:"worker_connections"`
+		WorkerShutdownTimeout string `json:"worker_shutdown_timeout"`
+	}{c.Source, c.WorkerProcesses, c.WorkerConnections, c.WorkerShutdownTimeout.String()})
+}
+
+// files reads the configuration files and resolves the patterns of include directives.
+type files interface {
+	read(path string) (string, error)
+	glob(pattern string) ([]string, error)
+}
+
+// dirFiles reads the configuration files from the file system.
+type dirFiles struct{}
+
+func (dirFiles) read(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	return string(content), err
+}
+
+func (dirFiles) glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+// dumpFiles reads the configuration files from the output of `nginx -T`, by path.
+type dumpFiles map[string]string
+
+func (d dumpFiles) read(path string) (string, error) {
+	content, ok := d[path]
+	if !ok {
+		return "", fmt.Errorf("configuration file %s not found in dump", path)
+	}
+	return content, nil
+}
+
+func (d dumpFiles) glob(pattern string) ([]string, error) {
+	var paths []string
+	for path := range d {
+		matched, err := filepath.Match(pattern, path)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
+
+// ReadFile reads the Nginx configuration file, e.g. a mounted "/etc/nginx/nginx.conf", and its includes.
+// Relative include paths are resolved against the directory of the file. Returns error if invalid.
+func ReadFile(path string) (*Config, error) {
+	return read(dirFiles{}, path, path)
+}
+
+// ReadCommand reads the Nginx configuration dumped by the command, e.g. "nginx -T". Returns error if the command
+// fails or the dump is invalid.
+func ReadCommand(name string, args ...string) (*Config, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := execCommand(name, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	source := strings.Join(append([]string{name}, args...), " ")
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w: %s", source, err, strings.TrimSpace(stderr.String()))
+	}
+	dump := stdout.String()
+	headers := dumpHeader.FindAllStringSubmatchIndex(dump, -1)
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("%s: no configuration file in output", source)
+	}
+	files := make(dumpFiles)
+	for i, header := range headers {
+		end := len(dump)
+		if i+1 < len(headers) {
+			end = headers[i+1][0]
+		}
+		files[dump[header[2]:header[3]]] = dump[header[1]:end]
+	}
+	main := dump[headers[0][2]:headers[0][3]]
+	return read(files, main, source)
+}
+
+// read parses the main configuration file and its includes.
+func read(files files, main string, source string) (*Config, error) {
+	c := &Config{Source: source, WorkerProcesses: 1, WorkerConnections: 512, set: make(map[string]bool)}
+	p := &parser{files: files, dir: filepath.Dir(main), config: c}
+	if err := p.parseFile(main, nil, 0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parser parses the directives of the configuration files into a Config.
+type parser struct {
+	files  files
+	dir    string // Directory of the main configuration file, relative includes are resolved against it.
+	config *Config
+}
+
+// parseFile parses the directives of the file in the context of the enclosing blocks, e.g. ["events"].
+func (p *parser) parseFile(path string, blocks []string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: includes nested deeper than %d", path, maxIncludeDepth)
+	}
+	text, err := p.files.read(path)
+	if err != nil {
+		return err
+	}
+	tokens, err := tokenize(text)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	depthOfFile := len(blocks)
+	var args []token
+	for _, t := range tokens {
+		switch {
+		case t.special(";"):
+			if len(args) == 0 {
+				return fmt.Errorf("%s:%d: unexpected \";\"", path, t.line)
+			}
+			if err := p.directive(args, blocks, depth); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, args[0].line, err)
+			}
+			args = nil
+		case t.special("{"):
+			if len(args) == 0 {
+				return fmt.Errorf("%s:%d: unexpected \"{\"", path, t.line)
+			}
+			blocks = append(blocks, args[0].text)
+			args = nil
+		case t.special("}"):
+			if len(args) > 0 || len(blocks) == depthOfFile {
+				return fmt.Errorf("%s:%d: unexpected \"}\"", path, t.line)
+			}
+			blocks = blocks[:len(blocks)-1]
+		default:
+			args = append(args, t)
+		}
+	}
+	if len(args) > 0 || len(blocks) != depthOfFile {
+		return fmt.Errorf("%s: unexpected end of file", path)
+	}
+	return nil
+}
+
+// directive applies the directive with its arguments in the context of the enclosing blocks.
+func (p *parser) directive(args []token, blocks []string, depth int) error {
+	name, values := args[0].text, args[1:]
+	context := strings.Join(blocks, " ")
+	switch {
+	case name == "include":
+		if len(values) != 1 {
+			return fmt.Errorf("invalid number of arguments in %q", name)
+		}
+		pattern := values[0].text
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(p.dir, pattern)
+		}
+		paths, err := p.files.glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return fmt.Errorf("include %s not found", pattern)
+		}
+		for _, path := range paths {
+			if err := p.parseFile(path, blocks, depth+1); err != nil {
+				return err
+			}
+		}
+	case name == "worker_processes" && context == "":
+		if len(values) != 1 {
+			return fmt.Errorf("invalid number of arguments in %q", name)
+		}
+		// The CPUs of the reading process, which may differ from the CPUs of Nginx, e.g. in a sidecar container.
+		if values[0].text == "auto" {
+			p.config.WorkerProcesses, p.config.WorkerProcessesAuto = runtime.NumCPU(), true
+			p.config.set[name] = true
+			return nil
+		}
+		n, err := strconv.Atoi(values[0].text)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid %s %q", name, values[0].text)
+		}
+		p.config.WorkerProcesses, p.config.WorkerProcessesAuto = n, false
+		p.config.set[name] = true
+	case name == "worker_connections" && context == "events":
+		if len(values) != 1 {
+			return fmt.Errorf("invalid number of arguments in %q", name)
+		}
+		n, err := strconv.Atoi(values[0].text)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid %s %q", name, values[0].text)
+		}
+		p.config.WorkerConnections = n
+		p.config.set[name] = true
+	case name == "worker_shutdown_timeout" && context == "":
+		if len(values) != 1 {
+			return fmt.Errorf("invalid number of arguments in %q", name)
+		}
+		timeout, err := parseTime(values[0].text)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+		p.config.WorkerShutdownTimeout = timeout
+		p.config.set[name] = true
+	}
+	return nil
+}
+
+// parseTime converts an Nginx time to a duration. Returns error if invalid.
+// E.g. "1h 30m" becomes 90 minutes, and a number without a unit is in seconds.
+func parseTime(value string) (time.Duration, error) {
+	if !timePattern.MatchString(value) {
+		return 0, fmt.Errorf("invalid time: %q", value)
+	}
+	var result time.Duration
+	for _, part := range timePart.FindAllStringSubmatch(value, -1) {
+		n, err := strconv.ParseInt(part[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time: %q", value)
+		}
+		result += time.Duration(n) * timeUnits[part[2]]
+	}
+	return result, nil
+}
@@ -0,0 +1,247 @@
+package nginxconf
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// writeFiles writes the files with paths relative to a temporary directory. Returns the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return dir
+}
+
+// Worker directives set by a configuration, as reported by Config.IsSet.
+var allDirectives = map[string]bool{
+	"worker_processes":        true,
+	"worker_connections":      true,
+	"worker_shutdown_timeout": true,
+}
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    Config
+		wantErr bool
+	}{
+		{
+			name:  "Defaults",
+			files: map[string]string{"nginx.conf": "events {}\nhttp {}\n"},
+			want:  Config{WorkerProcesses: 1, WorkerConnections: 512, set: map[string]bool{}},
+		},
+		{
+			name: "Directives",
+			files: map[string]string{"nginx.conf": `
+				worker_processes 4;
+				worker_shutdown_timeout "1h 30m";
+				events { worker_connections 16384; }
+				http { server { worker_connections 1; } }
+			`},
+			want: Config{
+				WorkerProcesses: 4, WorkerConnections: 16384, WorkerShutdownTimeout: 90 * time.Minute,
+				set: allDirectives,
+			},
+		},
+		{
+			name:  "Auto",
+			files: map[string]string{"nginx.conf": "worker_processes auto;"},
+			want: Config{
+				WorkerProcesses: runtime.NumCPU(), WorkerProcessesAuto: true, WorkerConnections: 512,
+				set: map[string]bool{"worker_processes": true},
+			},
+		},
+		{
+			name: "Includes",
+			files: map[string]string{
+				"nginx.conf":         "include main.d/*.conf;\nevents { include events.conf; }\nhttp { include conf.d/*.conf; }",
+				"main.d/worker.conf": "worker_shutdown_timeout 240s;",
+				"events.conf":        "worker_connections 1024;",
+				"conf.d/http.conf":   "worker_processes 8;",
+			},
+			want: Config{
+				WorkerProcesses: 1, WorkerConnections: 1024, WorkerShutdownTimeout: 4 * time.Minute,
+				set: map[string]bool{"worker_connections": true, "worker_shutdown_timeout": true},
+			},
+		},
+		{
+			name:    "IncludeNotFound",
+			files:   map[string]string{"nginx.conf": "include mime.types;"},
+			wantErr: true,
+		},
+		{
+			name:    "IncludeCycle",
+			files:   map[string]string{"nginx.conf": "include nginx.conf;"},
+			wantErr: true,
+		},
+		{
+			name:    "InvalidWorkerProcesses",
+			files:   map[string]string{"nginx.conf": "worker_processes four;"},
+			wantErr: true,
+		},
+		{
+			name:    "InvalidWorkerConnections",
+			files:   map[string]string{"nginx.conf": "events { worker_connections 0; }"},
+			wantErr: true,
+		},
+		{
+			name:    "InvalidWorkerShutdownTimeout",
+			files:   map[string]string{"nginx.conf": "worker_shutdown_timeout 10x;"},
+			wantErr: true,
+		},
+		{
+			name:    "InvalidArguments",
+			files:   map[string]string{"nginx.conf": "worker_processes 1 2;"},
+			wantErr: true,
+		},
+		{
+			name:    "UnclosedBlock",
+			files:   map[string]string{"nginx.conf": "events {"},
+			wantErr: true,
+		},
+		{
+			name:    "UnexpectedBrace",
+			files:   map[string]string{"nginx.conf": "events {}}"},
+			wantErr: true,
+		},
+		{
+			name:    "UnexpectedSemicolon",
+			files:   map[string]string{"nginx.conf": ";"},
+			wantErr: true,
+		},
+		{
+			name:    "NotFound",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(writeFiles(t, tt.files), "nginx.conf")
+			got, err := ReadFile(path)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			tt.want.Source = path
+			assert.Equal(t, &tt.want, got)
+		})
+	}
+}
+
+func TestReadFile_IngressNginx(t *testing.T) {
+	got, err := ReadFile("testdata/ingress-nginx.conf")
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{
+		Source:                "testdata/ingress-nginx.conf",
+		WorkerProcesses:       4,
+		WorkerConnections:     16384,
+		WorkerShutdownTimeout: 240 * time.Second,
+		set:                   allDirectives,
+	}, got)
+}
+
+func TestReadCommand(t *testing.T) {
+	dump := `# configuration file /etc/nginx/nginx.conf:
+worker_processes 2;
+worker_shutdown_timeout 10s;
+events { include /etc/nginx/events.conf; }
+http { include conf.d/*.conf; }
+
+# configuration file /etc/nginx/events.conf:
+worker_connections 4096;
+
+# configuration file /etc/nginx/conf.d/default.conf:
+server { listen 80; }
+`
+	dir := writeFiles(t, map[string]string{"dump": dump, "empty": ""})
+
+	t.Run("Dump", func(t *testing.T) {
+		got, err := ReadCommand("cat", filepath.Join(dir, "dump"))
+		assert.NoError(t, err)
+		assert.Equal(t, &Config{
+			Source:                "cat " + filepath.Join(dir, "dump"),
+			WorkerProcesses:       2,
+			WorkerConnections:     4096,
+			WorkerShutdownTimeout: 10 * time.Second,
+			set:                   allDirectives,
+		}, got)
+	})
+	t.Run("NoConfigurationFile", func(t *testing.T) {
+		_, err := ReadCommand("cat", filepath.Join(dir, "empty"))
+		log.Error(err)
+		assert.Error(t, err)
+	})
+	t.Run("CommandFailed", func(t *testing.T) {
+		execCommand = func(string, ...string) *exec.Cmd { return exec.Command("false") }
+		defer func() { execCommand = exec.Command }()
+		_, err := ReadCommand("nginx", "-T")
+		log.Error(err)
+		assert.ErrorContains(t, err, "nginx -T failed")
+	})
+}
+
+func TestConfig_IsSet(t *testing.T) {
+	c := &Config{WorkerProcesses: 1, set: map[string]bool{"worker_shutdown_timeout": true}}
+	assert.True(t, c.IsSet("worker_shutdown_timeout"))
+	assert.False(t, c.IsSet("worker_processes"))
+	assert.False(t, (&Config{}).IsSet("worker_processes"))
+}
+
+func TestConfig_String(t *testing.T) {
+	c := &Config{Source: "/etc/nginx/nginx.conf", WorkerProcesses: 4, WorkerConnections: 1024,
+		WorkerShutdownTimeout: 10 * time.Second}
+	assert.Equal(t, "worker_processes 4, worker_connections 1024, worker_shutdown_timeout 10s from /etc/nginx/nginx.conf",
+		c.String())
+
+	got, err := json.Marshal(c)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"source": "/etc/nginx/nginx.conf", "worker_processes": 4, "worker_connections": 1024,
+		"worker_shutdown_timeout": "10s"}`, string(got))
+}
+
+func Test_parseTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "30", want: 30 * time.Second},
+		{value: "500ms", want: 500 * time.Millisecond},
+		{value: "1h30m", want: 90 * time.Minute},
+		{value: "1d 12h", want: 36 * time.Hour},
+		{value: "1w", want: 7 * 24 * time.Hour},
+		{value: "1M", want: 30 * 24 * time.Hour},
+		{value: "1y", want: 365 * 24 * time.Hour},
+		{value: "", wantErr: true},
+		{value: "10x", wantErr: true},
+		{value: "-1s", wantErr: true},
+		{value: "99999999999999999999s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseTime(tt.value)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
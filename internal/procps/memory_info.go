@@ -3,6 +3,7 @@ package procps
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/containerd/cgroups/v3"
 	"github.com/containerd/cgroups/v3/cgroup1"
 	"github.com/containerd/cgroups/v3/cgroup2"
@@ -22,8 +23,13 @@ const (
 
 	v1LimitFile = "memory.limit_in_bytes"
 	v1UsageFile = "memory.usage_in_bytes"
+	v1StatFile  = "memory.stat"
+	v1StatLimit = "hierarchical_memory_limit"
 	v2LimitFile = "memory.max"
 	v2UsageFile = "memory.current"
+	v2StatFile  = "memory.stat"
+
+	v2PressureFile = "memory.pressure"
 )
 
 var (
@@ -39,7 +45,8 @@ type MemoryInfo struct {
 }
 
 // NewMemoryInfo creates a new NewMemoryInfo instance by reading system and cgroup memory of the specified pid.
-func NewMemoryInfo(pid int) *MemoryInfo {
+// The available cgroup memory is calculated using the specified MemoryCalculation.
+func NewMemoryInfo(pid int, calculation MemoryCalculation) *MemoryInfo {
 	var m = &MemoryInfo{}
 	var err error
 
@@ -49,12 +56,16 @@ func NewMemoryInfo(pid int) *MemoryInfo {
 		return m
 	}
 
-	limit, available, err := ReadCgroupMemory(pid)
+	c, err := ReadCgroupMemory(pid)
 	if err != nil {
 		log.Errorf("Failed to read cgroup memory: %v, using system %v", err, m)
 		return m
 	}
-	m.Total = min(m.Total, limit)
+	available := c.Available(calculation)
+	log.Debugf("Cgroup memory %v, available %d bytes by usage and %d bytes by working set, using %v",
+		c, c.Available(MemoryUsage), c.Available(MemoryWorkingSet), calculation)
+
+	m.Total = min(m.Total, c.Limit)
 	m.Available = min(m.Available, available)
 
 	return m
@@ -97,48 +108,263 @@ func ReadSystemMemory() (uint64, uint64, error) {
 	return *meminfo.MemTotal * 1024, *meminfo.MemAvailable * 1024, nil
 }
 
+// MemoryCalculation defines how the available cgroup memory is calculated.
+type MemoryCalculation uint32
+
+// Memory calculations.
+const (
+	MemoryUsage      MemoryCalculation = iota // MemoryUsage subtracts the memory usage including page cache.
+	MemoryWorkingSet                          // MemoryWorkingSet subtracts the usage without inactive page cache.
+	MemoryNoFile                              // MemoryNoFile subtracts the usage without any page cache.
+)
+
+// MemoryCalculation name to MemoryCalculation mapping.
+var memoryCalculations = map[string]MemoryCalculation{
+	"usage":       MemoryUsage,
+	"working-set": MemoryWorkingSet,
+	"no-file":     MemoryNoFile,
+}
+
+// ParseMemoryCalculation converts case-insensitive string to MemoryCalculation. Returns error if invalid.
+// E.g. "working-set" becomes MemoryWorkingSet.
+func ParseMemoryCalculation(name string) (MemoryCalculation, error) {
+	if c, ok := memoryCalculations[strings.ToLower(name)]; ok {
+		return c, nil
+	}
+	return 0, fmt.Errorf("invalid memory calculation: %q", name)
+}
+
+// String returns the name of the MemoryCalculation.
+func (c MemoryCalculation) String() string {
+	for name, calculation := range memoryCalculations {
+		if calculation == c {
+			return name
+		}
+	}
+	return fmt.Sprintf("MemoryCalculation(%d)", c)
+}
+
+// CgroupMemory represents a cgroup memory information in bytes.
+type CgroupMemory struct {
+	Limit        uint64 `json:"limit"`
+	Usage        uint64 `json:"usage"`
+	InactiveFile uint64 `json:"inactive_file"`
+	ActiveFile   uint64 `json:"active_file"`
+	LimitPath    string `json:"limit_path"`   // Directory of the cgroup the usage and statistics are read from.
+	LimitSource  string `json:"limit_source"` // Limit file or statistic the limit is read from.
+}
+
+// Available calculates the available memory in bytes using the specified MemoryCalculation.
+// MemoryWorkingSet matches the working set of kubelet, the usage minus the inactive page cache.
+func (c *CgroupMemory) Available(calculation MemoryCalculation) uint64 {
+	used := c.Usage
+	switch calculation {
+	case MemoryWorkingSet:
+		used -= min(used, c.InactiveFile)
+	case MemoryNoFile:
+		used -= min(used, c.InactiveFile+c.ActiveFile)
+	}
+	// Usage may temporarily exceed the limit.
+	return c.Limit - min(c.Limit, used)
+}
+
+// String returns the JSON representation of the CgroupMemory instance.
+func (c *CgroupMemory) String() string {
+	s, _ := json.Marshal(c)
+	return string(s)
+}
+
 // ReadCgroupMemory reads the cgroup memory information of the specified pid.
-// Returns the limit and available memory in bytes, and error, if any.
+// The limit is the tightest limit of the cgroup and its ancestors, and the usage and statistics are read from
+// the cgroup that sets the limit, recorded as LimitPath. If the cgroup v1 hierarchical_memory_limit statistic is
+// tighter, the limit is set by an ancestor invisible in a cgroup namespace, so the usage and statistics are read
+// from the cgroup itself, excluding the usage of its siblings, and LimitSource records the statistic.
+// Returns the CgroupMemory and error, if any.
 // See https://www.kernel.org/doc/Documentation/cgroup-v1/memory.txt
 // See https://www.kernel.org/doc/Documentation/cgroup-v2.txt
-func ReadCgroupMemory(pid int) (uint64, uint64, error) {
-	cgroupMountPoint := env.GetString(envCgroupMountPoint, "/sys/fs/cgroup")
-
-	var limitFile, usageFile string
+func ReadCgroupMemory(pid int) (*CgroupMemory, error) {
+	cgroupDir, err := CgroupMemoryDir(pid)
+	if err != nil {
+		return nil, err
+	}
+	rootDir := env.GetString(envCgroupMountPoint, "/sys/fs/cgroup")
 
+	// Hierarchical cgroup v1 statistics have the "total_" prefix.
+	var limitFile, usageFile, statFile, statPrefix string
 	if cgroupsMode() == cgroups.Unified {
-		cgroupPath, err := cgroup2PidGroupPath(pid)
+		limitFile, usageFile, statFile = v2LimitFile, v2UsageFile, v2StatFile
+	} else {
+		limitFile, usageFile, statFile = v1LimitFile, v1UsageFile, v1StatFile
+		statPrefix = "total_"
+		rootDir = path.Join(rootDir, string(cgroup1.Memory))
+	}
+
+	c := &CgroupMemory{LimitSource: limitFile}
+	if c.LimitPath, c.Limit, err = readHierarchicalLimit(cgroupDir, rootDir, limitFile); err != nil {
+		return nil, err
+	}
+	stat, err := readStat(path.Join(cgroupDir, statFile))
+	if err != nil {
+		return nil, err
+	}
+	// The cgroup v1 ancestors may be invisible in a cgroup namespace, but the kernel reports the effective limit.
+	if limit, ok := stat[v1StatLimit]; ok && limit < c.Limit {
+		c.Limit, c.LimitPath, c.LimitSource = limit, cgroupDir, v1StatLimit
+	}
+
+	if c.LimitPath != cgroupDir {
+		if stat, err = readStat(path.Join(c.LimitPath, statFile)); err != nil {
+			return nil, err
+		}
+	}
+	if c.Usage, err = readContentUint64(path.Join(c.LimitPath, usageFile)); err != nil {
+		return nil, err
+	}
+	c.InactiveFile = stat[statPrefix+"inactive_file"]
+	c.ActiveFile = stat[statPrefix+"active_file"]
+
+	return c, nil
+}
+
+// readHierarchicalLimit reads the limit file of the cgroup directory and its ancestors up to the root directory.
+// Ancestors without the limit file, such as the cgroup v2 root, are skipped.
+// Returns the directory with the tightest limit, the limit, and error, if any.
+func readHierarchicalLimit(cgroupDir, rootDir, limitFile string) (string, uint64, error) {
+	limit, err := readContentUint64(path.Join(cgroupDir, limitFile))
+	if err != nil {
+		return "", 0, err
+	}
+	limitDir := cgroupDir
+
+	for dir := cgroupDir; dir != rootDir && strings.HasPrefix(dir, rootDir+"/"); {
+		dir = path.Dir(dir)
+		value, err := readContentUint64(path.Join(dir, limitFile))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
 		if err != nil {
-			return 0, 0, err
+			return "", 0, err
 		}
-		limitFile = path.Join(cgroupMountPoint, cgroupPath, v2LimitFile)
-		usageFile = path.Join(cgroupMountPoint, cgroupPath, v2UsageFile)
-	} else {
-		subsystem := cgroup1.Memory
-		cgroupPath, err := cgroup1PidPath(pid)(subsystem)
+		if value < limit {
+			limit, limitDir = value, dir
+		}
+	}
+	return limitDir, limit, nil
+}
+
+// CgroupMemoryDir returns the directory of the memory cgroup of the specified pid, and error, if any.
+// For cgroup v1, falls back to the root of the memory hierarchy if the full path does not exist (cgroup namespace).
+func CgroupMemoryDir(pid int) (string, error) {
+	cgroupMountPoint := env.GetString(envCgroupMountPoint, "/sys/fs/cgroup")
+
+	if cgroupsMode() == cgroups.Unified {
+		cgroupPath, err := cgroup2PidGroupPath(pid)
 		if err != nil {
-			return 0, 0, err
+			return "", err
 		}
-		// Check if the full cgroup v1 path exists, otherwise try the root path (cgroup namespace).
-		if _, err = os.Stat(path.Join(cgroupMountPoint, string(subsystem), cgroupPath)); err != nil {
-			cgroupPath, _ = cgroup1.RootPath(subsystem)
+		return path.Join(cgroupMountPoint, cgroupPath), nil
+	}
+
+	subsystem := cgroup1.Memory
+	cgroupPath, err := cgroup1PidPath(pid)(subsystem)
+	if err != nil {
+		return "", err
+	}
+	// Check if the full cgroup v1 path exists, otherwise try the root path (cgroup namespace).
+	if _, err = os.Stat(path.Join(cgroupMountPoint, string(subsystem), cgroupPath)); err != nil {
+		cgroupPath, _ = cgroup1.RootPath(subsystem)
+	}
+	return path.Join(cgroupMountPoint, string(subsystem), cgroupPath), nil
+}
+
+// MemoryPressure represents a memory pressure stall information, the share of time in percent in which some or all
+// non-idle tasks were stalled waiting for memory, averaged over the last 10 and 60 seconds.
+type MemoryPressure struct {
+	SomeAvg10 float64 `json:"some_avg10"`
+	SomeAvg60 float64 `json:"some_avg60"`
+	FullAvg10 float64 `json:"full_avg10"`
+	FullAvg60 float64 `json:"full_avg60"`
+}
+
+// String returns the JSON representation of the MemoryPressure instance.
+func (p *MemoryPressure) String() string {
+	s, _ := json.Marshal(p)
+	return string(s)
+}
+
+// ReadMemoryPressure reads the memory pressure of the cgroup v2 of the specified pid, or of the system
+// if the cgroup memory pressure is not available. Returns error, if any.
+// See https://docs.kernel.org/accounting/psi.html
+func ReadMemoryPressure(pid int) (*MemoryPressure, error) {
+	if cgroupsMode() == cgroups.Unified {
+		cgroupDir, err := CgroupMemoryDir(pid)
+		if err == nil {
+			var p *MemoryPressure
+			if p, err = readPressure(path.Join(cgroupDir, v2PressureFile)); err == nil {
+				return p, nil
+			}
 		}
-		limitFile = path.Join(cgroupMountPoint, string(subsystem), cgroupPath, v1LimitFile)
-		usageFile = path.Join(cgroupMountPoint, string(subsystem), cgroupPath, v1UsageFile)
+		log.Debugf("Failed to read cgroup memory pressure: %v, using system", err)
 	}
+	procMountPoint := env.GetString(envProcMountPoint, "/proc")
+	return readPressure(path.Join(procMountPoint, "pressure", "memory"))
+}
 
-	limit, err := readContentUint64(limitFile)
+// readPressure reads the memory pressure from the specified file of the format
+// "some avg10=0.00 avg60=0.00 avg300=0.00 total=0" followed by the same "full" line.
+// Returns parsed MemoryPressure and error, if any.
+func readPressure(filePath string) (*MemoryPressure, error) {
+	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
-	usage, err := readContentUint64(usageFile)
+
+	p := &MemoryPressure{}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		averages := map[string]*float64{}
+		switch fields[0] {
+		case "some":
+			averages["avg10"], averages["avg60"] = &p.SomeAvg10, &p.SomeAvg60
+		case "full":
+			averages["avg10"], averages["avg60"] = &p.FullAvg10, &p.FullAvg60
+		default:
+			return nil, fmt.Errorf("invalid pressure line: %q", line)
+		}
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+			if average, ok := averages[key]; ok {
+				if *average, err = strconv.ParseFloat(value, 64); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// readStat reads the "name value" pairs of the cgroup memory.stat file.
+// Returns parsed values and error, if any.
+func readStat(filePath string) (map[string]uint64, error) {
+	content, err := os.ReadFile(filePath)
 	if err != nil {
-		return 0, 0, err
+		return nil, err
 	}
 
-	// Usage may temporarily exceed the limit.
-	available := max(0, limit-usage)
-	return limit, available, nil
+	stat := make(map[string]uint64)
+	for _, line := range strings.Split(string(content), "\n") {
+		key, value, found := strings.Cut(strings.TrimSpace(line), " ")
+		if !found {
+			continue
+		}
+		if stat[key], err = strconv.ParseUint(value, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	return stat, nil
 }
 
 // readContentUint64 reads uint64 value from the specified file.
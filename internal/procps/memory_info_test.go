@@ -86,7 +86,7 @@ func TestNewMemoryInfo(t *testing.T) {
 			},
 			want: &MemoryInfo{
 				Total:     min(totalKB*1024, limit),
-				Available: min(availableKB*1024, max(0, limit-usage)),
+				Available: min(availableKB*1024, limit-min(limit, usage)),
 			},
 		},
 	}
@@ -115,16 +115,17 @@ func TestNewMemoryInfo(t *testing.T) {
 
 				writeFile(t, path.Join(tempDir, cgroupPath, v2LimitFile), fmt.Sprintln(tt.data.limit))
 				writeFile(t, path.Join(tempDir, cgroupPath, v2UsageFile), fmt.Sprintln(tt.data.usage))
+				writeFile(t, path.Join(tempDir, cgroupPath, v2StatFile), "anon 0\ninactive_file 0\n")
 			}
 			t.Setenv(envCgroupMountPoint, tempDir)
 
-			assert.Equal(t, tt.want, NewMemoryInfo(os.Getpid()))
+			assert.Equal(t, tt.want, NewMemoryInfo(os.Getpid(), MemoryUsage))
 		})
 	}
 	t.Run("Default", func(t *testing.T) {
 		tempDir := t.TempDir()
 		t.Setenv(envProcMountPoint, tempDir)
-		assert.Equal(t, &MemoryInfo{}, NewMemoryInfo(os.Getpid()))
+		assert.Equal(t, &MemoryInfo{}, NewMemoryInfo(os.Getpid(), MemoryUsage))
 	})
 }
 
@@ -289,14 +290,13 @@ func TestReadSystemMemory(t *testing.T) {
 func TestReadCgroupMemory(t *testing.T) {
 	limit := rand.Uint64()
 	usage := rand.Uint64()
+	inactiveFile := rand.Uint64()
+	activeFile := rand.Uint64()
 
 	type data struct {
 		limit string
 		usage string
-	}
-	type want struct {
-		limit     uint64
-		available uint64
+		stat  string
 	}
 	type wantErr struct {
 		path    bool
@@ -306,7 +306,7 @@ func TestReadCgroupMemory(t *testing.T) {
 		name    string
 		data    data
 		mode    cgroups.CGMode
-		want    want
+		want    *CgroupMemory
 		wantErr wantErr
 	}{
 		{
@@ -314,11 +314,12 @@ func TestReadCgroupMemory(t *testing.T) {
 			data: data{
 				limit: fmt.Sprintln(limit),
 				usage: fmt.Sprintln(usage),
+				stat: fmt.Sprintf("inactive_file 1\nactive_file 2\ntotal_inactive_file %d\ntotal_active_file %d\n",
+					inactiveFile, activeFile),
 			},
 			mode: cgroups.Legacy,
-			want: want{
-				limit:     limit,
-				available: max(0, limit-usage),
+			want: &CgroupMemory{
+				Limit: limit, Usage: usage, InactiveFile: inactiveFile, ActiveFile: activeFile, LimitSource: v1LimitFile,
 			},
 		},
 		{
@@ -326,11 +327,11 @@ func TestReadCgroupMemory(t *testing.T) {
 			data: data{
 				limit: fmt.Sprintln(limit),
 				usage: fmt.Sprintln(usage),
+				stat:  fmt.Sprintf("anon 1\ninactive_file %d\nactive_file %d\n", inactiveFile, activeFile),
 			},
 			mode: cgroups.Unified,
-			want: want{
-				limit:     limit,
-				available: max(0, limit-usage),
+			want: &CgroupMemory{
+				Limit: limit, Usage: usage, InactiveFile: inactiveFile, ActiveFile: activeFile, LimitSource: v2LimitFile,
 			},
 		},
 		{
@@ -338,6 +339,7 @@ func TestReadCgroupMemory(t *testing.T) {
 			data: data{
 				limit: fmt.Sprintln(limit),
 				usage: fmt.Sprintln(usage),
+				stat:  "",
 			},
 			mode: cgroups.Legacy,
 			wantErr: wantErr{
@@ -349,6 +351,7 @@ func TestReadCgroupMemory(t *testing.T) {
 			data: data{
 				limit: fmt.Sprintln(limit),
 				usage: fmt.Sprintln(usage),
+				stat:  "",
 			},
 			mode: cgroups.Unified,
 			wantErr: wantErr{
@@ -359,6 +362,7 @@ func TestReadCgroupMemory(t *testing.T) {
 			name: "LimitError",
 			data: data{
 				usage: fmt.Sprintln(usage),
+				stat:  "",
 			},
 			mode: cgroups.Legacy,
 			wantErr: wantErr{
@@ -369,6 +373,19 @@ func TestReadCgroupMemory(t *testing.T) {
 			name: "UsageError",
 			data: data{
 				limit: fmt.Sprintln(limit),
+				stat:  "",
+			},
+			mode: cgroups.Unified,
+			wantErr: wantErr{
+				content: true,
+			},
+		},
+		{
+			name: "StatError",
+			data: data{
+				limit: fmt.Sprintln(limit),
+				usage: fmt.Sprintln(usage),
+				stat:  "inactive_file X\n",
 			},
 			mode: cgroups.Unified,
 			wantErr: wantErr{
@@ -390,6 +407,7 @@ func TestReadCgroupMemory(t *testing.T) {
 			if tt.mode == cgroups.Unified {
 				writeFile(t, path.Join(tempDir, cgroupPath, v2LimitFile), tt.data.limit)
 				writeFile(t, path.Join(tempDir, cgroupPath, v2UsageFile), tt.data.usage)
+				writeFile(t, path.Join(tempDir, cgroupPath, v2StatFile), tt.data.stat)
 
 				var mockCgroup2PidGroupPath MockCgroup2PidGroupPath
 				if tt.wantErr.path {
@@ -403,6 +421,7 @@ func TestReadCgroupMemory(t *testing.T) {
 				subsystem := cgroup1.Memory
 				writeFile(t, path.Join(tempDir, string(subsystem), cgroupPath, v1LimitFile), tt.data.limit)
 				writeFile(t, path.Join(tempDir, string(subsystem), cgroupPath, v1UsageFile), tt.data.usage)
+				writeFile(t, path.Join(tempDir, string(subsystem), cgroupPath, v1StatFile), tt.data.stat)
 
 				var mockCgroup1PidPath MockCgroup1PidPath
 				if tt.wantErr.path {
@@ -414,21 +433,380 @@ func TestReadCgroupMemory(t *testing.T) {
 				defer func() { cgroup1PidPath = cgroup1.PidPath }()
 			}
 
-			got1, got2, err := ReadCgroupMemory(os.Getpid())
+			got, err := ReadCgroupMemory(os.Getpid())
+			if tt.want != nil {
+				tt.want.LimitPath = tempDir
+				if tt.mode == cgroups.Legacy {
+					tt.want.LimitPath = path.Join(tempDir, string(cgroup1.Memory))
+				}
+			}
 			if tt.wantErr.path || tt.wantErr.content {
 				log.Error(err)
-				assert.Zero(t, got1)
-				assert.Zero(t, got2)
+				assert.Nil(t, got)
 				assert.Error(t, err)
 			} else {
-				assert.Equal(t, tt.want.limit, got1)
-				assert.Equal(t, tt.want.available, got2)
+				assert.Equal(t, tt.want, got)
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestReadCgroupMemoryHierarchy(t *testing.T) {
+	type file struct {
+		path    string
+		content string
+	}
+	tests := []struct {
+		name       string
+		mode       cgroups.CGMode
+		cgroupPath string
+		files      []file
+		want       *CgroupMemory
+		wantErr    bool
+	}{
+		{
+			name:       "V2PodLimit",
+			mode:       cgroups.Unified,
+			cgroupPath: "/kubepods/pod/nginx",
+			files: []file{
+				{path: "kubepods/memory.max", content: "8000\n"},
+				{path: "kubepods/pod/memory.max", content: "1000\n"},
+				{path: "kubepods/pod/memory.current", content: "600\n"},
+				{path: "kubepods/pod/memory.stat", content: "inactive_file 200\nactive_file 100\n"},
+				{path: "kubepods/pod/nginx/memory.max", content: "max\n"},
+				{path: "kubepods/pod/nginx/memory.current", content: "500\n"},
+				{path: "kubepods/pod/nginx/memory.stat", content: "inactive_file 20\nactive_file 10\n"},
+			},
+			want: &CgroupMemory{
+				Limit: 1000, Usage: 600, InactiveFile: 200, ActiveFile: 100,
+				LimitPath: "kubepods/pod", LimitSource: v2LimitFile,
+			},
+		},
+		{
+			name:       "V2ContainerLimit",
+			mode:       cgroups.Unified,
+			cgroupPath: "/kubepods/pod/nginx",
+			files: []file{
+				{path: "kubepods/pod/memory.max", content: "1000\n"},
+				{path: "kubepods/pod/nginx/memory.max", content: "1000\n"},
+				{path: "kubepods/pod/nginx/memory.current", content: "500\n"},
+				{path: "kubepods/pod/nginx/memory.stat", content: "inactive_file 20\nactive_file 10\n"},
+			},
+			want: &CgroupMemory{
+				Limit: 1000, Usage: 500, InactiveFile: 20, ActiveFile: 10,
+				LimitPath: "kubepods/pod/nginx", LimitSource: v2LimitFile,
+			},
+		},
+		{
+			name:       "V2AncestorError",
+			mode:       cgroups.Unified,
+			cgroupPath: "/kubepods/pod/nginx",
+			files: []file{
+				{path: "kubepods/pod/memory.max", content: "X\n"},
+				{path: "kubepods/pod/nginx/memory.max", content: "max\n"},
+				{path: "kubepods/pod/nginx/memory.current", content: "500\n"},
+				{path: "kubepods/pod/nginx/memory.stat", content: ""},
+			},
+			wantErr: true,
+		},
+		{
+			name:       "V1HierarchicalLimit",
+			mode:       cgroups.Legacy,
+			cgroupPath: "/",
+			files: []file{
+				{path: "memory/memory.limit_in_bytes", content: "9223372036854771712\n"},
+				{path: "memory/memory.usage_in_bytes", content: "500\n"},
+				{path: "memory/memory.stat", content: "hierarchical_memory_limit 1000\ntotal_inactive_file 20\n"},
+			},
+			want: &CgroupMemory{Limit: 1000, Usage: 500, InactiveFile: 20, LimitPath: "memory", LimitSource: v1StatLimit},
+		},
+		{
+			name:       "V1VisibleAncestorLimit",
+			mode:       cgroups.Legacy,
+			cgroupPath: "/kubepods/pod/nginx",
+			files: []file{
+				{path: "memory/kubepods/pod/memory.limit_in_bytes", content: "1000\n"},
+				{path: "memory/kubepods/pod/memory.usage_in_bytes", content: "600\n"},
+				{path: "memory/kubepods/pod/memory.stat", content: "total_inactive_file 200\n"},
+				{path: "memory/kubepods/pod/nginx/memory.limit_in_bytes", content: "9223372036854771712\n"},
+				{path: "memory/kubepods/pod/nginx/memory.usage_in_bytes", content: "500\n"},
+				{path: "memory/kubepods/pod/nginx/memory.stat", content: "hierarchical_memory_limit 1000\n"},
+			},
+			want: &CgroupMemory{
+				Limit: 1000, Usage: 600, InactiveFile: 200, LimitPath: "memory/kubepods/pod", LimitSource: v1LimitFile,
+			},
+		},
+		{
+			// The ancestor setting the limit is above the visible pod cgroup, e.g. a cgroup of the node allocatable.
+			name:       "V1InvisibleAncestorLimit",
+			mode:       cgroups.Legacy,
+			cgroupPath: "/kubepods/pod/nginx",
+			files: []file{
+				{path: "memory/kubepods/pod/memory.limit_in_bytes", content: "2000\n"},
+				{path: "memory/kubepods/pod/memory.usage_in_bytes", content: "1500\n"},
+				{path: "memory/kubepods/pod/memory.stat", content: "total_inactive_file 200\n"},
+				{path: "memory/kubepods/pod/nginx/memory.limit_in_bytes", content: "9223372036854771712\n"},
+				{path: "memory/kubepods/pod/nginx/memory.usage_in_bytes", content: "500\n"},
+				{
+					path:    "memory/kubepods/pod/nginx/memory.stat",
+					content: "hierarchical_memory_limit 1000\ntotal_inactive_file 20\n",
+				},
+			},
+			want: &CgroupMemory{
+				Limit: 1000, Usage: 500, InactiveFile: 20, LimitPath: "memory/kubepods/pod/nginx", LimitSource: v1StatLimit,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mockCgroupsMode MockCgroupsMode
+			mockCgroupsMode.On("Call").Return(tt.mode)
+			cgroupsMode = mockCgroupsMode.Call
+			defer func() { cgroupsMode = cgroups.Mode }()
+
+			var mockCgroup2PidGroupPath MockCgroup2PidGroupPath
+			mockCgroup2PidGroupPath.On("Call").Return(tt.cgroupPath, nil)
+			cgroup2PidGroupPath = mockCgroup2PidGroupPath.Call
+			defer func() { cgroup2PidGroupPath = cgroup2.PidGroupPath }()
+
+			var mockCgroup1PidPath MockCgroup1PidPath
+			mockCgroup1PidPath.On("Call").Return(tt.cgroupPath, nil)
+			cgroup1PidPath = mockCgroup1PidPath.Call
+			defer func() { cgroup1PidPath = cgroup1.PidPath }()
+
+			tempDir := t.TempDir()
+			t.Setenv(envCgroupMountPoint, tempDir)
+			for _, f := range tt.files {
+				writeFile(t, path.Join(tempDir, f.path), f.content)
+			}
+
+			got, err := ReadCgroupMemory(os.Getpid())
+			if tt.wantErr {
+				log.Error(err)
+				assert.Nil(t, got)
+				assert.Error(t, err)
+			} else {
+				tt.want.LimitPath = path.Join(tempDir, tt.want.LimitPath)
+				assert.Equal(t, tt.want, got)
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCgroupMemory_Available(t *testing.T) {
+	tests := []struct {
+		name        string
+		memory      CgroupMemory
+		calculation MemoryCalculation
+		want        uint64
+	}{
+		{
+			name:        "Usage",
+			memory:      CgroupMemory{Limit: 1000, Usage: 800, InactiveFile: 300, ActiveFile: 200},
+			calculation: MemoryUsage,
+			want:        200,
+		},
+		{
+			name:        "WorkingSet",
+			memory:      CgroupMemory{Limit: 1000, Usage: 800, InactiveFile: 300, ActiveFile: 200},
+			calculation: MemoryWorkingSet,
+			want:        500,
+		},
+		{
+			name:        "NoFile",
+			memory:      CgroupMemory{Limit: 1000, Usage: 800, InactiveFile: 300, ActiveFile: 200},
+			calculation: MemoryNoFile,
+			want:        700,
+		},
+		{
+			name:        "UsageExceedsLimit",
+			memory:      CgroupMemory{Limit: 1000, Usage: 1200},
+			calculation: MemoryUsage,
+		},
+		{
+			name:        "FileExceedsUsage",
+			memory:      CgroupMemory{Limit: 1000, Usage: 100, InactiveFile: 300, ActiveFile: 200},
+			calculation: MemoryNoFile,
+			want:        1000,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.memory.Available(tt.calculation))
+		})
+	}
+}
+
+func TestCgroupMemory_String(t *testing.T) {
+	c := &CgroupMemory{
+		Limit: 4, Usage: 3, InactiveFile: 2, ActiveFile: 1, LimitPath: "/sys/fs/cgroup/pod", LimitSource: "memory.max",
+	}
+	assert.Equal(t, `{"limit":4,"usage":3,"inactive_file":2,"active_file":1,"limit_path":"/sys/fs/cgroup/pod",`+
+		`"limit_source":"memory.max"}`, c.String())
+}
+
+func TestParseMemoryCalculation(t *testing.T) {
+	tests := []struct {
+		name        string
+		calculation string
+		want        MemoryCalculation
+		wantErr     bool
+	}{
+		{
+			name:        "Empty",
+			calculation: "",
+			wantErr:     true,
+		},
+		{
+			name:        "Invalid",
+			calculation: "rss",
+			wantErr:     true,
+		},
+		{
+			name:        "Usage",
+			calculation: "usage",
+			want:        MemoryUsage,
+		},
+		{
+			name:        "WorkingSet",
+			calculation: "Working-Set",
+			want:        MemoryWorkingSet,
+		},
+		{
+			name:        "NoFile",
+			calculation: "no-file",
+			want:        MemoryNoFile,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMemoryCalculation(tt.calculation)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMemoryCalculation_String(t *testing.T) {
+	assert.Equal(t, "usage", MemoryUsage.String())
+	assert.Equal(t, "working-set", MemoryWorkingSet.String())
+	assert.Equal(t, "no-file", MemoryNoFile.String())
+	assert.Equal(t, "MemoryCalculation(42)", MemoryCalculation(42).String())
+}
+
+func TestReadMemoryPressure(t *testing.T) {
+	const cgroupPressure = "some avg10=12.50 avg60=4.00 avg300=1.00 total=100\n" +
+		"full avg10=6.25 avg60=2.00 avg300=0.50 total=50\n"
+	const systemPressure = "some avg10=1.00 avg60=2.00 avg300=3.00 total=4\n" +
+		"full avg10=5.00 avg60=6.00 avg300=7.00 total=8\n"
+
+	tests := []struct {
+		name     string
+		mode     cgroups.CGMode
+		cgroup   string
+		system   string
+		want     *MemoryPressure
+		wantErr  bool
+		pathFail bool
+	}{
+		{
+			name:   "CgroupV2",
+			mode:   cgroups.Unified,
+			cgroup: cgroupPressure,
+			system: systemPressure,
+			want:   &MemoryPressure{SomeAvg10: 12.5, SomeAvg60: 4, FullAvg10: 6.25, FullAvg60: 2},
+		},
+		{
+			name:   "NoCgroupPressure",
+			mode:   cgroups.Unified,
+			system: systemPressure,
+			want:   &MemoryPressure{SomeAvg10: 1, SomeAvg60: 2, FullAvg10: 5, FullAvg60: 6},
+		},
+		{
+			name:     "CgroupPathError",
+			mode:     cgroups.Unified,
+			cgroup:   cgroupPressure,
+			system:   systemPressure,
+			want:     &MemoryPressure{SomeAvg10: 1, SomeAvg60: 2, FullAvg10: 5, FullAvg60: 6},
+			pathFail: true,
+		},
+		{
+			name:   "CgroupV1",
+			mode:   cgroups.Legacy,
+			system: systemPressure,
+			want:   &MemoryPressure{SomeAvg10: 1, SomeAvg60: 2, FullAvg10: 5, FullAvg60: 6},
+		},
+		{
+			name:    "NoPressure",
+			mode:    cgroups.Legacy,
+			wantErr: true,
+		},
+		{
+			name:    "InvalidLine",
+			mode:    cgroups.Legacy,
+			system:  "partial avg10=1.00\n",
+			wantErr: true,
+		},
+		{
+			name:    "InvalidValue",
+			mode:    cgroups.Legacy,
+			system:  "some avg10=X avg60=2.00 avg300=3.00 total=4\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mockCgroupsMode MockCgroupsMode
+			mockCgroupsMode.On("Call").Return(tt.mode)
+			cgroupsMode = mockCgroupsMode.Call
+			defer func() { cgroupsMode = cgroups.Mode }()
+
+			cgroupPath := "/"
+			var mockCgroup2PidGroupPath MockCgroup2PidGroupPath
+			if tt.pathFail {
+				mockCgroup2PidGroupPath.On("Call").Return("", errors.New(tt.name))
+			} else {
+				mockCgroup2PidGroupPath.On("Call").Return(cgroupPath, nil)
+			}
+			cgroup2PidGroupPath = mockCgroup2PidGroupPath.Call
+			defer func() { cgroup2PidGroupPath = cgroup2.PidGroupPath }()
+
+			cgroupDir := t.TempDir()
+			t.Setenv(envCgroupMountPoint, cgroupDir)
+			if tt.cgroup != "" {
+				writeFile(t, path.Join(cgroupDir, cgroupPath, v2PressureFile), tt.cgroup)
+			}
+			procDir := t.TempDir()
+			t.Setenv(envProcMountPoint, procDir)
+			if tt.system != "" {
+				writeFile(t, path.Join(procDir, "pressure", "memory"), tt.system)
+			}
+
+			got, err := ReadMemoryPressure(os.Getpid())
+			if tt.wantErr {
+				log.Error(err)
+				assert.Nil(t, got)
+				assert.Error(t, err)
+			} else {
+				assert.Equal(t, tt.want, got)
 				assert.NoError(t, err)
 			}
 		})
 	}
 }
 
+func TestMemoryPressure_String(t *testing.T) {
+	p := &MemoryPressure{SomeAvg10: 12.5, SomeAvg60: 4, FullAvg10: 6.25, FullAvg60: 2}
+	assert.Equal(t, `{"some_avg10":12.5,"some_avg60":4,"full_avg10":6.25,"full_avg60":2}`, p.String())
+}
+
 func Test_readCgroupFile(t *testing.T) {
 	value := rand.Uint64()
 
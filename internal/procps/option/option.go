@@ -1,25 +1,154 @@
 package option
 
 import (
-	"github.com/shirou/gopsutil/v3/process"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 )
 
+var timeNow = time.Now
+
+// Process is the process information that options match against, read once by the procps Snapshot.
+// Methods returning an error read /proc on first use, so that only the processes matched so far pay for them.
+type Process interface {
+	Cmdline() string                // Cmdline returns the command line arguments joined by spaces.
+	Ppid() int32                    // Ppid returns the pid of the parent process.
+	Name() string                   // Name returns the name of the process executable.
+	State() string                  // State returns the state of the process, e.g. "R", "S" or "Z".
+	CreateTime() int64              // CreateTime returns the creation time in milliseconds since the epoch.
+	RSS() uint64                    // RSS returns the resident set size in bytes.
+	Exe() (string, error)           // Exe returns the path of the process executable.
+	UID() (uint32, error)           // UID returns the effective user ID.
+	GID() (uint32, error)           // GID returns the effective group ID.
+	CgroupPaths() ([]string, error) // CgroupPaths returns the cgroup paths of all hierarchies.
+	NSPid() (int32, error)          // NSPid returns the pid in the innermost pid namespace.
+}
+
 // Option is a function type that matches a process based on specific criteria.
-type Option func(*process.Process) bool
+type Option func(Process) bool
+
+// And returns an Option that matches a process that matches all the specified options.
+func And(options ...Option) Option {
+	return func(proc Process) bool {
+		for _, match := range options {
+			if !match(proc) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or returns an Option that matches a process that matches any of the specified options.
+func Or(options ...Option) Option {
+	return func(proc Process) bool {
+		for _, match := range options {
+			if match(proc) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not returns an Option that matches a process that does not match the specified option.
+func Not(option Option) Option {
+	return func(proc Process) bool {
+		return !option(proc)
+	}
+}
 
 // Cmdline returns an Option that matches a process whose command-line contains the specified name.
 func Cmdline(name string) Option {
-	return func(proc *process.Process) bool {
-		cmdline, err := proc.Cmdline()
-		return err == nil && strings.Contains(cmdline, name)
+	return func(proc Process) bool {
+		return strings.Contains(proc.Cmdline(), name)
+	}
+}
+
+// CmdlineRegexp returns an Option that matches a process whose command-line matches the regular expression.
+func CmdlineRegexp(re *regexp.Regexp) Option {
+	return func(proc Process) bool {
+		return re.MatchString(proc.Cmdline())
+	}
+}
+
+// Name returns an Option that matches a process whose executable name equals the specified name.
+// Note that the kernel truncates the name to 15 characters.
+func Name(name string) Option {
+	return func(proc Process) bool {
+		return proc.Name() == name
+	}
+}
+
+// Exe returns an Option that matches a process whose executable path equals the specified path.
+// The executable of a process started before its binary was replaced, e.g. by a package upgrade, still matches.
+func Exe(path string) Option {
+	return func(proc Process) bool {
+		exe, err := proc.Exe()
+		return err == nil && strings.TrimSuffix(exe, " (deleted)") == path
+	}
+}
+
+// UID returns an Option that matches a process whose effective user ID equals the specified value.
+func UID(uid uint32) Option {
+	return func(proc Process) bool {
+		id, err := proc.UID()
+		return err == nil && id == uid
+	}
+}
+
+// GID returns an Option that matches a process whose effective group ID equals the specified value.
+func GID(gid uint32) Option {
+	return func(proc Process) bool {
+		id, err := proc.GID()
+		return err == nil && id == gid
+	}
+}
+
+// State returns an Option that matches a process in any of the specified states, e.g. "R", "S" or "Z".
+func State(states ...string) Option {
+	return func(proc Process) bool {
+		return slices.Contains(states, proc.State())
+	}
+}
+
+// CgroupPath returns an Option that matches a process with any cgroup path starting with the specified prefix.
+func CgroupPath(prefix string) Option {
+	return func(proc Process) bool {
+		paths, err := proc.CgroupPaths()
+		return err == nil && slices.ContainsFunc(paths, func(path string) bool {
+			return strings.HasPrefix(path, prefix)
+		})
+	}
+}
+
+// OlderThan returns an Option that matches a process created longer than the specified duration ago.
+func OlderThan(age time.Duration) Option {
+	return func(proc Process) bool {
+		return timeNow().Sub(time.UnixMilli(proc.CreateTime())) > age
+	}
+}
+
+// RSSAbove returns an Option that matches a process whose resident set size exceeds the specified bytes.
+func RSSAbove(bytes uint64) Option {
+	return func(proc Process) bool {
+		return proc.RSS() > bytes
+	}
+}
+
+// NSPid returns an Option that matches a process whose pid in its innermost pid namespace equals the specified
+// value, e.g. 1 for the first process of a container.
+func NSPid(pid int32) Option {
+	return func(proc Process) bool {
+		nspid, err := proc.NSPid()
+		return err == nil && nspid == pid
 	}
 }
 
 // Parent returns an Option that matches a process whose parent's PID matches the specified value.
 func Parent(ppid int32) Option {
-	return func(proc *process.Process) bool {
-		parent, err := proc.Parent()
-		return err == nil && parent.Pid == ppid
+	return func(proc Process) bool {
+		return proc.Ppid() == ppid
 	}
 }
@@ -1,23 +1,66 @@
 package option
 
 import (
-	"github.com/shirou/gopsutil/v3/process"
+	"errors"
 	"github.com/stretchr/testify/assert"
 
-	"os"
+	"regexp"
 	"testing"
+	"time"
 )
 
+type fakeProcess struct {
+	cmdline    string
+	ppid       int32
+	name       string
+	state      string
+	createTime int64
+	rss        uint64
+	exe        string
+	uid        uint32
+	gid        uint32
+	cgroups    []string
+	nspid      int32
+	err        error // Error of the methods reading /proc on first use.
+}
+
+func (p *fakeProcess) Cmdline() string                { return p.cmdline }
+func (p *fakeProcess) Ppid() int32                    { return p.ppid }
+func (p *fakeProcess) Name() string                   { return p.name }
+func (p *fakeProcess) State() string                  { return p.state }
+func (p *fakeProcess) CreateTime() int64              { return p.createTime }
+func (p *fakeProcess) RSS() uint64                    { return p.rss }
+func (p *fakeProcess) Exe() (string, error)           { return p.exe, p.err }
+func (p *fakeProcess) UID() (uint32, error)           { return p.uid, p.err }
+func (p *fakeProcess) GID() (uint32, error)           { return p.gid, p.err }
+func (p *fakeProcess) CgroupPaths() ([]string, error) { return p.cgroups, p.err }
+func (p *fakeProcess) NSPid() (int32, error)          { return p.nspid, p.err }
+
 var (
-	pid1Proc       = &process.Process{Pid: 1}
-	pid1Cmdline, _ = pid1Proc.Cmdline()
-	currentProc    = &process.Process{Pid: int32(os.Getpid())}
-	parentProc, _  = currentProc.Parent()
+	pid1Proc    = &fakeProcess{cmdline: "/sbin/init splash", ppid: 0}
+	currentProc = &fakeProcess{cmdline: "/tmp/option.test -test.v", ppid: 42}
+	parentProc  = &fakeProcess{cmdline: "go test", ppid: 1}
+	workerProc  = &fakeProcess{
+		cmdline:    "nginx: worker process is shutting down",
+		ppid:       7,
+		name:       "nginx",
+		state:      "S",
+		createTime: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli(),
+		rss:        64 << 20,
+		exe:        "/usr/sbin/nginx",
+		uid:        101,
+		gid:        102,
+		cgroups:    []string{"/kubepods/burstable/pod1234/nginx"},
+		nspid:      21,
+	}
+	tailProc  = &fakeProcess{cmdline: "tail -f nginx: worker process", name: "tail", err: errors.New("no proc")}
+	matchAll  = func(Process) bool { return true }
+	matchNone = func(Process) bool { return false }
 )
 
 type args struct {
 	option Option
-	proc   *process.Process
+	proc   Process
 }
 
 func TestCmdline(t *testing.T) {
@@ -29,7 +72,7 @@ func TestCmdline(t *testing.T) {
 		{
 			name: "MatchCmdline",
 			args: args{
-				option: Cmdline(pid1Cmdline),
+				option: Cmdline(pid1Proc.cmdline),
 				proc:   pid1Proc,
 			},
 			want: true,
@@ -37,7 +80,7 @@ func TestCmdline(t *testing.T) {
 		{
 			name: "MatchPartial",
 			args: args{
-				option: Cmdline(pid1Cmdline[1 : len(pid1Cmdline)-1]),
+				option: Cmdline(pid1Proc.cmdline[1 : len(pid1Proc.cmdline)-1]),
 				proc:   pid1Proc,
 			},
 			want: true,
@@ -45,7 +88,7 @@ func TestCmdline(t *testing.T) {
 		{
 			name: "NotMatchCmdline",
 			args: args{
-				option: Cmdline(pid1Cmdline),
+				option: Cmdline(pid1Proc.cmdline),
 				proc:   currentProc,
 			},
 			want: false,
@@ -68,7 +111,7 @@ func TestParent(t *testing.T) {
 		{
 			name: "MatchParent",
 			args: args{
-				option: Parent(parentProc.Pid),
+				option: Parent(42),
 				proc:   currentProc,
 			},
 			want: true,
@@ -76,7 +119,7 @@ func TestParent(t *testing.T) {
 		{
 			name: "NotMatchParent",
 			args: args{
-				option: Parent(currentProc.Pid),
+				option: Parent(42),
 				proc:   parentProc,
 			},
 			want: false,
@@ -89,3 +132,73 @@ func TestParent(t *testing.T) {
 		})
 	}
 }
+
+func TestCombinators(t *testing.T) {
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{name: "AndEmpty", args: args{option: And(), proc: workerProc}, want: true},
+		{name: "AndAll", args: args{option: And(matchAll, matchAll), proc: workerProc}, want: true},
+		{name: "AndAny", args: args{option: And(matchAll, matchNone), proc: workerProc}, want: false},
+		{name: "OrEmpty", args: args{option: Or(), proc: workerProc}, want: false},
+		{name: "OrAny", args: args{option: Or(matchNone, matchAll), proc: workerProc}, want: true},
+		{name: "OrNone", args: args{option: Or(matchNone, matchNone), proc: workerProc}, want: false},
+		{name: "NotMatch", args: args{option: Not(matchNone), proc: workerProc}, want: true},
+		{name: "NotNotMatch", args: args{option: Not(matchAll), proc: workerProc}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.args.option(tt.args.proc)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatchers(t *testing.T) {
+	timeNow = func() time.Time { return time.Date(2025, 1, 1, 1, 0, 0, 0, time.UTC) }
+	defer func() { timeNow = time.Now }()
+
+	deleted := *workerProc
+	deleted.exe = "/usr/sbin/nginx (deleted)"
+
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{name: "CmdlineRegexp", args: args{option: CmdlineRegexp(regexp.MustCompile(`^nginx: worker`)), proc: workerProc}, want: true},
+		{name: "NotCmdlineRegexp", args: args{option: CmdlineRegexp(regexp.MustCompile(`^nginx: worker`)), proc: tailProc}, want: false},
+		{name: "Name", args: args{option: Name("nginx"), proc: workerProc}, want: true},
+		{name: "NotName", args: args{option: Name("nginx"), proc: tailProc}, want: false},
+		{name: "Exe", args: args{option: Exe("/usr/sbin/nginx"), proc: workerProc}, want: true},
+		{name: "ExeDeleted", args: args{option: Exe("/usr/sbin/nginx"), proc: &deleted}, want: true},
+		{name: "NotExe", args: args{option: Exe("/usr/local/sbin/nginx"), proc: workerProc}, want: false},
+		{name: "ExeError", args: args{option: Exe(""), proc: tailProc}, want: false},
+		{name: "UID", args: args{option: UID(101), proc: workerProc}, want: true},
+		{name: "NotUID", args: args{option: UID(0), proc: workerProc}, want: false},
+		{name: "UIDError", args: args{option: UID(0), proc: tailProc}, want: false},
+		{name: "GID", args: args{option: GID(102), proc: workerProc}, want: true},
+		{name: "NotGID", args: args{option: GID(101), proc: workerProc}, want: false},
+		{name: "GIDError", args: args{option: GID(0), proc: tailProc}, want: false},
+		{name: "State", args: args{option: State("R", "S"), proc: workerProc}, want: true},
+		{name: "NotState", args: args{option: State("Z"), proc: workerProc}, want: false},
+		{name: "CgroupPath", args: args{option: CgroupPath("/kubepods/burstable/pod1234"), proc: workerProc}, want: true},
+		{name: "NotCgroupPath", args: args{option: CgroupPath("/kubepods/besteffort"), proc: workerProc}, want: false},
+		{name: "CgroupPathError", args: args{option: CgroupPath(""), proc: tailProc}, want: false},
+		{name: "OlderThan", args: args{option: OlderThan(30 * time.Minute), proc: workerProc}, want: true},
+		{name: "NotOlderThan", args: args{option: OlderThan(time.Hour), proc: workerProc}, want: false},
+		{name: "RSSAbove", args: args{option: RSSAbove(32 << 20), proc: workerProc}, want: true},
+		{name: "NotRSSAbove", args: args{option: RSSAbove(64 << 20), proc: workerProc}, want: false},
+		{name: "NSPid", args: args{option: NSPid(21), proc: workerProc}, want: true},
+		{name: "NotNSPid", args: args{option: NSPid(1), proc: workerProc}, want: false},
+		{name: "NSPidError", args: args{option: NSPid(0), proc: tailProc}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.args.option(tt.args.proc)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
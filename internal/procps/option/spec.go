@@ -0,0 +1,174 @@
+package option
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"nginx-reaper/internal/env"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Spec is an Option composed from a JSON specification, see ParseSpec.
+type Spec struct {
+	Option // Option matches a process against all conditions of the specification.
+	text   string
+}
+
+// specParsers maps each key of a JSON specification to the parser of its value.
+var specParsers map[string]func(json.RawMessage) (Option, error)
+
+func init() {
+	specParsers = map[string]func(json.RawMessage) (Option, error){
+		"cmdline":        specOf(Cmdline),
+		"cmdline_regexp": specParse(specRegexp),
+		"name":           specOf(Name),
+		"exe":            specOf(Exe),
+		"uid":            specOf(UID),
+		"gid":            specOf(GID),
+		"state":          specOf(func(states []string) Option { return State(states...) }),
+		"cgroup":         specOf(CgroupPath),
+		"older_than":     specParse(specOlderThan),
+		"rss_above":      specParse(specRSSAbove),
+		"nspid":          specOf(NSPid),
+		"parent":         specOf(Parent),
+		"and":            specParse(func(specs []json.RawMessage) (Option, error) { return specList(specs, And) }),
+		"or":             specParse(func(specs []json.RawMessage) (Option, error) { return specList(specs, Or) }),
+		"not":            specParse(specNot),
+	}
+}
+
+// ParseSpec parses a JSON specification of process options. Returns error if invalid.
+// The specification is an object, and the process must match all of its keys:
+//
+//	cmdline         command line contains the string
+//	cmdline_regexp  command line matches the regular expression
+//	name            executable name equals the string
+//	exe             executable path equals the string
+//	uid, gid        effective user or group ID equals the number
+//	state           state is any of the list, e.g. ["R", "S"]
+//	cgroup          any cgroup path starts with the string
+//	older_than      created longer ago than the duration, e.g. "10m"
+//	rss_above       resident set size exceeds the quantity, e.g. "512Mi"
+//	nspid           pid in the innermost pid namespace equals the number
+//	parent          parent pid equals the number
+//	and, or         list of specifications that all or any must match
+//	not             specification that must not match
+//
+// For example, {"name": "nginx", "not": {"cmdline": "tail"}}. An empty string or object matches any process.
+func ParseSpec(text string) (*Spec, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return &Spec{Option: And(), text: "{}"}, nil
+	}
+	option, err := parseSpec(json.RawMessage(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid process spec %s: %w", text, err)
+	}
+	var compact bytes.Buffer
+	_ = json.Compact(&compact, []byte(text))
+	return &Spec{Option: option, text: compact.String()}, nil
+}
+
+// String returns the compact JSON specification.
+func (s *Spec) String() string {
+	return s.text
+}
+
+// parseSpec parses a JSON object of conditions, combined with And in the order of the sorted keys.
+func parseSpec(data json.RawMessage) (Option, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("expected an object, got %s", data)
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	options := make([]Option, 0, len(keys))
+	for _, key := range keys {
+		parser, ok := specParsers[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+		option, err := parser(fields[key])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		options = append(options, option)
+	}
+	return And(options...), nil
+}
+
+// specOf returns a parser that unmarshals the JSON value and creates the Option with the constructor.
+func specOf[T any](constructor func(T) Option) func(json.RawMessage) (Option, error) {
+	return specParse(func(value T) (Option, error) { return constructor(value), nil })
+}
+
+// specParse returns a parser that unmarshals the JSON value and creates the Option with the constructor,
+// which validates the value.
+func specParse[T any](constructor func(T) (Option, error)) func(json.RawMessage) (Option, error) {
+	return func(data json.RawMessage) (Option, error) {
+		var value T
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		return constructor(value)
+	}
+}
+
+// specRegexp creates a CmdlineRegexp Option of the regular expression.
+func specRegexp(expr string) (Option, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return CmdlineRegexp(re), nil
+}
+
+// specOlderThan creates an OlderThan Option of the duration, e.g. "10m".
+func specOlderThan(value string) (Option, error) {
+	age, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, err
+	}
+	return OlderThan(age), nil
+}
+
+// specRSSAbove creates an RSSAbove Option of the quantity, e.g. "512Mi".
+func specRSSAbove(value string) (Option, error) {
+	rss, err := env.ParseBytes(value)
+	if err != nil {
+		return nil, err
+	}
+	return RSSAbove(rss), nil
+}
+
+// specNot creates a Not Option of the specification.
+func specNot(spec json.RawMessage) (Option, error) {
+	option, err := parseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	return Not(option), nil
+}
+
+// specList creates an Option combining the list of specifications, e.g. with And or Or.
+func specList(specs []json.RawMessage, combine func(...Option) Option) (Option, error) {
+	options := make([]Option, 0, len(specs))
+	for _, spec := range specs {
+		option, err := parseSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, option)
+	}
+	return combine(options...), nil
+}
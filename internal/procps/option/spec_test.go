@@ -0,0 +1,89 @@
+package option
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/log"
+	"testing"
+	"time"
+)
+
+func TestParseSpec(t *testing.T) {
+	timeNow = func() time.Time { return time.Date(2025, 1, 1, 1, 0, 0, 0, time.UTC) }
+	defer func() { timeNow = time.Now }()
+
+	tests := []struct {
+		name     string
+		spec     string
+		want     string
+		matches  []Process
+		excludes []Process
+		wantErr  bool
+	}{
+		{
+			name:    "Empty",
+			spec:    " ",
+			want:    "{}",
+			matches: []Process{workerProc, tailProc},
+		},
+		{
+			name:    "EmptyObject",
+			spec:    "{}",
+			want:    "{}",
+			matches: []Process{workerProc, tailProc},
+		},
+		{
+			name:     "NameNotCmdline",
+			spec:     `{"name": "nginx", "not": {"cmdline": "tail"}}`,
+			want:     `{"name":"nginx","not":{"cmdline":"tail"}}`,
+			matches:  []Process{workerProc},
+			excludes: []Process{tailProc, currentProc},
+		},
+		{
+			name: "AllKeys",
+			spec: `{"cmdline": "worker", "cmdline_regexp": "^nginx: ", "name": "nginx", "exe": "/usr/sbin/nginx",
+				"uid": 101, "gid": 102, "state": ["S", "R"], "cgroup": "/kubepods/", "older_than": "10m",
+				"rss_above": "32Mi", "nspid": 21, "parent": 7}`,
+			want: `{"cmdline":"worker","cmdline_regexp":"^nginx: ","name":"nginx","exe":"/usr/sbin/nginx",` +
+				`"uid":101,"gid":102,"state":["S","R"],"cgroup":"/kubepods/","older_than":"10m",` +
+				`"rss_above":"32Mi","nspid":21,"parent":7}`,
+			matches:  []Process{workerProc},
+			excludes: []Process{tailProc, pid1Proc},
+		},
+		{
+			name:     "OrAnd",
+			spec:     `{"or": [{"and": [{"name": "tail"}, {"cmdline": "nginx"}]}, {"parent": 42}]}`,
+			want:     `{"or":[{"and":[{"name":"tail"},{"cmdline":"nginx"}]},{"parent":42}]}`,
+			matches:  []Process{tailProc, currentProc},
+			excludes: []Process{workerProc, pid1Proc},
+		},
+		{name: "InvalidJSON", spec: `{"name": `, wantErr: true},
+		{name: "NotObject", spec: `["nginx"]`, wantErr: true},
+		{name: "Null", spec: `null`, wantErr: true},
+		{name: "UnknownKey", spec: `{"pid": 1}`, wantErr: true},
+		{name: "InvalidType", spec: `{"uid": "root"}`, wantErr: true},
+		{name: "InvalidRegexp", spec: `{"cmdline_regexp": "("}`, wantErr: true},
+		{name: "InvalidDuration", spec: `{"older_than": "10"}`, wantErr: true},
+		{name: "InvalidQuantity", spec: `{"rss_above": "1X"}`, wantErr: true},
+		{name: "InvalidNot", spec: `{"not": "nginx"}`, wantErr: true},
+		{name: "InvalidOr", spec: `{"or": [{"name": 1}]}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSpec(tt.spec)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Nil(t, got)
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.String())
+			for _, proc := range tt.matches {
+				assert.True(t, got.Option(proc), "%+v", proc)
+			}
+			for _, proc := range tt.excludes {
+				assert.False(t, got.Option(proc), "%+v", proc)
+			}
+		})
+	}
+}
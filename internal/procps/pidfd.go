@@ -0,0 +1,94 @@
+package procps
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"nginx-reaper/internal/log"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	unixPidfdOpen = unix.PidfdOpen
+	pidfdFallback sync.Once // Warns once that pidfds cannot be opened.
+)
+
+// openPidfd opens a pidfd of the process, so that signals and exit notifications refer to the process
+// even if its pid is reused. The start time is checked after opening, since the pid could have been reused
+// between reading the process and opening the pidfd.
+// If the pidfd cannot be opened, e.g. on kernels before 5.3 (ENOSYS), under a seccomp profile denying pidfd_open
+// (EPERM or EACCES), or without free file descriptors (EMFILE), the pidfd is not opened and signals fall back to
+// the start time check. Returns os.ErrProcessDone if the process exited or its pid was reused.
+func (p *Process) openPidfd() error {
+	if p.pidfd != nil {
+		return nil
+	}
+	fd, err := unixPidfdOpen(int(p.Pid), 0)
+	if errors.Is(err, unix.ESRCH) {
+		return os.ErrProcessDone
+	}
+	if err != nil {
+		if !errors.Is(err, unix.ENOSYS) {
+			pidfdFallback.Do(func() {
+				log.Warningf("Failed to open pidfd of process %d, checking start times instead: %v", p.Pid, err)
+			})
+		}
+		if !sameStartTime(p) {
+			return os.ErrProcessDone
+		}
+		return nil
+	}
+	pidfd := os.NewFile(uintptr(fd), "pidfd:"+strconv.Itoa(int(p.Pid)))
+	if !sameStartTime(p) {
+		_ = pidfd.Close()
+		return os.ErrProcessDone
+	}
+	p.pidfd = pidfd
+	return nil
+}
+
+// closePidfd closes the pidfd of the process, if opened.
+func (p *Process) closePidfd() error {
+	if p.pidfd == nil {
+		return nil
+	}
+	err := p.pidfd.Close()
+	p.pidfd = nil
+	return err
+}
+
+// pidfdSignal sends the signal to the process through its pidfd.
+func pidfdSignal(pidfd *os.File, sig syscall.Signal) error {
+	return unix.PidfdSendSignal(int(pidfd.Fd()), sig, nil, 0)
+}
+
+// pidfdWait waits until the pidfd becomes readable, i.e. the process exited, or the timeout expires.
+// Returns a bool indicating whether the process exited.
+func pidfdWait(pidfd *os.File, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	fds := []unix.PollFd{{Fd: int32(pidfd.Fd()), Events: unix.POLLIN}}
+	for {
+		// Round the remaining time up to milliseconds, so that poll does not return before the deadline.
+		remaining := max(time.Until(deadline), 0)
+		n, err := unix.Poll(fds, int((remaining+time.Millisecond-1)/time.Millisecond))
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			log.Errorf("Failed to poll %s: %v", pidfd.Name(), err)
+			return false
+		}
+		if n > 0 || remaining == 0 {
+			return n > 0
+		}
+	}
+}
+
+// sameStartTime returns a bool indicating whether the process with the pid has the start time of the snapshot.
+func sameStartTime(proc *Process) bool {
+	stat, err := readProcStat(proc.Pid)
+	return err == nil && stat.Starttime == proc.startTime
+}
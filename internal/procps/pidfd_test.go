@@ -0,0 +1,111 @@
+package procps
+
+import (
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startSleep starts a child process and returns the snapshot process of it.
+func startSleep(t *testing.T) (*exec.Cmd, *Process) {
+	cmd := exec.Command("sleep", "100")
+	assert.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	return cmd, mustNewProcess(t, cmd.Process.Pid)
+}
+
+func TestSnapshot_Pgrep(t *testing.T) {
+	_, proc := startSleep(t)
+
+	t.Run("OpenPidfd", func(t *testing.T) {
+		snapshot := &Snapshot{procs: []*Process{proc}}
+		got := snapshot.Pgrep(pidIs(proc.Pid))
+		assert.Equal(t, []*Process{proc}, got)
+		assert.NotNil(t, proc.pidfd)
+
+		assert.NoError(t, snapshot.Close())
+		assert.Nil(t, proc.pidfd)
+	})
+	t.Run("PidReused", func(t *testing.T) {
+		reused := &Process{Pid: proc.Pid, startTime: proc.startTime + 1}
+		snapshot := &Snapshot{procs: []*Process{reused}}
+		assert.Empty(t, snapshot.Pgrep(pidIs(proc.Pid)))
+		assert.Nil(t, reused.pidfd)
+	})
+	t.Run("NoProc", func(t *testing.T) {
+		snapshot := &Snapshot{procs: []*Process{exitedProcess(t)}}
+		assert.Empty(t, snapshot.Pgrep())
+	})
+	for _, errno := range []unix.Errno{unix.ENOSYS, unix.EPERM, unix.EACCES, unix.EMFILE} {
+		// Without a pidfd, the start time is checked instead.
+		t.Run("Fallback"+unix.ErrnoName(errno), func(t *testing.T) {
+			unixPidfdOpen = func(int, int) (int, error) { return -1, errno }
+			defer func() { unixPidfdOpen = unix.PidfdOpen }()
+
+			snapshot := &Snapshot{procs: []*Process{proc}}
+			assert.Equal(t, []*Process{proc}, snapshot.Pgrep())
+			assert.Nil(t, proc.pidfd)
+			assert.NoError(t, snapshot.Close())
+
+			reused := &Process{Pid: proc.Pid, startTime: proc.startTime + 1}
+			snapshot = &Snapshot{procs: []*Process{reused}}
+			assert.Empty(t, snapshot.Pgrep())
+		})
+	}
+	t.Run("Exited", func(t *testing.T) {
+		unixPidfdOpen = func(int, int) (int, error) { return -1, unix.ESRCH }
+		defer func() { unixPidfdOpen = unix.PidfdOpen }()
+
+		snapshot := &Snapshot{procs: []*Process{proc}}
+		assert.Empty(t, snapshot.Pgrep())
+		assert.Nil(t, proc.pidfd)
+	})
+}
+
+func TestSignalPidfd(t *testing.T) {
+	cmd, proc := startSleep(t)
+	snapshot := &Snapshot{procs: []*Process{proc}}
+	defer func() { _ = snapshot.Close() }()
+	assert.NotEmpty(t, snapshot.Pgrep())
+
+	assert.True(t, Running(proc))
+	assert.False(t, WaitExit(proc, 100*time.Millisecond))
+	assert.NoError(t, Signal(proc, syscall.SIGKILL))
+	assert.True(t, WaitExit(proc, 5*time.Second))
+	assert.False(t, Running(proc))
+
+	// The pidfd still refers to the exited process after it is reaped.
+	_ = cmd.Wait()
+	assert.NoError(t, Signal(proc, syscall.SIGKILL))
+}
+
+func TestSignalPidReused(t *testing.T) {
+	cmd, proc := startSleep(t)
+
+	// Without a pidfd, a process whose start time differs from the snapshot is never signaled.
+	reused := &Process{Pid: proc.Pid, startTime: proc.startTime + 1}
+	assert.NoError(t, Signal(reused, syscall.SIGKILL))
+	assert.False(t, Running(reused))
+	assert.True(t, Running(proc))
+	assert.Nil(t, cmd.ProcessState)
+	assert.NoError(t, cmd.Process.Signal(syscall.Signal(0)))
+}
+
+func TestPidfdWait(t *testing.T) {
+	_, proc := startSleep(t)
+	assert.NoError(t, proc.openPidfd())
+	defer func() { _ = proc.closePidfd() }()
+
+	start := time.Now()
+	assert.False(t, pidfdWait(proc.pidfd, 250*time.Millisecond))
+	assert.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond)
+
+	assert.NoError(t, syscall.Kill(int(proc.Pid), syscall.SIGKILL))
+	assert.True(t, pidfdWait(proc.pidfd, 5*time.Second))
+}
@@ -0,0 +1,22 @@
+package procps
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ReadPidFile reads the pid of a pid file, e.g. the nginx.pid file written by the Nginx master.
+// Returns error if the file cannot be read or does not contain a positive pid.
+func ReadPidFile(path string) (int32, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(content)), 10, 32)
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pid file %s: %q", path, strings.TrimSpace(string(content)))
+	}
+	return int32(pid), nil
+}
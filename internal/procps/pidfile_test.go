@@ -0,0 +1,59 @@
+package procps
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadPidFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    int32
+		wantErr bool
+	}{
+		{
+			name:    "Pid",
+			content: "64\n",
+			want:    64,
+		},
+		{
+			name:    "Empty",
+			content: "",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid",
+			content: "nginx",
+			wantErr: true,
+		},
+		{
+			name:    "NonPositive",
+			content: "0",
+			wantErr: true,
+		},
+		{
+			name:    "NotExist",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "nginx.pid")
+			if tt.name != "NotExist" {
+				assert.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
+			}
+			got, err := ReadPidFile(path)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
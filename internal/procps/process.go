@@ -0,0 +1,310 @@
+package procps
+
+import (
+	"errors"
+	"github.com/prometheus/procfs"
+	"nginx-reaper/internal/env"
+	"nginx-reaper/internal/log"
+	"nginx-reaper/internal/procps/option"
+	"os"
+	"strings"
+)
+
+// Clock ticks per second of the start time in /proc/<pid>/stat, USER_HZ is 100 on all supported architectures.
+const userHZ = 100
+
+// Process is a point-in-time view of a process, read once from /proc/<pid>/stat and /proc/<pid>/cmdline.
+// The executable, IDs, namespace pid and cgroups are read on first use. Process is not safe for concurrent use.
+type Process struct {
+	Pid        int32
+	ppid       int32
+	name       string
+	cmdline    string
+	state      string
+	startTime  uint64 // Start time in clock ticks after boot, identifies the process together with the pid.
+	createTime int64  // Creation time in milliseconds since the epoch.
+	rss        uint64
+	vms        uint64
+	pidfd      *os.File // Opened by Snapshot.Pgrep, nil if not opened or not supported by the kernel.
+
+	// Read on first use, since only a few processes are matched against them.
+	exe     lazy[string]
+	status  lazy[procfs.ProcStatus]
+	cgroups lazy[[]string]
+}
+
+// lazy is a value read on first use, together with the error of reading it.
+type lazy[T any] struct {
+	read  bool
+	value T
+	err   error
+}
+
+// get returns the value, reading it with the read function on first use.
+func (l *lazy[T]) get(read func() (T, error)) (T, error) {
+	if !l.read {
+		l.value, l.err = read()
+		l.read = true
+	}
+	return l.value, l.err
+}
+
+// NewProcess reads the process with the specified pid from /proc. Returns error, if any.
+func NewProcess(pid int32) (*Process, error) {
+	fs, err := procFS()
+	if err != nil {
+		return nil, err
+	}
+	bootTime, err := readBootTime(fs)
+	if err != nil {
+		return nil, err
+	}
+	return readProcess(fs, int(pid), bootTime)
+}
+
+// Ppid returns the pid of the parent process.
+func (p *Process) Ppid() int32 {
+	return p.ppid
+}
+
+// Name returns the name of the process executable, truncated by the kernel to 15 characters.
+func (p *Process) Name() string {
+	return p.name
+}
+
+// Cmdline returns the command line arguments of the process joined by spaces.
+func (p *Process) Cmdline() string {
+	return p.cmdline
+}
+
+// State returns the state of the process, e.g. "R", "S" or "Z".
+func (p *Process) State() string {
+	return p.state
+}
+
+// CreateTime returns the creation time of the process in milliseconds since the epoch.
+func (p *Process) CreateTime() int64 {
+	return p.createTime
+}
+
+// RSS returns the resident set size of the process in bytes.
+func (p *Process) RSS() uint64 {
+	return p.rss
+}
+
+// VMS returns the virtual memory size of the process in bytes.
+func (p *Process) VMS() uint64 {
+	return p.vms
+}
+
+// Exe returns the path of the process executable, read from /proc/<pid>/exe on first use.
+func (p *Process) Exe() (string, error) {
+	return p.exe.get(func() (string, error) {
+		proc, err := p.proc()
+		if err != nil {
+			return "", err
+		}
+		return proc.Executable()
+	})
+}
+
+// UID returns the effective user ID of the process, read from /proc/<pid>/status on first use.
+func (p *Process) UID() (uint32, error) {
+	status, err := p.readStatus()
+	return uint32(status.UIDs[1]), err
+}
+
+// GID returns the effective group ID of the process, read from /proc/<pid>/status on first use.
+func (p *Process) GID() (uint32, error) {
+	status, err := p.readStatus()
+	return uint32(status.GIDs[1]), err
+}
+
+// NSPid returns the pid of the process in its innermost pid namespace, read from /proc/<pid>/status on first use.
+func (p *Process) NSPid() (int32, error) {
+	status, err := p.readStatus()
+	if err != nil {
+		return 0, err
+	}
+	if len(status.NSpids) == 0 {
+		return p.Pid, nil
+	}
+	return int32(status.NSpids[len(status.NSpids)-1]), nil
+}
+
+// CgroupPaths returns the cgroup paths of all hierarchies of the process, read from /proc/<pid>/cgroup on first use.
+func (p *Process) CgroupPaths() ([]string, error) {
+	return p.cgroups.get(func() ([]string, error) {
+		proc, err := p.proc()
+		if err != nil {
+			return nil, err
+		}
+		cgroups, err := proc.Cgroups()
+		if err != nil {
+			return nil, err
+		}
+		paths := make([]string, len(cgroups))
+		for i, cgroup := range cgroups {
+			paths[i] = cgroup.Path
+		}
+		return paths, nil
+	})
+}
+
+// readStatus reads /proc/<pid>/status of the process on first use.
+func (p *Process) readStatus() (procfs.ProcStatus, error) {
+	return p.status.get(func() (procfs.ProcStatus, error) {
+		proc, err := p.proc()
+		if err != nil {
+			return procfs.ProcStatus{}, err
+		}
+		return proc.NewStatus()
+	})
+}
+
+// proc returns the procfs.Proc of the process.
+func (p *Process) proc() (procfs.Proc, error) {
+	fs, err := procFS()
+	if err != nil {
+		return procfs.Proc{}, err
+	}
+	return fs.Proc(int(p.Pid))
+}
+
+// Snapshot is a point-in-time view of all running processes, each read once from /proc.
+// Options, sorting and ProcessInfo use the values of the snapshot without reading /proc again.
+// The Snapshot must be closed to release the pidfds opened by Pgrep.
+type Snapshot struct {
+	procs  []*Process
+	pids   map[int32]*Process
+	opened []*Process
+}
+
+// NewSnapshot reads all running processes from /proc. Processes that exit while reading are skipped.
+// Returns error, if any.
+func NewSnapshot() (*Snapshot, error) {
+	fs, err := procFS()
+	if err != nil {
+		return nil, err
+	}
+	bootTime, err := readBootTime(fs)
+	if err != nil {
+		return nil, err
+	}
+	all, err := fs.AllProcs()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{pids: make(map[int32]*Process, len(all))}
+	for _, p := range all {
+		proc, err := readProcess(fs, p.PID, bootTime)
+		if err != nil {
+			continue
+		}
+		s.procs = append(s.procs, proc)
+		s.pids[proc.Pid] = proc
+	}
+	return s, nil
+}
+
+// Processes returns all processes of the snapshot in the order of /proc.
+func (s *Snapshot) Processes() []*Process {
+	return s.procs
+}
+
+// Get returns the process of the snapshot with the specified pid, or nil if not found.
+func (s *Snapshot) Get(pid int32) *Process {
+	return s.pids[pid]
+}
+
+// Pgrep returns the processes of the snapshot that match all the options provided.
+// A pidfd is opened for each matched process, so it can be signaled without pid reuse races.
+// Processes that exited or whose pid was reused since the snapshot was taken are skipped.
+func (s *Snapshot) Pgrep(options ...option.Option) []*Process {
+	var matched []*Process
+	for _, proc := range Filter(s.procs, options...) {
+		if err := proc.openPidfd(); err != nil {
+			log.Debugf("Failed to open pidfd of process %d: %v", proc.Pid, err)
+			continue
+		}
+		if proc.pidfd != nil {
+			s.opened = append(s.opened, proc)
+		}
+		matched = append(matched, proc)
+	}
+	return matched
+}
+
+// Close closes the pidfds opened by Pgrep. Returns error, if any.
+func (s *Snapshot) Close() error {
+	var errs []error
+	for _, proc := range s.opened {
+		errs = append(errs, proc.closePidfd())
+	}
+	s.opened = nil
+	return errors.Join(errs...)
+}
+
+// ProcessInfo creates a ProcessInfo instance of the process, including its parent read from the snapshot.
+func (s *Snapshot) ProcessInfo(proc *Process) *ProcessInfo {
+	p := FromProcess(proc)
+	if parent := s.Get(proc.Ppid()); parent != nil {
+		p.Parent = FromProcess(parent)
+	}
+	return p
+}
+
+// procFS returns the proc filesystem mounted at PROC_MOUNT_POINT.
+func procFS() (procfs.FS, error) {
+	return procfs.NewFS(env.GetString(envProcMountPoint, "/proc"))
+}
+
+// readProcStat reads /proc/<pid>/stat of the process with the specified pid.
+func readProcStat(pid int32) (procfs.ProcStat, error) {
+	fs, err := procFS()
+	if err != nil {
+		return procfs.ProcStat{}, err
+	}
+	p, err := fs.Proc(int(pid))
+	if err != nil {
+		return procfs.ProcStat{}, err
+	}
+	return p.Stat()
+}
+
+// readBootTime reads the boot time in seconds since the epoch from /proc/stat.
+func readBootTime(fs procfs.FS) (uint64, error) {
+	stat, err := fs.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.BootTime, nil
+}
+
+// readProcess reads the process with the specified pid, with one read of stat and one of cmdline.
+func readProcess(fs procfs.FS, pid int, bootTime uint64) (*Process, error) {
+	p, err := fs.Proc(pid)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := p.Stat()
+	if err != nil {
+		return nil, err
+	}
+	args, err := p.CmdLine()
+	if err != nil {
+		return nil, err
+	}
+	return &Process{
+		Pid:        int32(stat.PID),
+		ppid:       int32(stat.PPID),
+		name:       stat.Comm,
+		cmdline:    strings.Join(args, " "),
+		state:      stat.State,
+		startTime:  stat.Starttime,
+		createTime: int64(bootTime)*1000 + int64(stat.Starttime)*1000/userHZ,
+		rss:        uint64(stat.ResidentMemory()),
+		vms:        uint64(stat.VirtualMemory()),
+	}, nil
+}
@@ -2,72 +2,75 @@ package procps
 
 import (
 	"fmt"
-	"github.com/shirou/gopsutil/v3/process"
 	"github.com/stretchr/testify/assert"
 	"os"
 	"testing"
 )
 
-type fields struct {
-	Pid        int32
-	Name       string
-	Cmdline    string
-	CreateTime int64
-}
-
 func TestNewProcessInfo(t *testing.T) {
-	current := &process.Process{Pid: int32(os.Getpid())}
-	parent, _ := current.Parent()
+	current := mustNewProcess(t, os.Getpid())
+	parent := mustNewProcess(t, os.Getppid())
 
 	tests := []struct {
-		name string
-		proc *process.Process
-		want *fields
+		name       string
+		proc       *Process
+		wantParent bool
 	}{
 		{
-			name: "CurrentProcessInfo",
-			proc: current,
+			name:       "CurrentProcessInfo",
+			proc:       current,
+			wantParent: true,
+		},
+		{
+			name:       "Pid1ProcessInfo",
+			proc:       mustNewProcess(t, 1),
+			wantParent: false,
 		},
 		{
-			name: "ParentProcessInfo",
-			proc: parent,
+			name:       "ParentProcessInfo",
+			proc:       parent,
+			wantParent: parent.Ppid() != 0,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got := NewProcessInfo(tt.proc)
-			parent, _ = tt.proc.Parent()
-			testProcessInfo(t, tt.proc, got, parent)
+			testProcessInfo(t, tt.proc, got)
+			if tt.wantParent {
+				assert.Equal(t, tt.proc.Ppid(), got.Parent.Pid)
+				testProcessInfo(t, mustNewProcess(t, int(tt.proc.Ppid())), got.Parent)
+			} else {
+				assert.Nil(t, got.Parent)
+			}
 		})
 	}
 }
 
-func testProcessInfo(t assert.TestingT, proc *process.Process, pi *ProcessInfo, parentProc *process.Process) {
-	f := fieldsFrom(proc)
-	assert.Equal(t, f.Pid, pi.Pid)
-	assert.Equal(t, f.Name, pi.Name)
-	assert.Equal(t, f.Cmdline, pi.Cmdline)
-	assert.Equal(t, f.CreateTime, pi.CreateTime)
-	if pi.Parent != nil {
-		testProcessInfo(t, parentProc, pi.Parent, nil)
+func TestFromProcess(t *testing.T) {
+	proc := &Process{
+		Pid: 42, name: "nginx", cmdline: "nginx: worker process", state: "S", createTime: 1000, rss: 2048, vms: 4096,
 	}
+	assert.Equal(t, &ProcessInfo{
+		Pid:        42,
+		Name:       "nginx",
+		Cmdline:    "nginx: worker process",
+		State:      "S",
+		CreateTime: 1000,
+		RSS:        2048,
+		VMS:        4096,
+	}, FromProcess(proc))
 }
 
-func fieldsFrom(proc *process.Process) *fields {
-	procName, _ := proc.Name()
-	procCmdline, _ := proc.Cmdline()
-	procCreateTime, _ := proc.CreateTime()
-
-	return &fields{
-		Pid:        proc.Pid,
-		Name:       procName,
-		Cmdline:    procCmdline,
-		CreateTime: procCreateTime,
-	}
+func testProcessInfo(t assert.TestingT, proc *Process, pi *ProcessInfo) {
+	assert.Equal(t, proc.Pid, pi.Pid)
+	assert.Equal(t, proc.Name(), pi.Name)
+	assert.Equal(t, proc.Cmdline(), pi.Cmdline)
+	assert.Equal(t, proc.State(), pi.State)
+	assert.Equal(t, proc.CreateTime(), pi.CreateTime)
 }
 
 func TestProcessInfo_String(t *testing.T) {
-	proc := &process.Process{Pid: 1}
+	proc := mustNewProcess(t, 1)
 	t.Run("String", func(t *testing.T) {
 		got := NewProcessInfo(proc)
 		assert.Equal(t, stringFrom(got), got.String())
@@ -76,6 +79,6 @@ func TestProcessInfo_String(t *testing.T) {
 
 func stringFrom(pi *ProcessInfo) string {
 	return fmt.Sprintf(
-		"{\"pid\":%d,\"name\":\"%s\",\"cmdline\":\"%s\",\"createTime\":%d,\"rss\":%d,\"vms\":%d}",
-		pi.Pid, pi.Name, pi.Cmdline, pi.CreateTime, pi.RSS, pi.VMS)
+		"{\"pid\":%d,\"name\":\"%s\",\"cmdline\":\"%s\",\"state\":\"%s\",\"createTime\":%d,\"rss\":%d,\"vms\":%d}",
+		pi.Pid, pi.Name, pi.Cmdline, pi.State, pi.CreateTime, pi.RSS, pi.VMS)
 }
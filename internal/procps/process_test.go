@@ -0,0 +1,79 @@
+package procps
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/log"
+	"os"
+	"testing"
+)
+
+func TestProcess_ReadOnFirstUse(t *testing.T) {
+	t.Run("ProcMountPoint", func(t *testing.T) {
+		tempDir := t.TempDir()
+		t.Setenv(envProcMountPoint, tempDir)
+		writeFile(t, tempDir+"/42/status",
+			"Name:\tnginx\nUid:\t101\t102\t103\t104\nGid:\t201\t202\t203\t204\nNSpid:\t42\t7\n")
+		writeFile(t, tempDir+"/42/cgroup", "0::/kubepods/pod1234/nginx\n")
+		assert.NoError(t, os.Symlink("/usr/sbin/nginx", tempDir+"/42/exe"))
+		proc := &Process{Pid: 42}
+
+		uid, err := proc.UID()
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(102), uid)
+
+		// The status is read once, and values are kept after the process exits.
+		assert.NoError(t, os.RemoveAll(tempDir+"/42/status"))
+		gid, err := proc.GID()
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(202), gid)
+		nspid, err := proc.NSPid()
+		assert.NoError(t, err)
+		assert.Equal(t, int32(7), nspid)
+
+		exe, err := proc.Exe()
+		assert.NoError(t, err)
+		assert.Equal(t, "/usr/sbin/nginx", exe)
+
+		paths, err := proc.CgroupPaths()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/kubepods/pod1234/nginx"}, paths)
+	})
+	t.Run("CurrentProc", func(t *testing.T) {
+		proc := mustNewProcess(t, os.Getpid())
+
+		exe, err := proc.Exe()
+		assert.NoError(t, err)
+		wantExe, _ := os.Executable()
+		assert.Equal(t, wantExe, exe)
+
+		uid, err := proc.UID()
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(os.Geteuid()), uid)
+
+		gid, err := proc.GID()
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(os.Getegid()), gid)
+
+		nspid, err := proc.NSPid()
+		assert.NoError(t, err)
+		assert.Positive(t, nspid)
+
+		paths, err := proc.CgroupPaths()
+		assert.NoError(t, err)
+		assert.NotEmpty(t, paths)
+	})
+	t.Run("NoProc", func(t *testing.T) {
+		proc := &Process{Pid: -2}
+		_, err := proc.Exe()
+		log.Error(err)
+		assert.Error(t, err)
+		_, err = proc.UID()
+		assert.Error(t, err)
+		_, err = proc.GID()
+		assert.Error(t, err)
+		_, err = proc.NSPid()
+		assert.Error(t, err)
+		_, err = proc.CgroupPaths()
+		assert.Error(t, err)
+	})
+}
@@ -1,55 +1,33 @@
 package procps
 
 import (
+	"cmp"
 	"errors"
-	"github.com/shirou/gopsutil/v3/process"
+	"fmt"
 	"nginx-reaper/internal/procps/option"
-	"os"
 	"sort"
+	"strings"
+	"syscall"
+	"time"
 )
 
-var (
-	processes   = Processes
-	processPids = process.Pids
-)
+// Interval at which WaitExit checks whether the process is still running.
+const waitExitInterval = 100 * time.Millisecond
 
-// Pgrep searches for processes that match the provided options.
-func Pgrep(options ...option.Option) []*process.Process {
-	var result []*process.Process
+var newSnapshot = NewSnapshot
 
-	procs, err := processes()
+// Pgrep searches for processes that match the provided options in a new Snapshot of the running processes.
+// Unlike Snapshot.Pgrep, no pidfd is opened, so signals rely on the start time check of the pid.
+func Pgrep(options ...option.Option) []*Process {
+	snapshot, err := newSnapshot()
 	if err != nil {
-		return result
-	}
-
-	for _, proc := range procs {
-		if All(proc, options...) {
-			result = append(result, proc)
-		}
-	}
-
-	return result
-}
-
-// Processes retrieve a list of all running processes.
-// Note: Using process.Processes() has a huge performance impact, so use process.Pids() instead.
-func Processes() ([]*process.Process, error) {
-	var result []*process.Process
-
-	pids, err := processPids()
-	if err != nil {
-		return result, err
-	}
-
-	for _, pid := range pids {
-		result = append(result, &process.Process{Pid: pid})
+		return nil
 	}
-
-	return result, nil
+	return Filter(snapshot.Processes(), options...)
 }
 
 // All returns a bool indicating whether the process matches all the options provided.
-func All(proc *process.Process, options ...option.Option) bool {
+func All(proc *Process, options ...option.Option) bool {
 	for _, match := range options {
 		if !match(proc) {
 			return false
@@ -59,8 +37,8 @@ func All(proc *process.Process, options ...option.Option) bool {
 }
 
 // Filter takes a slice of processes and returns a slice of processes that match all the options provided.
-func Filter(procs []*process.Process, options ...option.Option) []*process.Process {
-	var matched []*process.Process
+func Filter(procs []*Process, options ...option.Option) []*Process {
+	var matched []*Process
 	for _, proc := range procs {
 		if All(proc, options...) {
 			matched = append(matched, proc)
@@ -70,19 +48,112 @@ func Filter(procs []*process.Process, options ...option.Option) []*process.Proce
 }
 
 // SortByCreateTime sorts a slice of processes based on their creation time.
-func SortByCreateTime(procs []*process.Process) {
-	sort.Slice(procs, func(i, j int) bool {
-		cti, ei := procs[i].CreateTime()
-		ctj, ej := procs[j].CreateTime()
-		return ei == nil && ej == nil && cti < ctj
+func SortByCreateTime(procs []*Process) {
+	sort.SliceStable(procs, func(i, j int) bool {
+		return procs[i].CreateTime() < procs[j].CreateTime()
+	})
+}
+
+// SortBy sorts a slice of processes in ascending order of the key, reading the key of each process once.
+// Processes whose key cannot be read are moved to the end, the order of equal keys is preserved.
+func SortBy[T cmp.Ordered](procs []*Process, key func(*Process) (T, error)) {
+	type keyed struct {
+		proc *Process
+		key  T
+		err  error
+	}
+	items := make([]keyed, len(procs))
+	for i, proc := range procs {
+		k, err := key(proc)
+		items[i] = keyed{proc: proc, key: k, err: err}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].err != nil || items[j].err != nil {
+			return items[i].err == nil
+		}
+		return items[i].key < items[j].key
 	})
+	for i, item := range items {
+		procs[i] = item.proc
+	}
 }
 
-// Terminate the specified process. If the process is already terminated, no error is returned.
-func Terminate(proc *process.Process) error {
-	err := proc.Terminate()
-	if errors.Is(err, os.ErrProcessDone) {
+// NumSockets returns the number of sockets opened by the specified process.
+// Shutting down Nginx workers close listening sockets, so the remaining sockets are client and upstream connections.
+func NumSockets(proc *Process) (int, error) {
+	fs, err := procFS()
+	if err != nil {
+		return 0, err
+	}
+	p, err := fs.Proc(int(proc.Pid))
+	if err != nil {
+		return 0, err
+	}
+	targets, err := p.FileDescriptorTargets()
+	if err != nil {
+		return 0, err
+	}
+	sockets := 0
+	for _, target := range targets {
+		if strings.HasPrefix(target, "socket:") {
+			sockets++
+		}
+	}
+	return sockets, nil
+}
+
+// Signal sends the specified signal to the process. If the process is already terminated, no error is returned.
+// The signal is sent through the pidfd of the process, if opened. Otherwise, the start time of the pid is checked
+// before kill(2), so that a process that reused the pid is never signaled.
+func Signal(proc *Process, sig syscall.Signal) error {
+	// kill(2) signals process groups for non-positive pids.
+	if proc.Pid <= 0 {
+		return fmt.Errorf("invalid pid %d", proc.Pid)
+	}
+	var err error
+	if proc.pidfd != nil {
+		err = pidfdSignal(proc.pidfd, sig)
+	} else if proc.startTime != 0 && !sameStartTime(proc) {
+		return nil
+	} else {
+		err = syscall.Kill(int(proc.Pid), sig)
+	}
+	if errors.Is(err, syscall.ESRCH) {
 		return nil
 	}
 	return err
 }
+
+// Running returns a bool indicating whether the process is still running.
+// Zombie processes and processes whose pid was reused are not running.
+func Running(proc *Process) bool {
+	if proc.pidfd != nil {
+		return !pidfdWait(proc.pidfd, 0)
+	}
+	stat, err := readProcStat(proc.Pid)
+	if err != nil {
+		return false
+	}
+	if proc.startTime != 0 && stat.Starttime != proc.startTime {
+		return false
+	}
+	return stat.State != "Z" && stat.State != "X"
+}
+
+// WaitExit waits until the process is no longer running or the timeout expires.
+// Returns a bool indicating whether the process exited.
+// The pidfd of the process is polled for exit, if opened. Otherwise, /proc is checked periodically.
+func WaitExit(proc *Process, timeout time.Duration) bool {
+	if proc.pidfd != nil {
+		return pidfdWait(proc.pidfd, timeout)
+	}
+	deadline := time.Now().Add(timeout)
+	for Running(proc) {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return false
+		}
+		time.Sleep(min(waitExitInterval, remaining))
+	}
+	return true
+}
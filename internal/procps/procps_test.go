@@ -5,176 +5,178 @@ import (
 	"github.com/shirou/gopsutil/v3/process"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
-	"math/rand"
+	"net"
 	"nginx-reaper/internal/log"
 	"nginx-reaper/internal/procps/option"
 	"os"
 	"os/exec"
+	"syscall"
 	"testing"
+	"time"
 )
 
 // See https://github.com/stretchr/testify#mock-package
-type MockProcesses struct {
+type MockNewSnapshot struct {
 	mock.Mock
 }
 
-func (m *MockProcesses) Call() ([]*process.Process, error) {
+func (m *MockNewSnapshot) Call() (*Snapshot, error) {
 	args := m.Called()
-	var result []*process.Process
+	var result *Snapshot
 	if args.Get(0) != nil {
-		result = args.Get(0).([]*process.Process)
+		result = args.Get(0).(*Snapshot)
 	}
 	return result, args.Error(1)
 }
 
+func pidIs(pids ...int32) option.Option {
+	return func(proc option.Process) bool {
+		for _, pid := range pids {
+			if proc.(*Process).Pid == pid {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func pidsFrom(procs []*Process) []int32 {
+	var pids []int32
+	for _, proc := range procs {
+		pids = append(pids, proc.Pid)
+	}
+	return pids
+}
+
+func mustNewProcess(t testing.TB, pid int) *Process {
+	proc, err := NewProcess(int32(pid))
+	assert.NoError(t, err)
+	return proc
+}
+
 func TestPgrep(t *testing.T) {
+	currentPid := int32(os.Getpid())
+
 	tests := []struct {
 		name    string
 		options []option.Option
-		want    []*process.Process
+		want    []int32
 		wantErr bool
 	}{
 		{
-			name: "Pid1",
-			options: []option.Option{
-				func(proc *process.Process) bool {
-					return proc.Pid == 1
-				},
-			},
-			want: []*process.Process{
-				{Pid: 1},
-			},
+			name:    "Pid1",
+			options: []option.Option{pidIs(1)},
+			want:    []int32{1},
 		},
 		{
-			name: "CurrentPid",
-			options: []option.Option{
-				func(proc *process.Process) bool {
-					return proc.Pid == int32(os.Getpid())
-				},
-			},
-			want: []*process.Process{
-				{Pid: int32(os.Getpid())},
-			},
+			name:    "CurrentPid",
+			options: []option.Option{pidIs(currentPid)},
+			want:    []int32{currentPid},
 		},
 		{
-			name: "Pid1CurrentPid",
-			options: []option.Option{
-				func(proc *process.Process) bool {
-					return proc.Pid == 1 || proc.Pid == int32(os.Getpid())
-				},
-			},
-			want: []*process.Process{
-				{Pid: 1},
-				{Pid: int32(os.Getpid())},
-			},
+			name:    "Pid1CurrentPid",
+			options: []option.Option{pidIs(1, currentPid)},
+			want:    []int32{1, currentPid},
 		},
 		{
-			name: "NotMatch",
-			options: []option.Option{
-				func(proc *process.Process) bool {
-					return false
-				},
-			},
+			name:    "NotMatch",
+			options: []option.Option{pidIs()},
 		},
 		{
-			name:    "ProcessesError",
+			name:    "SnapshotError",
 			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			mockProcesses := MockProcesses{}
+			mockNewSnapshot := MockNewSnapshot{}
 			if tt.wantErr {
-				// Mock processes function to return an error
-				mockProcesses.On("Call").Return(nil, errors.New(tt.name))
-				processes = mockProcesses.Call
-				defer func() { processes = Processes }()
+				// Mock the newSnapshot function to return an error
+				mockNewSnapshot.On("Call").Return(nil, errors.New(tt.name))
+				newSnapshot = mockNewSnapshot.Call
+				defer func() { newSnapshot = NewSnapshot }()
 			}
 			got := Pgrep(tt.options...)
 			if tt.wantErr {
-				mockProcesses.AssertCalled(t, "Call")
+				mockNewSnapshot.AssertCalled(t, "Call")
 			}
-			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want, pidsFrom(got))
 		})
 	}
 }
 
-// See https://github.com/stretchr/testify#mock-package
-type MockPids struct {
-	mock.Mock
-}
+func TestNewSnapshot(t *testing.T) {
+	t.Run("Processes", func(t *testing.T) {
+		snapshot, err := NewSnapshot()
+		assert.NoError(t, err)
+		assert.Contains(t, pidsFrom(snapshot.Processes()), int32(1))
+		assert.Contains(t, pidsFrom(snapshot.Processes()), int32(os.Getpid()))
 
-func (m *MockPids) Call() ([]int32, error) {
-	args := m.Called()
-	var pids []int32
-	if args.Get(0) != nil {
-		pids = args.Get(0).([]int32)
-	}
-	return pids, args.Error(1)
+		current := snapshot.Get(int32(os.Getpid()))
+		assert.Equal(t, mustNewProcess(t, os.Getpid()).Cmdline(), current.Cmdline())
+		assert.Equal(t, int32(os.Getppid()), current.Ppid())
+		assert.Nil(t, snapshot.Get(-2))
+		assert.Equal(t, FromProcess(snapshot.Get(current.Ppid())), snapshot.ProcessInfo(current).Parent)
+		assert.Equal(t, []int32{int32(os.Getpid())}, pidsFrom(snapshot.Pgrep(pidIs(int32(os.Getpid())))))
+	})
+	t.Run("ProcMountPointError", func(t *testing.T) {
+		t.Setenv(envProcMountPoint, t.TempDir())
+		snapshot, err := NewSnapshot()
+		log.Error(err)
+		assert.Nil(t, snapshot)
+		assert.Error(t, err)
+	})
 }
 
-func TestProcesses(t *testing.T) {
-	tests := []struct {
-		name    string
-		want    []*process.Process
-		wantErr bool
-	}{
-		{
-			name: "ProcessPids",
-			want: []*process.Process{
-				{Pid: rand.Int31()},
-				{Pid: rand.Int31()},
-				{Pid: rand.Int31()},
-			},
-		},
-		{
-			name:    "ProcessPidsError",
-			wantErr: true,
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			mockPids := MockPids{}
-			if tt.wantErr {
-				// Mock the processPids function to return an error
-				mockPids.On("Call").Return(nil, errors.New(tt.name))
-				processPids = mockPids.Call
-				defer func() { processPids = process.Pids }()
-			} else {
-				// Mock the processPids function to return the expected result
-				mockPids.On("Call").Return(pidsFrom(tt.want), nil)
-				processPids = mockPids.Call
-				defer func() { processPids = process.Pids }()
-			}
-			got, err := Processes()
-			mockPids.AssertCalled(t, "Call")
-			assert.Equal(t, tt.want, got)
-			if tt.wantErr {
-				log.Error(err)
-				assert.Zero(t, len(got))
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-			}
-		})
-	}
-}
+func TestNewProcess(t *testing.T) {
+	t.Run("ProcMountPoint", func(t *testing.T) {
+		tempDir := t.TempDir()
+		t.Setenv(envProcMountPoint, tempDir)
+		writeFile(t, tempDir+"/stat", "cpu  0 0 0 0 0 0 0 0 0 0\nbtime 1700000000\n")
+		writeFile(t, tempDir+"/42/stat",
+			"42 (nginx) S 7 42 42 0 -1 4194560 0 0 0 0 0 0 0 0 20 0 1 0 250 4096000 100 "+
+				"18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0\n")
+		writeFile(t, tempDir+"/42/cmdline", "nginx: worker process is shutting down\x00")
 
-func pidsFrom(procs []*process.Process) []int32 {
-	var pids []int32
-	for _, proc := range procs {
-		pids = append(pids, proc.Pid)
-	}
-	return pids
+		got, err := NewProcess(42)
+		assert.NoError(t, err)
+		assert.Equal(t, &Process{
+			Pid:        42,
+			ppid:       7,
+			name:       "nginx",
+			cmdline:    "nginx: worker process is shutting down",
+			state:      "S",
+			startTime:  250,
+			createTime: 1700000002500,
+			rss:        100 * uint64(os.Getpagesize()),
+			vms:        4096000,
+		}, got)
+	})
+	t.Run("CurrentProc", func(t *testing.T) {
+		got := mustNewProcess(t, os.Getpid())
+		legacy := &process.Process{Pid: int32(os.Getpid())}
+		legacyCreateTime, _ := legacy.CreateTime()
+		legacyName, _ := legacy.Name()
+		assert.Equal(t, int32(os.Getppid()), got.Ppid())
+		assert.Equal(t, legacyName, got.Name())
+		assert.InDelta(t, legacyCreateTime, got.CreateTime(), 1000)
+		assert.Contains(t, []string{"R", "S"}, got.State())
+		assert.Positive(t, got.RSS())
+		assert.Positive(t, got.VMS())
+	})
+	t.Run("NoProc", func(t *testing.T) {
+		got, err := NewProcess(-2)
+		log.Error(err)
+		assert.Nil(t, got)
+		assert.Error(t, err)
+	})
 }
 
 func TestAll(t *testing.T) {
-	currentProc := &process.Process{Pid: int32(os.Getpid())}
-	currentProcCmdline, _ := currentProc.Cmdline()
-	parentProc, _ := currentProc.Parent()
+	currentProc := mustNewProcess(t, os.Getpid())
 
 	type args struct {
-		proc    *process.Process
+		proc    *Process
 		options []option.Option
 	}
 	tests := []struct {
@@ -187,7 +189,7 @@ func TestAll(t *testing.T) {
 			args: args{
 				proc: currentProc,
 				options: []option.Option{
-					option.Cmdline(currentProcCmdline),
+					option.Cmdline(currentProc.Cmdline()),
 				},
 			},
 			want: true,
@@ -197,8 +199,8 @@ func TestAll(t *testing.T) {
 			args: args{
 				proc: currentProc,
 				options: []option.Option{
-					option.Cmdline(currentProcCmdline),
-					option.Parent(parentProc.Pid),
+					option.Cmdline(currentProc.Cmdline()),
+					option.Parent(currentProc.Ppid()),
 				},
 			},
 			want: true,
@@ -208,7 +210,7 @@ func TestAll(t *testing.T) {
 			args: args{
 				proc: currentProc,
 				options: []option.Option{
-					option.Cmdline(currentProcCmdline),
+					option.Cmdline(currentProc.Cmdline()),
 					option.Parent(currentProc.Pid),
 				},
 			},
@@ -224,39 +226,36 @@ func TestAll(t *testing.T) {
 }
 
 func TestFilter(t *testing.T) {
-	pid1Proc := &process.Process{Pid: 1}
-	pid1Cmdline, _ := pid1Proc.Cmdline()
-	currentProc := &process.Process{Pid: int32(os.Getpid())}
-	currentCmdline, _ := currentProc.Cmdline()
-	parentProc, _ := currentProc.Parent()
+	pid1Proc := mustNewProcess(t, 1)
+	currentProc := mustNewProcess(t, os.Getpid())
 
 	type args struct {
-		procs   []*process.Process
+		procs   []*Process
 		options []option.Option
 	}
 	tests := []struct {
 		name string
 		args args
-		want []*process.Process
+		want []*Process
 	}{
 		{
 			name: "FilterPid1Proc",
 			args: args{
-				procs:   []*process.Process{pid1Proc, currentProc},
-				options: []option.Option{option.Cmdline(pid1Cmdline)},
+				procs:   []*Process{pid1Proc, currentProc},
+				options: []option.Option{option.Cmdline(pid1Proc.Cmdline())},
 			},
-			want: []*process.Process{pid1Proc},
+			want: []*Process{pid1Proc},
 		},
 		{
 			name: "FilterCurrentProc",
 			args: args{
-				procs: []*process.Process{pid1Proc, currentProc},
+				procs: []*Process{pid1Proc, currentProc},
 				options: []option.Option{
-					option.Cmdline(currentCmdline),
-					option.Parent(parentProc.Pid),
+					option.Cmdline(currentProc.Cmdline()),
+					option.Parent(currentProc.Ppid()),
 				},
 			},
-			want: []*process.Process{currentProc},
+			want: []*Process{currentProc},
 		},
 	}
 	for _, tt := range tests {
@@ -268,19 +267,17 @@ func TestFilter(t *testing.T) {
 }
 
 func TestSortByCreateTime(t *testing.T) {
-	pid1Proc := &process.Process{Pid: 1}
-	currentProc := &process.Process{Pid: int32(os.Getpid())}
-	parentProc, _ := currentProc.Parent()
+	procs := []*Process{{Pid: 1, createTime: 1000}, {Pid: 2, createTime: 3000}, {Pid: 3, createTime: 2000}}
 
 	tests := []struct {
 		name      string
-		processes []*process.Process
-		want      []*process.Process
+		processes []*Process
+		want      []*Process
 	}{
 		{
 			name:      "SortByCreateTime",
-			processes: []*process.Process{parentProc, currentProc, pid1Proc},
-			want:      []*process.Process{pid1Proc, parentProc, currentProc},
+			processes: []*Process{procs[1], procs[2], procs[0]},
+			want:      []*Process{procs[0], procs[2], procs[1]},
 		},
 	}
 	for _, tt := range tests {
@@ -291,32 +288,104 @@ func TestSortByCreateTime(t *testing.T) {
 	}
 }
 
-func TestTerminate(t *testing.T) {
+func TestSortBy(t *testing.T) {
+	procs := []*Process{{Pid: 1}, {Pid: 2}, {Pid: 3}, {Pid: 4}, {Pid: 5}}
+	keys := map[int32]int{1: 30, 2: 10, 4: 20, 5: 10}
+	key := func(proc *Process) (int, error) {
+		if k, ok := keys[proc.Pid]; ok {
+			return k, nil
+		}
+		return 0, errors.New("no key")
+	}
+
+	tests := []struct {
+		name      string
+		processes []*Process
+		want      []*Process
+	}{
+		{
+			name:      "Empty",
+			processes: []*Process{},
+			want:      []*Process{},
+		},
+		{
+			name:      "SortBy",
+			processes: []*Process{procs[0], procs[1], procs[2], procs[3], procs[4]},
+			want:      []*Process{procs[1], procs[4], procs[3], procs[0], procs[2]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SortBy(tt.processes, key)
+			assert.Equal(t, tt.want, tt.processes)
+		})
+	}
+}
+
+func TestNumSockets(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	t.Run("CurrentProc", func(t *testing.T) {
+		got, err := NumSockets(&Process{Pid: int32(os.Getpid())})
+		assert.NoError(t, err)
+		assert.Positive(t, got)
+	})
+	t.Run("NoProc", func(t *testing.T) {
+		got, err := NumSockets(&Process{Pid: -2})
+		log.Error(err)
+		assert.Zero(t, got)
+		assert.Error(t, err)
+	})
+}
+
+// exitedProcess returns a process that has already exited and been reaped.
+func exitedProcess(t *testing.T) *Process {
+	cmd := exec.Command("true")
+	assert.NoError(t, cmd.Start())
+	proc := mustNewProcess(t, cmd.Process.Pid)
+	assert.NoError(t, cmd.Wait())
+	return proc
+}
+
+func TestSignal(t *testing.T) {
 	cmd := exec.Command("sleep", "100")
 	assert.NoError(t, cmd.Start())
+	defer func() { _ = cmd.Wait() }()
 
 	tests := []struct {
 		name    string
-		proc    *process.Process
+		proc    *Process
+		sig     syscall.Signal
 		wantErr bool
 	}{
 		{
 			name: "Terminate",
-			proc: &process.Process{Pid: int32(cmd.Process.Pid)},
+			proc: mustNewProcess(t, cmd.Process.Pid),
+			sig:  syscall.SIGTERM,
 		},
 		{
-			name: "ErrProcessDone",
-			proc: &process.Process{Pid: -2},
+			name: "ProcessDone",
+			proc: exitedProcess(t),
+			sig:  syscall.SIGKILL,
 		},
 		{
-			name:    "TerminateError",
-			proc:    &process.Process{Pid: 0},
+			name:    "InvalidPid",
+			proc:    &Process{Pid: 0},
+			sig:     syscall.SIGTERM,
+			wantErr: true,
+		},
+		{
+			name:    "SignalError",
+			proc:    &Process{Pid: int32(os.Getpid())},
+			sig:     syscall.Signal(-1),
 			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := Terminate(tt.proc)
+			err := Signal(tt.proc, tt.sig)
 			if tt.wantErr {
 				log.Error(err)
 				assert.Error(t, err)
@@ -326,3 +395,113 @@ func TestTerminate(t *testing.T) {
 		})
 	}
 }
+
+func TestRunning(t *testing.T) {
+	cmd := exec.Command("sleep", "100")
+	assert.NoError(t, cmd.Start())
+	proc := mustNewProcess(t, cmd.Process.Pid)
+
+	t.Run("Running", func(t *testing.T) {
+		assert.True(t, Running(proc))
+	})
+	t.Run("PidReused", func(t *testing.T) {
+		assert.False(t, Running(&Process{Pid: proc.Pid, startTime: proc.startTime + 1}))
+	})
+	t.Run("Zombie", func(t *testing.T) {
+		assert.NoError(t, cmd.Process.Kill())
+		assert.Eventually(t, func() bool { return !Running(proc) }, time.Second, 10*time.Millisecond)
+	})
+	t.Run("Exited", func(t *testing.T) {
+		_ = cmd.Wait()
+		assert.False(t, Running(proc))
+	})
+	t.Run("NoProc", func(t *testing.T) {
+		assert.False(t, Running(&Process{Pid: -2}))
+	})
+}
+
+func TestWaitExit(t *testing.T) {
+	cmd := exec.Command("sleep", "100")
+	assert.NoError(t, cmd.Start())
+	defer func() { _ = cmd.Wait() }()
+	proc := mustNewProcess(t, cmd.Process.Pid)
+
+	t.Run("Timeout", func(t *testing.T) {
+		start := time.Now()
+		assert.False(t, WaitExit(proc, 250*time.Millisecond))
+		assert.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond)
+	})
+	t.Run("Exited", func(t *testing.T) {
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			_ = cmd.Process.Kill()
+		}()
+		assert.True(t, WaitExit(proc, 5*time.Second))
+	})
+	t.Run("NoProc", func(t *testing.T) {
+		assert.True(t, WaitExit(&Process{Pid: -2}, 0))
+	})
+}
+
+// BenchmarkPgrep finds the children of the current process, sorts them and reads their ProcessInfo,
+// as the reaper does for each master, from a single Snapshot.
+func BenchmarkPgrep(b *testing.B) {
+	benchmarkChildren(b)
+	for b.Loop() {
+		children := Pgrep(option.Parent(int32(os.Getpid())))
+		SortByCreateTime(children)
+		for _, child := range children {
+			_ = NewProcessInfo(child)
+		}
+	}
+}
+
+// BenchmarkPgrepGopsutil is the same as BenchmarkPgrep with per-call gopsutil lookups, where each option,
+// sort comparison and ProcessInfo field reads /proc again.
+func BenchmarkPgrepGopsutil(b *testing.B) {
+	benchmarkChildren(b)
+	for b.Loop() {
+		pids, err := process.Pids()
+		assert.NoError(b, err)
+		var children []*process.Process
+		for _, pid := range pids {
+			proc := &process.Process{Pid: pid}
+			if parent, err := proc.Parent(); err == nil && parent.Pid == int32(os.Getpid()) {
+				children = append(children, proc)
+			}
+		}
+		for i := range children {
+			for j := i + 1; j < len(children); j++ {
+				cti, _ := children[i].CreateTime()
+				ctj, _ := children[j].CreateTime()
+				if ctj < cti {
+					children[i], children[j] = children[j], children[i]
+				}
+			}
+		}
+		for _, child := range children {
+			_, _ = child.Name()
+			_, _ = child.Cmdline()
+			_, _ = child.CreateTime()
+			_, _ = child.MemoryInfo()
+			if parent, err := child.Parent(); err == nil {
+				_, _ = parent.Name()
+				_, _ = parent.Cmdline()
+				_, _ = parent.CreateTime()
+				_, _ = parent.MemoryInfo()
+			}
+		}
+	}
+}
+
+// benchmarkChildren starts child processes of the current process for the duration of the benchmark.
+func benchmarkChildren(b *testing.B) {
+	for range 8 {
+		cmd := exec.Command("sleep", "100")
+		assert.NoError(b, cmd.Start())
+		b.Cleanup(func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		})
+	}
+}
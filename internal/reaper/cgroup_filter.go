@@ -0,0 +1,83 @@
+package reaper
+
+import (
+	"fmt"
+	"nginx-reaper/internal/procps"
+	"nginx-reaper/internal/procps/option"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CgroupFilter limits the Reaper to the processes of a cgroup, e.g. of a container or a pod.
+type CgroupFilter struct {
+	// Path of the cgroup, any cgroup path of a process must equal it or be below it.
+	// With a trailing "*", any cgroup path of a process must start with the rest of it.
+	Path string
+	// Pid of a reference process, all cgroup paths of a process must equal the cgroup paths of the reference process.
+	Pid int32
+}
+
+// ParseCgroupFilter converts a string to CgroupFilter. Returns error if invalid.
+// E.g. "/kubepods/burstable/pod1234" becomes a filter of the pod cgroup and its container cgroups,
+// "/system.slice/docker-*" a filter of the cgroups starting with the prefix, and "pid:64" a filter of the cgroup of
+// the process 64. An empty string does not limit the Reaper.
+func ParseCgroupFilter(text string) (*CgroupFilter, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return &CgroupFilter{}, nil
+	case strings.HasPrefix(text, "/"):
+		return &CgroupFilter{Path: text}, nil
+	case strings.HasPrefix(text, "pid:"):
+		pid, err := strconv.ParseInt(strings.TrimPrefix(text, "pid:"), 10, 32)
+		if err != nil || pid <= 0 {
+			return nil, fmt.Errorf("invalid cgroup reference pid: %q", text)
+		}
+		return &CgroupFilter{Pid: int32(pid)}, nil
+	}
+	return nil, fmt.Errorf("invalid cgroup: %q", text)
+}
+
+// String returns a string representation of the CgroupFilter.
+func (f *CgroupFilter) String() string {
+	switch {
+	case f.Pid > 0:
+		return fmt.Sprintf("pid:%d", f.Pid)
+	case f.Path != "":
+		return f.Path
+	}
+	return "any"
+}
+
+// option returns an Option that matches the processes of the cgroup. The cgroup paths of the reference process are
+// read from the snapshot. Returns error if the reference process is not running or its cgroups cannot be read,
+// so that no process outside the cgroup is matched.
+func (f *CgroupFilter) option(snapshot *procps.Snapshot) (option.Option, error) {
+	switch {
+	case f.Pid > 0:
+		reference := snapshot.Get(f.Pid)
+		if reference == nil {
+			return nil, fmt.Errorf("reference process %d is not running", f.Pid)
+		}
+		paths, err := reference.CgroupPaths()
+		if err != nil {
+			return nil, fmt.Errorf("reference process %d: %w", f.Pid, err)
+		}
+		return func(proc option.Process) bool {
+			procPaths, err := proc.CgroupPaths()
+			return err == nil && slices.Equal(procPaths, paths)
+		}, nil
+	case strings.HasSuffix(f.Path, "*"):
+		return option.CgroupPath(strings.TrimSuffix(f.Path, "*")), nil
+	case f.Path != "":
+		parent := strings.TrimSuffix(f.Path, "/")
+		return func(proc option.Process) bool {
+			procPaths, err := proc.CgroupPaths()
+			return err == nil && slices.ContainsFunc(procPaths, func(path string) bool {
+				return path == parent || strings.HasPrefix(path, parent+"/")
+			})
+		}, nil
+	}
+	return matchAny.Option, nil
+}
@@ -0,0 +1,141 @@
+package reaper
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/log"
+	"nginx-reaper/internal/procps"
+	"os"
+	"testing"
+)
+
+func TestParseCgroupFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    *CgroupFilter
+		wantStr string
+		wantErr bool
+	}{
+		{
+			name:    "Empty",
+			text:    " ",
+			want:    &CgroupFilter{},
+			wantStr: "any",
+		},
+		{
+			name:    "Path",
+			text:    "/kubepods/burstable/pod1234",
+			want:    &CgroupFilter{Path: "/kubepods/burstable/pod1234"},
+			wantStr: "/kubepods/burstable/pod1234",
+		},
+		{
+			name:    "Prefix",
+			text:    "/system.slice/docker-*",
+			want:    &CgroupFilter{Path: "/system.slice/docker-*"},
+			wantStr: "/system.slice/docker-*",
+		},
+		{
+			name:    "Pid",
+			text:    "pid:64",
+			want:    &CgroupFilter{Pid: 64},
+			wantStr: "pid:64",
+		},
+		{
+			name:    "InvalidPid",
+			text:    "pid:nginx",
+			wantErr: true,
+		},
+		{
+			name:    "NonPositivePid",
+			text:    "pid:0",
+			wantErr: true,
+		},
+		{
+			name:    "Relative",
+			text:    "kubepods",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCgroupFilter(tt.text)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantStr, got.String())
+			}
+		})
+	}
+}
+
+func TestCgroupFilter_option(t *testing.T) {
+	snapshot, err := procps.NewSnapshot()
+	assert.NoError(t, err)
+	currentPaths, err := snapshot.Get(int32(os.Getpid())).CgroupPaths()
+	assert.NoError(t, err)
+
+	pod := &fakeProcess{cgroups: []string{"/kubepods/burstable/pod1234/cri-containerd-abc.scope"}}
+	otherPod := &fakeProcess{cgroups: []string{"/kubepods/burstable/pod12345/cri-containerd-def.scope"}}
+	v1 := &fakeProcess{cgroups: []string{"/", "/kubepods/burstable/pod1234/abc", "/kubepods/burstable/pod1234/abc"}}
+	docker := &fakeProcess{cgroups: []string{"/system.slice/docker-abc.scope"}}
+	current := &fakeProcess{cgroups: currentPaths}
+	failed := &fakeProcess{err: errors.New("no proc")}
+
+	tests := []struct {
+		name    string
+		filter  *CgroupFilter
+		want    []bool // Matches of pod, otherPod, v1, docker, current and failed processes.
+		wantErr bool
+	}{
+		{
+			name:   "Any",
+			filter: &CgroupFilter{},
+			want:   []bool{true, true, true, true, true, true},
+		},
+		{
+			name:   "Path",
+			filter: &CgroupFilter{Path: "/kubepods/burstable/pod1234/"},
+			want:   []bool{true, false, true, false, false, false},
+		},
+		{
+			name:   "ExactPath",
+			filter: &CgroupFilter{Path: "/system.slice/docker-abc.scope"},
+			want:   []bool{false, false, false, true, false, false},
+		},
+		{
+			name:   "Prefix",
+			filter: &CgroupFilter{Path: "/kubepods/burstable/pod1234*"},
+			want:   []bool{true, true, true, false, false, false},
+		},
+		{
+			name:   "Pid",
+			filter: &CgroupFilter{Pid: int32(os.Getpid())},
+			want:   []bool{false, false, false, false, true, false},
+		},
+		{
+			name:    "PidNotRunning",
+			filter:  &CgroupFilter{Pid: 2147483647},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := tt.filter.option(snapshot)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			var got []bool
+			for _, proc := range []*fakeProcess{pod, otherPod, v1, docker, current, failed} {
+				got = append(got, match(proc))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
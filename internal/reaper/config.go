@@ -0,0 +1,294 @@
+package reaper
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"nginx-reaper/internal/env"
+	"nginx-reaper/internal/log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfigSource is where the value of a configuration parameter of the Reaper comes from.
+type ConfigSource int
+
+const (
+	SourceDefault ConfigSource = iota // SourceDefault is the built-in default.
+	SourceEnv                         // SourceEnv is an environment variable.
+	SourceNginx                       // SourceNginx is the Nginx configuration.
+	SourceAPI                         // SourceAPI is a PATCH request to the config endpoint.
+)
+
+// Config source names by ConfigSource.
+var sourceNames = []string{"default", "env", "nginx", "api"}
+
+// String returns the name of the ConfigSource, e.g. "env".
+func (s ConfigSource) String() string {
+	if s < 0 || int(s) >= len(sourceNames) {
+		return fmt.Sprintf("ConfigSource(%d)", s)
+	}
+	return sourceNames[s]
+}
+
+// MarshalText encodes the ConfigSource as its name.
+func (s ConfigSource) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ConfigError is an invalid value of a configuration parameter changed at runtime.
+type ConfigError struct {
+	Parameter string `json:"parameter,omitempty"`
+	Message   string `json:"message"`
+}
+
+// ConfigErrors are the invalid values of a configuration change, none of which is applied.
+type ConfigErrors []ConfigError
+
+// Error returns the invalid parameters and their messages, e.g. "max_shutdown_workers: 0 is not positive".
+func (e ConfigErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		if err.Parameter == "" {
+			messages = append(messages, err.Message)
+		} else {
+			messages = append(messages, err.Parameter+": "+err.Message)
+		}
+	}
+	return "invalid configuration: " + strings.Join(messages, "; ")
+}
+
+// MarshalJSON encodes the ConfigErrors as a list of parameters and messages.
+func (e ConfigErrors) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]ConfigError(e))
+}
+
+// parameter is a configuration parameter of the Reaper that can be changed at runtime.
+type parameter struct {
+	get   func(r *Reaper) any                                // get returns the JSON value of the parameter.
+	parse func(value json.RawMessage) (func(*Reaper), error) // parse returns a change setting the valid value.
+}
+
+// Configuration parameters by name, the names of the environment variables in lower case where they match.
+var parameters = map[string]parameter{
+	"interval": {
+		get:   func(r *Reaper) any { return r.interval.String() },
+		parse: parameterOf(decodeDuration, checkPositive, func(r *Reaper, v time.Duration) { r.interval = v }),
+	},
+	"max_shutdown_workers": {
+		get:   func(r *Reaper) any { return r.maxShutdownWorkers },
+		parse: parameterOf(decodeValue[int], checkPositive, func(r *Reaper, v int) { r.maxShutdownWorkers = v }),
+	},
+	"available_memory_percent": {
+		get: func(r *Reaper) any { return r.availableMemoryPercent },
+		parse: parameterOf(decodeValue[int], checkPercent,
+			func(r *Reaper, v int) { r.availableMemoryPercent = v }),
+	},
+	"available_memory_bytes": {
+		get:   func(r *Reaper) any { return r.availableMemoryBytes },
+		parse: parameterOf(decodeBytes, checkAny, func(r *Reaper, v uint64) { r.availableMemoryBytes = v }),
+	},
+	"recovery_memory_percent": {
+		get: func(r *Reaper) any { return r.recoveryMemoryPercent },
+		parse: parameterOf(decodeValue[int], checkPercent,
+			func(r *Reaper, v int) { r.recoveryMemoryPercent = v }),
+	},
+	"recovery_memory_bytes": {
+		get:   func(r *Reaper) any { return r.recoveryMemoryBytes },
+		parse: parameterOf(decodeBytes, checkAny, func(r *Reaper, v uint64) { r.recoveryMemoryBytes = v }),
+	},
+	"memory_pressure_percent": {
+		get: func(r *Reaper) any { return r.memoryPressurePercent },
+		parse: parameterOf(decodeValue[int], checkPercent,
+			func(r *Reaper, v int) { r.memoryPressurePercent = v }),
+	},
+	"max_shutdown_age": {
+		get: func(r *Reaper) any { return r.maxShutdownAge.String() },
+		parse: parameterOf(decodeDuration, checkNonNegative,
+			func(r *Reaper, v time.Duration) { r.maxShutdownAge = v }),
+	},
+	"victim_policy": {
+		get: func(r *Reaper) any { return r.victimPolicy.Name() },
+		parse: parameterOf(decodeParsed(ParseVictimPolicy), checkAny,
+			func(r *Reaper, v VictimPolicy) { r.victimPolicy = v }),
+	},
+	"reap_mode": {
+		get:   func(r *Reaper) any { return r.reapMode.String() },
+		parse: parameterOf(decodeParsed(ParseReapMode), checkAny, func(r *Reaper, v ReapMode) { r.reapMode = v }),
+	},
+	"generation_gap": {
+		get: func(r *Reaper) any { return r.generationGap.String() },
+		parse: parameterOf(decodeDuration, checkPositive,
+			func(r *Reaper, v time.Duration) { r.generationGap = v }),
+	},
+	"dry_run": {
+		get:   func(r *Reaper) any { return r.dryRun },
+		parse: parameterOf(decodeValue[bool], checkAny, func(r *Reaper, v bool) { r.dryRun = v }),
+	},
+}
+
+// parameterOf returns the parse function of a parameter, which decodes and checks the value.
+func parameterOf[T any](
+	decode func(json.RawMessage) (T, error), check func(T) error, set func(*Reaper, T),
+) func(json.RawMessage) (func(*Reaper), error) {
+	return func(value json.RawMessage) (func(*Reaper), error) {
+		v, err := decode(value)
+		if err != nil {
+			return nil, err
+		}
+		if err := check(v); err != nil {
+			return nil, err
+		}
+		return func(r *Reaper) { set(r, v) }, nil
+	}
+}
+
+// decodeValue decodes the JSON value of the type.
+func decodeValue[T any](value json.RawMessage) (T, error) {
+	var v T
+	err := json.Unmarshal(value, &v)
+	return v, err
+}
+
+// decodeParsed returns a function decoding a JSON string with the parser, e.g. ParseReapMode.
+func decodeParsed[T any](parser func(string) (T, error)) func(json.RawMessage) (T, error) {
+	return func(value json.RawMessage) (T, error) {
+		s, err := decodeValue[string](value)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		return parser(s)
+	}
+}
+
+// decodeDuration decodes a JSON string of a duration, e.g. "30s".
+var decodeDuration = decodeParsed(time.ParseDuration)
+
+// decodeBytes decodes a JSON number of bytes or a JSON string of a Kubernetes-style quantity, e.g. "512Mi".
+func decodeBytes(value json.RawMessage) (uint64, error) {
+	if v, err := decodeValue[uint64](value); err == nil {
+		return v, nil
+	}
+	return decodeParsed(env.ParseBytes)(value)
+}
+
+// checkAny accepts any value.
+func checkAny[T any](T) error {
+	return nil
+}
+
+// checkPositive returns error if the value is not positive.
+func checkPositive[T int | time.Duration](v T) error {
+	if v <= 0 {
+		return fmt.Errorf("%v is not positive", v)
+	}
+	return nil
+}
+
+// checkNonNegative returns error if the value is negative.
+func checkNonNegative[T int | time.Duration](v T) error {
+	if v < 0 {
+		return fmt.Errorf("%v is negative", v)
+	}
+	return nil
+}
+
+// checkPercent returns error if the percent is not within 0 and 100.
+func checkPercent(v int) error {
+	if v < 0 || v > 100 {
+		return fmt.Errorf("%v is not within 0 and 100", v)
+	}
+	return nil
+}
+
+// configValue is the value of a configuration parameter and its source.
+type configValue struct {
+	Value  any          `json:"value"`
+	Source ConfigSource `json:"source"`
+}
+
+// view is the state of the Reaper reported by MarshalJSON and Tree, guarded by its own mutex, so that the reports
+// never wait for a run in progress.
+type view struct {
+	mu            sync.Mutex
+	config        map[string]configValue
+	shutdownSince map[workerKey]time.Time // Replaced, not changed, by each run.
+}
+
+// updateConfigView updates the reported configuration parameters, while the caller holds the mutex of the Reaper
+// or creates it. The one-off overrides of Reap are not reported.
+func (r *Reaper) updateConfigView() {
+	config := make(map[string]configValue, len(parameters))
+	for name, p := range parameters {
+		config[name] = configValue{Value: p.get(r), Source: r.sources[name]}
+	}
+	r.view.mu.Lock()
+	defer r.view.mu.Unlock()
+	r.view.config = config
+}
+
+// setShutdownSince sets the times when the Reaper first saw each worker shutting down, while the caller holds the
+// mutex of the Reaper.
+func (r *Reaper) setShutdownSince(shutdownSince map[workerKey]time.Time) {
+	r.shutdownSince = shutdownSince
+	r.view.mu.Lock()
+	defer r.view.mu.Unlock()
+	r.view.shutdownSince = shutdownSince
+}
+
+// MarshalJSON encodes the configuration parameters of the Reaper with their values and sources,
+// e.g. {"max_shutdown_workers": {"value": 5, "source": "env"}}. Does not wait for a run in progress.
+func (r *Reaper) MarshalJSON() ([]byte, error) {
+	r.view.mu.Lock()
+	defer r.view.mu.Unlock()
+	return json.Marshal(r.view.config)
+}
+
+// Patch changes the configuration parameters of the JSON object at runtime, e.g. {"max_shutdown_workers": 8}.
+// The values are checked as by NewReaper and applied between runs. Returns ConfigErrors if any value is invalid,
+// in which case no value is applied.
+func (r *Reaper) Patch(body json.RawMessage) error {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(body, &values); err != nil {
+		return ConfigErrors{{Message: err.Error()}}
+	}
+	if len(values) == 0 {
+		return ConfigErrors{{Message: "no parameters"}}
+	}
+
+	names := slices.Sorted(maps.Keys(values))
+	var changes []func(*Reaper)
+	var errs ConfigErrors
+	for _, name := range names {
+		p, ok := parameters[name]
+		if !ok {
+			errs = append(errs, ConfigError{Parameter: name, Message: "unknown parameter"})
+			continue
+		}
+		change, err := p.parse(values[name])
+		if err != nil {
+			errs = append(errs, ConfigError{Parameter: name, Message: err.Error()})
+			continue
+		}
+		changes = append(changes, change)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sources == nil {
+		r.sources = make(map[string]ConfigSource)
+	}
+	for i, change := range changes {
+		change(r)
+		r.sources[names[i]] = SourceAPI
+		log.Warningf("Changed configuration parameter %v to %v", names[i], parameters[names[i]].get(r))
+	}
+	r.updateConfigView()
+	return nil
+}
@@ -0,0 +1,140 @@
+package reaper
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigSource_String(t *testing.T) {
+	assert.Equal(t, "default", SourceDefault.String())
+	assert.Equal(t, "env", SourceEnv.String())
+	assert.Equal(t, "nginx", SourceNginx.String())
+	assert.Equal(t, "api", SourceAPI.String())
+	assert.Equal(t, "ConfigSource(9)", ConfigSource(9).String())
+}
+
+func TestConfigErrors(t *testing.T) {
+	errs := ConfigErrors{{Message: "no parameters"}, {Parameter: "dry_run", Message: "unknown parameter"}}
+	assert.Equal(t, "invalid configuration: no parameters; dry_run: unknown parameter", errs.Error())
+
+	body, err := json.Marshal(errs)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"message":"no parameters"},{"parameter":"dry_run","message":"unknown parameter"}]`,
+		string(body))
+}
+
+func TestReaper_MarshalJSON(t *testing.T) {
+	r := NewReaper(30*time.Second, 5, 20, WithAvailableMemoryBytes(1<<20), WithDryRun(true),
+		WithConfigSources(map[string]ConfigSource{"interval": SourceEnv, "max_shutdown_workers": SourceNginx}))
+
+	body, err := json.Marshal(r)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"interval": {"value": "30s", "source": "env"},
+		"max_shutdown_workers": {"value": 5, "source": "nginx"},
+		"available_memory_percent": {"value": 20, "source": "default"},
+		"available_memory_bytes": {"value": 1048576, "source": "default"},
+		"recovery_memory_percent": {"value": 0, "source": "default"},
+		"recovery_memory_bytes": {"value": 0, "source": "default"},
+		"memory_pressure_percent": {"value": 0, "source": "default"},
+		"max_shutdown_age": {"value": "0s", "source": "default"},
+		"victim_policy": {"value": "oldest-first", "source": "default"},
+		"reap_mode": {"value": "worker", "source": "default"},
+		"generation_gap": {"value": "1s", "source": "default"},
+		"dry_run": {"value": true, "source": "default"}
+	}`, string(body))
+
+	t.Run("DuringRun", func(t *testing.T) {
+		// A run in progress holds the mutex, e.g. while escalating the signals.
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		done := make(chan []byte)
+		go func() {
+			body, _ := json.Marshal(r)
+			done <- body
+		}()
+		select {
+		case body := <-done:
+			assert.Contains(t, string(body), `"max_shutdown_workers":{"value":5,"source":"nginx"}`)
+		case <-time.After(time.Second):
+			assert.Fail(t, "MarshalJSON waits for the run in progress")
+		}
+	})
+}
+
+func TestReaper_Patch(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr ConfigErrors
+	}{
+		{
+			name:    "InvalidJSON",
+			body:    `[1]`,
+			wantErr: ConfigErrors{{Message: "json: cannot unmarshal array"}},
+		},
+		{
+			name:    "Empty",
+			body:    `{}`,
+			wantErr: ConfigErrors{{Message: "no parameters"}},
+		},
+		{
+			name: "Invalid",
+			body: `{"max_shutdown_workers": 0, "available_memory_percent": 101, "interval": 5, "scope": "global"}`,
+			wantErr: ConfigErrors{
+				{Parameter: "available_memory_percent", Message: "101 is not within 0 and 100"},
+				{Parameter: "interval", Message: "json: cannot unmarshal number"},
+				{Parameter: "max_shutdown_workers", Message: "0 is not positive"},
+				{Parameter: "scope", Message: "unknown parameter"},
+			},
+		},
+		{
+			name: "PartlyInvalid",
+			body: `{"max_shutdown_workers": 8, "reap_mode": "all"}`,
+			wantErr: ConfigErrors{
+				{Parameter: "reap_mode", Message: `invalid reap mode: "all"`},
+			},
+		},
+		{
+			name: "Valid",
+			body: `{"interval": "10s", "max_shutdown_workers": 8, "available_memory_bytes": "1Gi",
+				"recovery_memory_bytes": 2048, "max_shutdown_age": "5m", "victim_policy": "largest-rss-first",
+				"reap_mode": "generation", "dry_run": true}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReaper(30*time.Second, 5, 0)
+			before := r.String()
+
+			err := r.Patch(json.RawMessage(tt.body))
+			if tt.wantErr != nil {
+				// Messages of JSON errors start with the expected message.
+				var errs ConfigErrors
+				assert.ErrorAs(t, err, &errs)
+				assert.Len(t, errs, len(tt.wantErr))
+				for i, want := range tt.wantErr[:min(len(errs), len(tt.wantErr))] {
+					assert.Equal(t, want.Parameter, errs[i].Parameter)
+					assert.True(t, strings.HasPrefix(errs[i].Message, want.Message), errs[i].Message)
+				}
+				assert.Equal(t, before, r.String())
+				assert.Empty(t, r.sources)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, 10*time.Second, r.Interval())
+			assert.Equal(t, 8, r.maxShutdownWorkers)
+			assert.Equal(t, uint64(1<<30), r.availableMemoryBytes)
+			assert.Equal(t, uint64(2048), r.recoveryMemoryBytes)
+			assert.Equal(t, 5*time.Minute, r.maxShutdownAge)
+			assert.Equal(t, LargestRSSFirst, r.victimPolicy)
+			assert.Equal(t, ReapGeneration, r.reapMode)
+			assert.True(t, r.dryRun)
+			assert.Equal(t, SourceAPI, r.sources["max_shutdown_workers"])
+			assert.Equal(t, SourceDefault, r.sources["generation_gap"])
+		})
+	}
+}
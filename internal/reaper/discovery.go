@@ -0,0 +1,133 @@
+package reaper
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"nginx-reaper/internal/log"
+	"nginx-reaper/internal/procps"
+	"nginx-reaper/internal/procps/option"
+	"strings"
+)
+
+// DiscoveryMode defines how the Reaper discovers master processes.
+type DiscoveryMode uint32
+
+// Discovery modes.
+const (
+	DiscoveryCmdline DiscoveryMode = iota // DiscoveryCmdline matches masters by the process titles of the profiles.
+	DiscoveryPidFile                      // DiscoveryPidFile reads masters from pid files and checks their executable.
+	DiscoveryAuto                         // DiscoveryAuto tries pid files first and falls back to process titles.
+)
+
+// Discovery mode name to DiscoveryMode mapping.
+var discoveryModes = map[string]DiscoveryMode{
+	"cmdline": DiscoveryCmdline,
+	"pidfile": DiscoveryPidFile,
+	"auto":    DiscoveryAuto,
+}
+
+// ParseDiscoveryMode converts case-insensitive string to DiscoveryMode. Returns error if invalid.
+// E.g. "pidfile" becomes DiscoveryPidFile.
+func ParseDiscoveryMode(name string) (DiscoveryMode, error) {
+	if m, ok := discoveryModes[strings.ToLower(name)]; ok {
+		return m, nil
+	}
+	return 0, fmt.Errorf("invalid discovery mode: %q", name)
+}
+
+// String returns the name of the DiscoveryMode.
+func (m DiscoveryMode) String() string {
+	for name, mode := range discoveryModes {
+		if mode == m {
+			return name
+		}
+	}
+	return fmt.Sprintf("DiscoveryMode(%d)", m)
+}
+
+// MasterDiscovery discovers the master processes of a snapshot.
+type MasterDiscovery struct {
+	Mode     DiscoveryMode // Mode of the discovery.
+	PidFiles []string      // PidFiles contain the pids of the masters, e.g. "/var/run/nginx.pid".
+	Exe      string        // Exe is the expected executable path of the masters, required to read pid files.
+}
+
+// String returns a string representation of the MasterDiscovery.
+func (d *MasterDiscovery) String() string {
+	if d.Mode == DiscoveryCmdline {
+		return d.Mode.String()
+	}
+	return fmt.Sprintf("%v %v exe %q", d.Mode, d.PidFiles, d.Exe)
+}
+
+// masters returns the masters of the profile in the snapshot that match the option.
+// The masters read from pid files are not matched against the process title of the profile, so with several
+// profiles they are managed by the first one.
+func (d *MasterDiscovery) masters(snapshot *procps.Snapshot, profile *Profile, match option.Option) []*procps.Process {
+	if d.Mode == DiscoveryCmdline {
+		return cmdlineMasters(snapshot, profile, match)
+	}
+	masters := d.pidFileMasters(snapshot, match)
+	if len(masters) == 0 && d.Mode == DiscoveryAuto {
+		return cmdlineMasters(snapshot, profile, match)
+	}
+	return masters
+}
+
+// cmdlineMasters returns the processes of the snapshot that match the master option of the profile and the option.
+// If the workers of the profile keep the command line of their master, the children of the masters are skipped.
+func cmdlineMasters(snapshot *procps.Snapshot, profile *Profile, match option.Option) []*procps.Process {
+	matched := procpsPgrep(snapshot, profile.Master, match)
+	if !profile.ForkedWorkers {
+		return matched
+	}
+	pids := make(map[int32]bool, len(matched))
+	for _, proc := range matched {
+		pids[proc.Pid] = true
+	}
+	var masters []*procps.Process
+	for _, proc := range matched {
+		if !pids[proc.Ppid()] {
+			masters = append(masters, proc)
+		}
+	}
+	return masters
+}
+
+// pidFileMasters returns the masters of the pid files that are running with the expected executable and match
+// the option, so that a process reusing the pid of a stale pid file is never a master. Failures are logged as
+// warnings, or at the debug level in DiscoveryAuto mode.
+func (d *MasterDiscovery) pidFileMasters(snapshot *procps.Snapshot, match option.Option) []*procps.Process {
+	logf := log.Warningf
+	if d.Mode == DiscoveryAuto {
+		logf = log.Debugf
+	}
+	match = option.And(option.Exe(d.Exe), match)
+
+	var masters []*procps.Process
+	for _, path := range d.PidFiles {
+		path = strings.TrimSpace(path)
+		pid, err := procpsReadPidFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Debugf("Pid file %s does not exist", path)
+			continue
+		}
+		if err != nil {
+			logf("Failed to read pid file: %v", err)
+			continue
+		}
+		master := snapshot.Get(pid)
+		if master == nil {
+			logf("Master process %d of pid file %s is not running", pid, path)
+			continue
+		}
+		if !match(master) {
+			exe, _ := master.Exe()
+			logf("Process %d of pid file %s with executable %q is not a master process", pid, path, exe)
+			continue
+		}
+		masters = append(masters, master)
+	}
+	return masters
+}
@@ -0,0 +1,187 @@
+package reaper
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/log"
+	"nginx-reaper/internal/procps"
+	"nginx-reaper/internal/procps/option"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestParseDiscoveryMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		want    DiscoveryMode
+		wantErr bool
+	}{
+		{
+			name:    "Empty",
+			mode:    "",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid",
+			mode:    "exe",
+			wantErr: true,
+		},
+		{
+			name: "Cmdline",
+			mode: "cmdline",
+			want: DiscoveryCmdline,
+		},
+		{
+			name: "PidFile",
+			mode: "PidFile",
+			want: DiscoveryPidFile,
+		},
+		{
+			name: "Auto",
+			mode: "AUTO",
+			want: DiscoveryAuto,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDiscoveryMode(tt.mode)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDiscoveryMode_String(t *testing.T) {
+	assert.Equal(t, "cmdline", DiscoveryCmdline.String())
+	assert.Equal(t, "pidfile", DiscoveryPidFile.String())
+	assert.Equal(t, "auto", DiscoveryAuto.String())
+	assert.Equal(t, "DiscoveryMode(42)", DiscoveryMode(42).String())
+}
+
+func TestMasterDiscovery_String(t *testing.T) {
+	assert.Equal(t, "cmdline", (&MasterDiscovery{PidFiles: []string{"/var/run/nginx.pid"}}).String())
+	assert.Equal(t, `pidfile [/var/run/nginx.pid] exe "/usr/sbin/nginx"`,
+		(&MasterDiscovery{Mode: DiscoveryPidFile, PidFiles: []string{"/var/run/nginx.pid"}, Exe: "/usr/sbin/nginx"}).String())
+}
+
+func TestMasterDiscovery_masters(t *testing.T) {
+	snapshot, err := procps.NewSnapshot()
+	assert.NoError(t, err)
+	current := snapshot.Get(int32(os.Getpid()))
+	exe, err := current.Exe()
+	assert.NoError(t, err)
+	cmdlineMasters := []*procps.Process{{Pid: 7}}
+
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "nginx.pid")
+	assert.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644))
+	exitedPidFile := filepath.Join(dir, "exited.pid")
+	assert.NoError(t, os.WriteFile(exitedPidFile, []byte("2147483647"), 0o644))
+	invalidPidFile := filepath.Join(dir, "invalid.pid")
+	assert.NoError(t, os.WriteFile(invalidPidFile, []byte("nginx"), 0o644))
+	missingPidFile := filepath.Join(dir, "missing.pid")
+
+	tests := []struct {
+		name      string
+		discovery *MasterDiscovery
+		match     option.Option
+		want      []*procps.Process
+		wantPgrep bool
+	}{
+		{
+			name:      "Cmdline",
+			discovery: &MasterDiscovery{PidFiles: []string{pidFile}},
+			want:      cmdlineMasters,
+			wantPgrep: true,
+		},
+		{
+			name:      "PidFile",
+			discovery: &MasterDiscovery{Mode: DiscoveryPidFile, PidFiles: []string{missingPidFile, " " + pidFile}, Exe: exe},
+			want:      []*procps.Process{current},
+		},
+		{
+			// The pid of a stale pid file was reused by a process with another executable.
+			name:      "PidFileReused",
+			discovery: &MasterDiscovery{Mode: DiscoveryPidFile, PidFiles: []string{pidFile}, Exe: "/usr/sbin/nginx"},
+		},
+		{
+			name:      "PidFileNotMatch",
+			discovery: &MasterDiscovery{Mode: DiscoveryPidFile, PidFiles: []string{pidFile}, Exe: exe},
+			match:     option.Not(matchAny.Option),
+		},
+		{
+			name: "PidFileErrors",
+			discovery: &MasterDiscovery{
+				Mode:     DiscoveryPidFile,
+				PidFiles: []string{missingPidFile, exitedPidFile, invalidPidFile},
+				Exe:      exe,
+			},
+		},
+		{
+			name:      "Auto",
+			discovery: &MasterDiscovery{Mode: DiscoveryAuto, PidFiles: []string{pidFile}, Exe: exe},
+			want:      []*procps.Process{current},
+		},
+		{
+			name:      "AutoFallback",
+			discovery: &MasterDiscovery{Mode: DiscoveryAuto, PidFiles: []string{missingPidFile}, Exe: exe},
+			want:      cmdlineMasters,
+			wantPgrep: true,
+		},
+		{
+			name:      "AutoPidFileReused",
+			discovery: &MasterDiscovery{Mode: DiscoveryAuto, PidFiles: []string{pidFile}, Exe: "/usr/sbin/nginx"},
+			want:      cmdlineMasters,
+			wantPgrep: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockProcpsPgrep := MockProcpsPgrep{}
+			mockProcpsPgrep.On("Call").Return(cmdlineMasters)
+			procpsPgrep = mockProcpsPgrep.Call
+			defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+			match := tt.match
+			if match == nil {
+				match = matchAny.Option
+			}
+			got := tt.discovery.masters(snapshot, ProfileNginx, match)
+			assert.Equal(t, tt.want, got)
+			if tt.wantPgrep {
+				mockProcpsPgrep.AssertNumberOfCalls(t, "Call", 1)
+			} else {
+				mockProcpsPgrep.AssertNotCalled(t, "Call")
+			}
+		})
+	}
+
+	t.Run("ForkedWorkers", func(t *testing.T) {
+		// Both the current process and its child match the master option, as a HAProxy master and its workers.
+		cmd := exec.Command("sleep", "100")
+		assert.NoError(t, cmd.Start())
+		defer func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		}()
+		child, err := procps.NewProcess(int32(cmd.Process.Pid))
+		assert.NoError(t, err)
+
+		mockProcpsPgrep := MockProcpsPgrep{}
+		mockProcpsPgrep.On("Call").Return([]*procps.Process{child, current}, []*procps.Process{child, current})
+		procpsPgrep = mockProcpsPgrep.Call
+		defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+		discovery := &MasterDiscovery{}
+		assert.Equal(t, []*procps.Process{current}, discovery.masters(snapshot, ProfileHAProxy, matchAny.Option))
+		assert.Equal(t, []*procps.Process{child, current}, discovery.masters(snapshot, ProfileNginx, matchAny.Option))
+	})
+}
@@ -0,0 +1,66 @@
+package reaper
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Timeout of an escalation Step if not specified.
+const defaultStepTimeout = 5 * time.Second
+
+// Step is a single step of the Escalation, a signal followed by a wait for the process to exit.
+type Step struct {
+	Signal  syscall.Signal
+	Timeout time.Duration
+}
+
+// String returns a string representation of the Step, e.g. "SIGTERM:5s".
+func (s Step) String() string {
+	return fmt.Sprintf("%s:%v", unix.SignalName(s.Signal), s.Timeout)
+}
+
+// Escalation is a sequence of signals sent to a process until it exits.
+type Escalation []Step
+
+// String returns a string representation of the Escalation, e.g. "SIGTERM:5s,SIGKILL:5s".
+func (e Escalation) String() string {
+	steps := make([]string, len(e))
+	for i, step := range e {
+		steps[i] = step.String()
+	}
+	return strings.Join(steps, ",")
+}
+
+// ParseEscalation converts comma-separated "SIGNAL[:timeout]" steps to Escalation. Returns error if invalid.
+// Signal names are case-insensitive and the "SIG" prefix is optional, the timeout defaults to 5s.
+// E.g. "SIGQUIT:10s,term,SIGKILL:1s".
+func ParseEscalation(value string) (Escalation, error) {
+	var escalation Escalation
+	for _, s := range strings.Split(value, ",") {
+		name, timeout, found := strings.Cut(strings.TrimSpace(s), ":")
+
+		name = strings.ToUpper(name)
+		if !strings.HasPrefix(name, "SIG") {
+			name = "SIG" + name
+		}
+		step := Step{Signal: unix.SignalNum(name), Timeout: defaultStepTimeout}
+		if step.Signal == 0 {
+			return nil, fmt.Errorf("invalid signal: %q", s)
+		}
+
+		if found {
+			var err error
+			if step.Timeout, err = time.ParseDuration(timeout); err != nil {
+				return nil, err
+			}
+			if step.Timeout < 0 {
+				return nil, fmt.Errorf("negative timeout: %q", s)
+			}
+		}
+		escalation = append(escalation, step)
+	}
+	return escalation, nil
+}
@@ -0,0 +1,85 @@
+package reaper
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/log"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseEscalation(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    Escalation
+		wantErr bool
+	}{
+		{
+			name:  "Default",
+			value: "SIGTERM:5s,SIGKILL:5s",
+			want: Escalation{
+				{Signal: syscall.SIGTERM, Timeout: 5 * time.Second},
+				{Signal: syscall.SIGKILL, Timeout: 5 * time.Second},
+			},
+		},
+		{
+			name:  "DefaultTimeout",
+			value: "SIGQUIT:10s, term, kill",
+			want: Escalation{
+				{Signal: syscall.SIGQUIT, Timeout: 10 * time.Second},
+				{Signal: syscall.SIGTERM, Timeout: defaultStepTimeout},
+				{Signal: syscall.SIGKILL, Timeout: defaultStepTimeout},
+			},
+		},
+		{
+			name:  "ZeroTimeout",
+			value: "SIGKILL:0s",
+			want: Escalation{
+				{Signal: syscall.SIGKILL},
+			},
+		},
+		{
+			name:    "Empty",
+			value:   "",
+			wantErr: true,
+		},
+		{
+			name:    "InvalidSignal",
+			value:   "SIGTERM,SIGXXX",
+			wantErr: true,
+		},
+		{
+			name:    "InvalidTimeout",
+			value:   "SIGTERM:xxx",
+			wantErr: true,
+		},
+		{
+			name:    "NegativeTimeout",
+			value:   "SIGTERM:-1s",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEscalation(tt.value)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestEscalation_String(t *testing.T) {
+	t.Run("String", func(t *testing.T) {
+		e := Escalation{
+			{Signal: syscall.SIGQUIT, Timeout: 10 * time.Second},
+			{Signal: syscall.SIGKILL, Timeout: 1500 * time.Millisecond},
+		}
+		assert.Equal(t, "SIGQUIT:10s,SIGKILL:1.5s", e.String())
+	})
+}
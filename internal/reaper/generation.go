@@ -0,0 +1,85 @@
+package reaper
+
+import (
+	"cmp"
+	"fmt"
+	"nginx-reaper/internal/procps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Maximum gap between the creation times of consecutive workers of a generation if not specified.
+const defaultGenerationGap = time.Second
+
+// ReapMode defines whether the Reaper terminates single workers or whole generations of workers.
+type ReapMode uint32
+
+// Reap modes.
+const (
+	ReapWorker     ReapMode = iota // ReapWorker terminates one worker at a time in the order of the victim policy.
+	ReapGeneration                 // ReapGeneration terminates all workers of the oldest generation at once.
+)
+
+// Reap mode name to ReapMode mapping.
+var reapModes = map[string]ReapMode{
+	"worker":     ReapWorker,
+	"generation": ReapGeneration,
+}
+
+// ParseReapMode converts case-insensitive string to ReapMode. Returns error if invalid.
+// E.g. "generation" becomes ReapGeneration.
+func ParseReapMode(name string) (ReapMode, error) {
+	if m, ok := reapModes[strings.ToLower(name)]; ok {
+		return m, nil
+	}
+	return 0, fmt.Errorf("invalid reap mode: %q", name)
+}
+
+// String returns the name of the ReapMode.
+func (m ReapMode) String() string {
+	for name, mode := range reapModes {
+		if mode == m {
+			return name
+		}
+	}
+	return fmt.Sprintf("ReapMode(%d)", m)
+}
+
+// generation is a group of shutting down workers of a master created by the same configuration reload.
+type generation struct {
+	owner
+	workers []*procps.Process // Workers sorted by creation time.
+}
+
+// createTime returns the creation time of the oldest worker of the generation in milliseconds since the epoch.
+func (g *generation) createTime() int64 {
+	return g.workers[0].CreateTime()
+}
+
+// rss returns the total resident set size of the workers of the generation in bytes.
+func (g *generation) rss() uint64 {
+	var rss uint64
+	for _, worker := range g.workers {
+		rss += worker.RSS()
+	}
+	return rss
+}
+
+// generationsOf clusters the workers of a master into generations sorted from the oldest to the newest.
+// A worker created more than the gap after the previous worker starts a new generation.
+func generationsOf(workers []*procps.Process, owner owner, gap time.Duration) []*generation {
+	sorted := slices.Clone(workers)
+	slices.SortStableFunc(sorted, func(a, b *procps.Process) int {
+		return cmp.Compare(a.CreateTime(), b.CreateTime())
+	})
+	var generations []*generation
+	for i, worker := range sorted {
+		if i == 0 || worker.CreateTime()-sorted[i-1].CreateTime() > gap.Milliseconds() {
+			generations = append(generations, &generation{owner: owner})
+		}
+		last := generations[len(generations)-1]
+		last.workers = append(last.workers, worker)
+	}
+	return generations
+}
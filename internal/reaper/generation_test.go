@@ -0,0 +1,109 @@
+package reaper
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/log"
+	"nginx-reaper/internal/procps"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// startGenerations starts sleep processes as workers of two generations, two workers created together and one
+// worker created 700ms later. Returns the workers sorted by creation time.
+func startGenerations(t *testing.T) []*procps.Process {
+	var workers []*procps.Process
+	for i := 0; i < 3; i++ {
+		if i == 2 {
+			time.Sleep(700 * time.Millisecond)
+		}
+		cmd := exec.Command("sleep", "100")
+		assert.NoError(t, cmd.Start())
+		t.Cleanup(func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		})
+		// Read the worker once it executes sleep and has resident memory.
+		var worker *procps.Process
+		assert.Eventually(t, func() bool {
+			var err error
+			worker, err = procps.NewProcess(int32(cmd.Process.Pid))
+			return err == nil && worker.Name() == "sleep" && worker.RSS() > 0
+		}, time.Second, time.Millisecond)
+		workers = append(workers, worker)
+	}
+	return workers
+}
+
+func TestParseReapMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		want    ReapMode
+		wantErr bool
+	}{
+		{
+			name:    "Empty",
+			mode:    "",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid",
+			mode:    "master",
+			wantErr: true,
+		},
+		{
+			name: "Worker",
+			mode: "worker",
+			want: ReapWorker,
+		},
+		{
+			name: "Generation",
+			mode: "Generation",
+			want: ReapGeneration,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReapMode(tt.mode)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestReapMode_String(t *testing.T) {
+	assert.Equal(t, "worker", ReapWorker.String())
+	assert.Equal(t, "generation", ReapGeneration.String())
+	assert.Equal(t, "ReapMode(42)", ReapMode(42).String())
+}
+
+func TestGenerationsOf(t *testing.T) {
+	workers := startGenerations(t)
+	owner := owner{master: 7, profile: ProfileNginx}
+	reversed := []*procps.Process{workers[2], workers[1], workers[0]}
+
+	t.Run("Generations", func(t *testing.T) {
+		got := generationsOf(reversed, owner, 300*time.Millisecond)
+		assert.Len(t, got, 2)
+		assert.ElementsMatch(t, workers[:2], got[0].workers)
+		assert.Equal(t, workers[2:], got[1].workers)
+		assert.Equal(t, owner, got[1].owner)
+		assert.Equal(t, min(workers[0].CreateTime(), workers[1].CreateTime()), got[0].createTime())
+		assert.Equal(t, workers[0].RSS()+workers[1].RSS(), got[0].rss())
+		assert.Equal(t, reversed[0], workers[2], "workers are not sorted in place")
+	})
+	t.Run("OneGeneration", func(t *testing.T) {
+		got := generationsOf(reversed, owner, 10*time.Second)
+		assert.Len(t, got, 1)
+		assert.Len(t, got[0].workers, 3)
+	})
+	t.Run("Empty", func(t *testing.T) {
+		assert.Empty(t, generationsOf(nil, owner, time.Second))
+	})
+}
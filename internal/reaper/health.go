@@ -0,0 +1,168 @@
+package reaper
+
+import (
+	"fmt"
+	"nginx-reaper/internal/procps"
+	"nginx-reaper/internal/procps/option"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the health checks of the Reaper.
+const (
+	CheckRuns         = "runs"
+	CheckProc         = "proc"
+	CheckCgroupMemory = "cgroup_memory"
+	CheckSignal       = "signal"
+)
+
+// HealthCheck is the result of a health check of the Reaper.
+type HealthCheck struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Message string `json:"message"`
+}
+
+// HealthReport is the result of the health checks of the Reaper.
+type HealthReport []HealthCheck
+
+// Healthy returns a bool indicating whether all health checks are healthy.
+func (h HealthReport) Healthy() bool {
+	for _, check := range h {
+		if !check.Healthy {
+			return false
+		}
+	}
+	return true
+}
+
+// runTimes is the start time of the run in progress, and the time and the interval of the last completed run,
+// guarded by its own mutex, so that health checks never wait for a run in progress.
+type runTimes struct {
+	mu        sync.Mutex
+	started   time.Time // Zero if no run is in progress.
+	completed time.Time
+	interval  time.Duration
+}
+
+// start records the start of a run at the time.
+func (t *runTimes) start(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.started = now
+}
+
+// complete records the completion of a run at the time with the interval of the Reaper.
+func (t *runTimes) complete(now time.Time, interval time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.started, t.completed, t.interval = time.Time{}, now, interval
+}
+
+// Liveness checks whether the Reaper completed a run within the specified number of intervals, counted from its
+// creation until the first run, or a run is in progress for no longer than the run timeout, e.g. while workers are
+// terminated through the escalation sequence.
+func (r *Reaper) Liveness(intervals int, runTimeout time.Duration) HealthReport {
+	return HealthReport{r.checkRuns(intervals, runTimeout)}
+}
+
+// Readiness checks the runs as Liveness, and whether the Reaper can read the processes and the memory of the system
+// and the cgroups of the masters, and is permitted to signal the masters and their workers.
+func (r *Reaper) Readiness(intervals int, runTimeout time.Duration) HealthReport {
+	report := HealthReport{r.checkRuns(intervals, runTimeout)}
+
+	snapshot, err := procpsNewSnapshot()
+	if err == nil {
+		defer func() { _ = snapshot.Close() }()
+		_, _, err = procpsReadSystemMemory()
+	}
+	if err != nil {
+		return append(report,
+			HealthCheck{Name: CheckProc, Message: err.Error()},
+			HealthCheck{Name: CheckCgroupMemory, Message: "processes not read"},
+			HealthCheck{Name: CheckSignal, Message: "processes not read"},
+		)
+	}
+	report = append(report, HealthCheck{Name: CheckProc, Healthy: true, Message: "processes and memory read"})
+
+	match, err := r.match(snapshot)
+	if err != nil {
+		return append(report,
+			HealthCheck{Name: CheckCgroupMemory, Message: err.Error()},
+			HealthCheck{Name: CheckSignal, Message: err.Error()},
+		)
+	}
+	var masters, processes []*procps.Process
+	claimed := make(map[int32]bool)
+	for _, profile := range r.profiles {
+		for _, master := range r.discovery.masters(snapshot, profile, match) {
+			if !claimed[master.Pid] {
+				claimed[master.Pid] = true
+				masters = append(masters, master)
+				processes = append(processes, master)
+				processes = append(processes, procpsPgrep(snapshot, profile.Worker, option.Parent(master.Pid), match)...)
+			}
+		}
+	}
+
+	var failures []string
+	for _, master := range masters {
+		if _, err := procpsReadCgroupMemory(int(master.Pid)); err != nil {
+			failures = append(failures, fmt.Sprintf("master process %d: %v", master.Pid, err))
+		}
+	}
+	report = append(report, HealthCheck{
+		Name:    CheckCgroupMemory,
+		Healthy: len(failures) == 0,
+		Message: checkMessage(failures, len(masters), "cgroups read"),
+	})
+
+	// Signal 0 checks the permission without sending a signal.
+	failures = nil
+	for _, proc := range processes {
+		if err := procpsSignal(proc, 0); err != nil {
+			failures = append(failures, fmt.Sprintf("process %d: %v", proc.Pid, err))
+		}
+	}
+	return append(report, HealthCheck{
+		Name:    CheckSignal,
+		Healthy: len(failures) == 0,
+		Message: checkMessage(failures, len(processes), "processes permitted"),
+	})
+}
+
+// checkRuns checks whether the Reaper completed a run within the specified number of intervals, or a run is in
+// progress for no longer than the run timeout.
+func (r *Reaper) checkRuns(intervals int, runTimeout time.Duration) HealthCheck {
+	r.runs.mu.Lock()
+	started, last, interval := r.runs.started, r.runs.completed, r.runs.interval
+	r.runs.mu.Unlock()
+
+	now := timeNow()
+	if !started.IsZero() {
+		running := now.Sub(started)
+		if running > runTimeout {
+			return HealthCheck{Name: CheckRuns, Message: fmt.Sprintf("run in progress for %v, exceeds %v limit",
+				running.Round(time.Millisecond), runTimeout)}
+		}
+		return HealthCheck{Name: CheckRuns, Healthy: true, Message: fmt.Sprintf("run in progress for %v",
+			running.Round(time.Millisecond))}
+	}
+	since := now.Sub(last)
+	limit := time.Duration(intervals) * interval
+	if since > limit {
+		return HealthCheck{Name: CheckRuns, Message: fmt.Sprintf("no run completed for %v, exceeds %v limit",
+			since.Round(time.Millisecond), limit)}
+	}
+	return HealthCheck{Name: CheckRuns, Healthy: true, Message: fmt.Sprintf("run completed %v ago",
+		since.Round(time.Millisecond))}
+}
+
+// checkMessage returns the failures of a check, or the number of checked items, e.g. "2 cgroups read".
+func checkMessage(failures []string, checked int, success string) string {
+	if len(failures) > 0 {
+		return strings.Join(failures, "; ")
+	}
+	return fmt.Sprintf("%d %s", checked, success)
+}
@@ -0,0 +1,179 @@
+package reaper
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/procps"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReaper_Liveness(t *testing.T) {
+	now := time.UnixMilli(0)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	mockProcpsNewSnapshot := MockProcpsNewSnapshot{}
+	mockProcpsNewSnapshot.On("Call").Return(nil, errors.New("SnapshotError"))
+	procpsNewSnapshot = mockProcpsNewSnapshot.Call
+	defer func() { procpsNewSnapshot = procps.NewSnapshot }()
+
+	// The intervals are counted from the creation until the first run.
+	r := NewReaper(time.Second, 1, 0)
+	now = now.Add(3 * time.Second)
+	assert.Equal(t, HealthReport{{Name: CheckRuns, Healthy: true, Message: "run completed 3s ago"}}, r.Liveness(3, time.Minute))
+	now = now.Add(time.Second)
+	assert.Equal(t, HealthReport{{Name: CheckRuns, Message: "no run completed for 4s, exceeds 3s limit"}},
+		r.Liveness(3, time.Minute))
+	assert.False(t, r.Liveness(3, time.Minute).Healthy())
+
+	// A failed run completes as well, its failure is reported by the readiness checks.
+	r.run()
+	now = now.Add(time.Second)
+	assert.Equal(t, HealthReport{{Name: CheckRuns, Healthy: true, Message: "run completed 1s ago"}}, r.Liveness(3, time.Minute))
+	assert.True(t, r.Liveness(3, time.Minute).Healthy())
+}
+
+func TestReaper_LivenessRunInProgress(t *testing.T) {
+	var mu sync.Mutex
+	now := time.UnixMilli(0)
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+	timeNow = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	defer func() { timeNow = time.Now }()
+
+	// The run is in progress until the snapshot is released.
+	started, release := make(chan struct{}), make(chan struct{})
+	procpsNewSnapshot = func() (*procps.Snapshot, error) {
+		close(started)
+		<-release
+		return nil, errors.New("SnapshotError")
+	}
+	defer func() { procpsNewSnapshot = procps.NewSnapshot }()
+
+	r := NewReaper(time.Second, 1, 0)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.run()
+	}()
+	<-started
+
+	// A long run is alive beyond the intervals, up to the run timeout.
+	advance(10 * time.Second)
+	assert.Equal(t, HealthReport{{Name: CheckRuns, Healthy: true, Message: "run in progress for 10s"}},
+		r.Liveness(3, time.Minute))
+	advance(time.Minute)
+	assert.Equal(t, HealthReport{{Name: CheckRuns, Message: "run in progress for 1m10s, exceeds 1m0s limit"}},
+		r.Liveness(3, time.Minute))
+
+	close(release)
+	<-done
+	advance(time.Second)
+	assert.Equal(t, HealthReport{{Name: CheckRuns, Healthy: true, Message: "run completed 1s ago"}},
+		r.Liveness(3, time.Minute))
+}
+
+func TestReaper_Readiness(t *testing.T) {
+	masters := []*procps.Process{{Pid: 1}}
+	workers := []*procps.Process{{Pid: 2}, {Pid: 3}}
+	healthyRuns := HealthCheck{Name: CheckRuns, Healthy: true, Message: "run completed 0s ago"}
+
+	type args struct {
+		snapshotErr error
+		cgroupErr   error
+		signalErr   error
+	}
+	tests := []struct {
+		name string
+		args args
+		want HealthReport
+	}{
+		{
+			name: "Healthy",
+			want: HealthReport{
+				healthyRuns,
+				{Name: CheckProc, Healthy: true, Message: "processes and memory read"},
+				{Name: CheckCgroupMemory, Healthy: true, Message: "1 cgroups read"},
+				{Name: CheckSignal, Healthy: true, Message: "3 processes permitted"},
+			},
+		},
+		{
+			name: "ProcError",
+			args: args{
+				snapshotErr: errors.New("SnapshotError"),
+			},
+			want: HealthReport{
+				healthyRuns,
+				{Name: CheckProc, Message: "SnapshotError"},
+				{Name: CheckCgroupMemory, Message: "processes not read"},
+				{Name: CheckSignal, Message: "processes not read"},
+			},
+		},
+		{
+			name: "CgroupMemoryError",
+			args: args{
+				cgroupErr: errors.New("CgroupError"),
+			},
+			want: HealthReport{
+				healthyRuns,
+				{Name: CheckProc, Healthy: true, Message: "processes and memory read"},
+				{Name: CheckCgroupMemory, Message: "master process 1: CgroupError"},
+				{Name: CheckSignal, Healthy: true, Message: "3 processes permitted"},
+			},
+		},
+		{
+			name: "SignalError",
+			args: args{
+				signalErr: errors.New("EPERM"),
+			},
+			want: HealthReport{
+				healthyRuns,
+				{Name: CheckProc, Healthy: true, Message: "processes and memory read"},
+				{Name: CheckCgroupMemory, Healthy: true, Message: "1 cgroups read"},
+				{Name: CheckSignal, Message: "process 1: EPERM; process 2: EPERM; process 3: EPERM"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.UnixMilli(0)
+			timeNow = func() time.Time { return now }
+			defer func() { timeNow = time.Now }()
+
+			if tt.args.snapshotErr != nil {
+				mockProcpsNewSnapshot := MockProcpsNewSnapshot{}
+				mockProcpsNewSnapshot.On("Call").Return(nil, tt.args.snapshotErr)
+				procpsNewSnapshot = mockProcpsNewSnapshot.Call
+				defer func() { procpsNewSnapshot = procps.NewSnapshot }()
+			}
+
+			mockProcpsPgrep := MockProcpsPgrep{}
+			mockProcpsPgrep.On("Call").Return(masters, workers)
+			procpsPgrep = mockProcpsPgrep.Call
+			defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+			mockProcpsReadCgroupMemory := MockProcpsReadCgroupMemory{}
+			mockProcpsReadCgroupMemory.On("Call").Return(&procps.CgroupMemory{}, tt.args.cgroupErr)
+			procpsReadCgroupMemory = mockProcpsReadCgroupMemory.Call
+			defer func() { procpsReadCgroupMemory = procps.ReadCgroupMemory }()
+
+			mockProcpsSignal := MockProcpsSignal{}
+			mockProcpsSignal.On("Call").Return(tt.args.signalErr)
+			procpsSignal = mockProcpsSignal.Call
+			defer func() { procpsSignal = procps.Signal }()
+
+			got := NewReaper(time.Second, 1, 0).Readiness(3, time.Minute)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.args == args{}, got.Healthy())
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package reaper
+
+import (
+	"maps"
+	"nginx-reaper/internal/log"
+	"nginx-reaper/internal/procps"
+	"nginx-reaper/internal/procps/option"
+	"time"
+)
+
+// Option is a function type that configures optional Reaper parameters.
+type Option func(*Reaper)
+
+// WithMemoryCalculation returns an Option that sets how the available cgroup memory is calculated.
+func WithMemoryCalculation(calculation procps.MemoryCalculation) Option {
+	return func(r *Reaper) {
+		if _, err := procps.ParseMemoryCalculation(calculation.String()); err != nil {
+			log.Panicf("Invalid memory calculation %v", calculation)
+		}
+		r.memoryCalculation = calculation
+	}
+}
+
+// WithVictimPolicy returns an Option that sets the order in which shutting down Nginx workers are terminated.
+func WithVictimPolicy(policy VictimPolicy) Option {
+	return func(r *Reaper) {
+		if policy == nil {
+			log.Panicf("Nil victimPolicy")
+		}
+		r.victimPolicy = policy
+	}
+}
+
+// WithAvailableMemoryBytes returns an Option that sets the minimum available memory in bytes,
+// below which shutting down Nginx workers are terminated.
+func WithAvailableMemoryBytes(bytes uint64) Option {
+	return func(r *Reaper) {
+		r.availableMemoryBytes = bytes
+	}
+}
+
+// WithMaxShutdownAge returns an Option that sets the maximum duration a shutting down Nginx worker may drain
+// before it is terminated, measured from when the Reaper first saw it shutting down. Zero disables the limit.
+func WithMaxShutdownAge(age time.Duration) Option {
+	return func(r *Reaper) {
+		if err := checkNonNegative(age); err != nil {
+			log.Panicf("Invalid maxShutdownAge: %v", err)
+		}
+		r.maxShutdownAge = age
+	}
+}
+
+// WithEscalation returns an Option that sets the sequence of signals sent to a shutting down Nginx worker
+// until it exits.
+func WithEscalation(escalation Escalation) Option {
+	return func(r *Reaper) {
+		if len(escalation) == 0 {
+			log.Panicf("Empty escalation")
+		}
+		r.escalation = escalation
+	}
+}
+
+// WithDryRun returns an Option that enables the dry run mode, in which the Reaper makes every decision,
+// but only logs and counts the shutting down Nginx workers it would terminate.
+func WithDryRun(dryRun bool) Option {
+	return func(r *Reaper) {
+		r.dryRun = dryRun
+	}
+}
+
+// WithScope returns an Option that sets whether the limits apply to the workers of each Nginx master separately
+// or to the workers of all Nginx masters together.
+func WithScope(scope Scope) Option {
+	return func(r *Reaper) {
+		if scope != ScopeMaster && scope != ScopeGlobal {
+			log.Panicf("Invalid scope %v", scope)
+		}
+		r.scope = scope
+	}
+}
+
+// WithMemoryEvents returns an Option that enables runs triggered by memory events of the cgroup of the Nginx masters
+// between scheduled runs. Events within the debounce duration after an event-triggered run are skipped.
+func WithMemoryEvents(enabled bool, debounce time.Duration) Option {
+	return func(r *Reaper) {
+		if debounce < 0 {
+			log.Panicf("Negative debounce %v", debounce)
+		}
+		r.memoryEvents = enabled
+		r.eventDebounce = debounce
+	}
+}
+
+// WithMemoryPressure returns an Option that sets the memory pressure limit in percent of stalled time,
+// above which a shutting down Nginx worker is terminated. Zero disables the limit.
+func WithMemoryPressure(metric PressureMetric, percent int) Option {
+	return func(r *Reaper) {
+		if _, err := ParsePressureMetric(metric.String()); err != nil {
+			log.Panicf("Invalid pressure metric %v", metric)
+		}
+		if err := checkPercent(percent); err != nil {
+			log.Panicf("Invalid memoryPressurePercent: %v", err)
+		}
+		r.pressureMetric = metric
+		r.memoryPressurePercent = percent
+	}
+}
+
+// WithProcessMatch returns an Option that sets an additional match of the Nginx masters and workers, e.g. to skip
+// processes that merely contain the Nginx process titles in their arguments.
+func WithProcessMatch(spec *option.Spec) Option {
+	return func(r *Reaper) {
+		if spec == nil {
+			log.Panicf("Nil process match")
+		}
+		r.processMatch = spec
+	}
+}
+
+// WithProfiles returns an Option that sets the profiles of the process families managed by the Reaper.
+// Each master is managed by the first profile matching it, so more specific profiles must come first.
+func WithProfiles(profiles ...*Profile) Option {
+	return func(r *Reaper) {
+		if len(profiles) == 0 {
+			log.Panicf("Empty profiles")
+		}
+		for i, profile := range profiles {
+			if profile == nil || profile.Name == "" || profile.Master == nil || profile.Worker == nil {
+				log.Panicf("Invalid profile %v", profile)
+			}
+			for _, other := range profiles[:i] {
+				if other.Name == profile.Name {
+					log.Panicf("Duplicate profile %v", profile)
+				}
+			}
+		}
+		r.profiles = profiles
+	}
+}
+
+// WithMasterDiscovery returns an Option that sets how the Reaper discovers master processes.
+// Discovery by pid files requires at least one pid file and the expected executable of the masters.
+func WithMasterDiscovery(discovery *MasterDiscovery) Option {
+	return func(r *Reaper) {
+		if discovery == nil {
+			log.Panicf("Nil master discovery")
+		}
+		if discovery.Mode > DiscoveryAuto {
+			log.Panicf("Invalid master discovery mode %v", discovery.Mode)
+		}
+		if discovery.Mode != DiscoveryCmdline && len(discovery.PidFiles) == 0 {
+			log.Panicf("No pid files of master discovery %v", discovery)
+		}
+		if discovery.Mode != DiscoveryCmdline && discovery.Exe == "" {
+			log.Panicf("No executable of master discovery %v", discovery)
+		}
+		r.discovery = discovery
+	}
+}
+
+// WithCgroupFilter returns an Option that limits the Reaper to the masters and workers of a cgroup, so that the
+// processes of other containers in a shared process namespace are never touched.
+func WithCgroupFilter(filter *CgroupFilter) Option {
+	return func(r *Reaper) {
+		if filter == nil {
+			log.Panicf("Nil cgroup filter")
+		}
+		r.cgroup = filter
+	}
+}
+
+// WithReapMode returns an Option that sets whether the Reaper terminates single workers or whole generations.
+func WithReapMode(mode ReapMode) Option {
+	return func(r *Reaper) {
+		if mode != ReapWorker && mode != ReapGeneration {
+			log.Panicf("Invalid reap mode %v", mode)
+		}
+		r.reapMode = mode
+	}
+}
+
+// WithGenerationGap returns an Option that sets the maximum gap between the creation times of consecutive workers
+// of the same generation.
+func WithGenerationGap(gap time.Duration) Option {
+	return func(r *Reaper) {
+		if err := checkPositive(gap); err != nil {
+			log.Panicf("Invalid generation gap: %v", err)
+		}
+		r.generationGap = gap
+	}
+}
+
+// WithMemoryRecovery returns an Option that sets the recovery limits of the available memory in percent and bytes.
+// Once the available memory falls below its limits, shutting down Nginx workers are terminated until it is back
+// above the recovery limits, which prevents flapping around a single limit. Limits below the limits of the
+// available memory have no effect.
+func WithMemoryRecovery(percent int, bytes uint64) Option {
+	return func(r *Reaper) {
+		if err := checkPercent(percent); err != nil {
+			log.Panicf("Invalid memory recovery percent: %v", err)
+		}
+		r.recoveryMemoryPercent = percent
+		r.recoveryMemoryBytes = bytes
+	}
+}
+
+// WithConfigSources returns an Option that sets the sources of the configuration parameters by name, e.g.
+// SourceEnv for the parameters set by environment variables. The other parameters have the default source.
+func WithConfigSources(sources map[string]ConfigSource) Option {
+	return func(r *Reaper) {
+		for name := range sources {
+			if _, ok := parameters[name]; !ok {
+				log.Panicf("Invalid configuration parameter %v", name)
+			}
+		}
+		r.sources = maps.Clone(sources)
+	}
+}
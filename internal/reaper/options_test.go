@@ -0,0 +1,434 @@
+package reaper
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/procps"
+	"nginx-reaper/internal/procps/option"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithVictimPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    VictimPolicy
+		wantPanic bool
+	}{
+		{
+			name:   "LargestRSSFirst",
+			policy: LargestRSSFirst,
+		},
+		{
+			name:      "Nil",
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantPanic {
+				assert.Panics(t, func() { NewReaper(1, 1, 0, WithVictimPolicy(tt.policy)) })
+			} else {
+				r := NewReaper(1, 1, 0, WithVictimPolicy(tt.policy))
+				assert.Equal(t, tt.policy, r.victimPolicy)
+			}
+		})
+	}
+}
+
+func TestWithAvailableMemoryBytes(t *testing.T) {
+	t.Run("AvailableMemoryBytes", func(t *testing.T) {
+		r := NewReaper(1, 1, 0, WithAvailableMemoryBytes(512<<20))
+		assert.Equal(t, uint64(512<<20), r.availableMemoryBytes)
+	})
+}
+
+func TestWithMemoryCalculation(t *testing.T) {
+	tests := []struct {
+		name        string
+		calculation procps.MemoryCalculation
+		wantPanic   bool
+	}{
+		{
+			name:        "WorkingSet",
+			calculation: procps.MemoryWorkingSet,
+		},
+		{
+			name:        "Invalid",
+			calculation: 42,
+			wantPanic:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantPanic {
+				assert.Panics(t, func() { NewReaper(1, 1, 0, WithMemoryCalculation(tt.calculation)) })
+			} else {
+				r := NewReaper(1, 1, 0, WithMemoryCalculation(tt.calculation))
+				assert.Equal(t, tt.calculation, r.memoryCalculation)
+			}
+		})
+	}
+}
+
+func TestWithMaxShutdownAge(t *testing.T) {
+	tests := []struct {
+		name      string
+		age       time.Duration
+		wantPanic bool
+	}{
+		{
+			name: "Disabled",
+		},
+		{
+			name: "MaxShutdownAge",
+			age:  time.Hour,
+		},
+		{
+			name:      "Negative",
+			age:       -time.Hour,
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantPanic {
+				assert.Panics(t, func() { NewReaper(1, 1, 0, WithMaxShutdownAge(tt.age)) })
+			} else {
+				r := NewReaper(1, 1, 0, WithMaxShutdownAge(tt.age))
+				assert.Equal(t, tt.age, r.maxShutdownAge)
+			}
+		})
+	}
+}
+
+func TestWithEscalation(t *testing.T) {
+	tests := []struct {
+		name       string
+		escalation Escalation
+		wantPanic  bool
+	}{
+		{
+			name:       "Escalation",
+			escalation: Escalation{{Signal: syscall.SIGQUIT, Timeout: time.Second}},
+		},
+		{
+			name:      "Empty",
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantPanic {
+				assert.Panics(t, func() { NewReaper(1, 1, 0, WithEscalation(tt.escalation)) })
+			} else {
+				r := NewReaper(1, 1, 0, WithEscalation(tt.escalation))
+				assert.Equal(t, tt.escalation, r.escalation)
+				assert.Equal(t, 0, getCounterValueInt(r.collectorSignals, "nginx", "SIGQUIT"))
+			}
+		})
+	}
+}
+
+func TestWithDryRun(t *testing.T) {
+	t.Run("DryRun", func(t *testing.T) {
+		r := NewReaper(1, 1, 0, WithDryRun(true))
+		assert.True(t, r.dryRun)
+	})
+}
+
+func TestWithScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		scope     Scope
+		wantPanic bool
+	}{
+		{
+			name:  "Master",
+			scope: ScopeMaster,
+		},
+		{
+			name:  "Global",
+			scope: ScopeGlobal,
+		},
+		{
+			name:      "Invalid",
+			scope:     42,
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantPanic {
+				assert.Panics(t, func() { NewReaper(1, 1, 0, WithScope(tt.scope)) })
+			} else {
+				r := NewReaper(1, 1, 0, WithScope(tt.scope))
+				assert.Equal(t, tt.scope, r.scope)
+			}
+		})
+	}
+}
+
+func TestWithMemoryEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   bool
+		debounce  time.Duration
+		wantPanic bool
+	}{
+		{
+			name: "Disabled",
+		},
+		{
+			name:     "MemoryEvents",
+			enabled:  true,
+			debounce: time.Second,
+		},
+		{
+			name:      "NegativeDebounce",
+			enabled:   true,
+			debounce:  -time.Second,
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantPanic {
+				assert.Panics(t, func() { NewReaper(1, 1, 0, WithMemoryEvents(tt.enabled, tt.debounce)) })
+			} else {
+				r := NewReaper(1, 1, 0, WithMemoryEvents(tt.enabled, tt.debounce))
+				assert.Equal(t, tt.enabled, r.memoryEvents)
+				assert.Equal(t, tt.debounce, r.eventDebounce)
+			}
+		})
+	}
+}
+
+func TestWithMemoryPressure(t *testing.T) {
+	tests := []struct {
+		name      string
+		metric    PressureMetric
+		percent   int
+		wantPanic bool
+	}{
+		{
+			name: "Disabled",
+		},
+		{
+			name:    "MemoryPressure",
+			metric:  FullAvg60,
+			percent: 20,
+		},
+		{
+			name:      "InvalidMetric",
+			metric:    42,
+			percent:   20,
+			wantPanic: true,
+		},
+		{
+			name:      "NegativePercent",
+			metric:    SomeAvg10,
+			percent:   -1,
+			wantPanic: true,
+		},
+		{
+			name:      "InvalidPercent",
+			metric:    SomeAvg10,
+			percent:   101,
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantPanic {
+				assert.Panics(t, func() { NewReaper(1, 1, 0, WithMemoryPressure(tt.metric, tt.percent)) })
+			} else {
+				r := NewReaper(1, 1, 0, WithMemoryPressure(tt.metric, tt.percent))
+				assert.Equal(t, tt.metric, r.pressureMetric)
+				assert.Equal(t, tt.percent, r.memoryPressurePercent)
+			}
+		})
+	}
+}
+
+func TestWithProcessMatch(t *testing.T) {
+	spec, err := option.ParseSpec(`{"name": "nginx"}`)
+	assert.NoError(t, err)
+
+	t.Run("Default", func(t *testing.T) {
+		r := NewReaper(1, 1, 0)
+		assert.Equal(t, "{}", r.processMatch.String())
+	})
+	t.Run("ProcessMatch", func(t *testing.T) {
+		r := NewReaper(1, 1, 0, WithProcessMatch(spec))
+		assert.Equal(t, spec, r.processMatch)
+	})
+	t.Run("Nil", func(t *testing.T) {
+		assert.Panics(t, func() { NewReaper(1, 1, 0, WithProcessMatch(nil)) })
+	})
+}
+
+func TestWithProfiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		profiles  []*Profile
+		wantPanic bool
+	}{
+		{
+			name:     "Profiles",
+			profiles: []*Profile{ProfileOpenResty, ProfileNginx},
+		},
+		{
+			name:      "Empty",
+			wantPanic: true,
+		},
+		{
+			name:      "Nil",
+			profiles:  []*Profile{nil},
+			wantPanic: true,
+		},
+		{
+			name:      "NoMaster",
+			profiles:  []*Profile{{Name: "custom", Worker: ProfileNginx.Worker}},
+			wantPanic: true,
+		},
+		{
+			name:      "Duplicate",
+			profiles:  []*Profile{ProfileNginx, ProfileNginx},
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantPanic {
+				assert.Panics(t, func() { NewReaper(1, 1, 0, WithProfiles(tt.profiles...)) })
+			} else {
+				r := NewReaper(1, 1, 0, WithProfiles(tt.profiles...))
+				assert.Equal(t, tt.profiles, r.profiles)
+			}
+		})
+	}
+}
+
+func TestWithMasterDiscovery(t *testing.T) {
+	tests := []struct {
+		name      string
+		discovery *MasterDiscovery
+		wantPanic bool
+	}{
+		{
+			name:      "Cmdline",
+			discovery: &MasterDiscovery{},
+		},
+		{
+			name: "PidFile",
+			discovery: &MasterDiscovery{
+				Mode: DiscoveryPidFile, PidFiles: []string{"/var/run/nginx.pid"}, Exe: "/usr/sbin/nginx",
+			},
+		},
+		{
+			name:      "NoExe",
+			discovery: &MasterDiscovery{Mode: DiscoveryAuto, PidFiles: []string{"/var/run/nginx.pid"}},
+			wantPanic: true,
+		},
+		{
+			name:      "NoPidFiles",
+			discovery: &MasterDiscovery{Mode: DiscoveryAuto, Exe: "/usr/sbin/nginx"},
+			wantPanic: true,
+		},
+		{
+			name:      "InvalidMode",
+			discovery: &MasterDiscovery{Mode: 42, PidFiles: []string{"/var/run/nginx.pid"}},
+			wantPanic: true,
+		},
+		{
+			name:      "Nil",
+			wantPanic: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantPanic {
+				assert.Panics(t, func() { NewReaper(1, 1, 0, WithMasterDiscovery(tt.discovery)) })
+			} else {
+				r := NewReaper(1, 1, 0, WithMasterDiscovery(tt.discovery))
+				assert.Equal(t, tt.discovery, r.discovery)
+			}
+		})
+	}
+}
+
+func TestWithCgroupFilter(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		r := NewReaper(1, 1, 0)
+		assert.Equal(t, &CgroupFilter{}, r.cgroup)
+	})
+	t.Run("CgroupFilter", func(t *testing.T) {
+		filter := &CgroupFilter{Pid: 64}
+		r := NewReaper(1, 1, 0, WithCgroupFilter(filter))
+		assert.Equal(t, filter, r.cgroup)
+	})
+	t.Run("Nil", func(t *testing.T) {
+		assert.Panics(t, func() { NewReaper(1, 1, 0, WithCgroupFilter(nil)) })
+	})
+}
+
+func TestWithReapMode(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		r := NewReaper(1, 1, 0)
+		assert.Equal(t, ReapWorker, r.reapMode)
+	})
+	t.Run("Generation", func(t *testing.T) {
+		r := NewReaper(1, 1, 0, WithReapMode(ReapGeneration))
+		assert.Equal(t, ReapGeneration, r.reapMode)
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		assert.Panics(t, func() { NewReaper(1, 1, 0, WithReapMode(42)) })
+	})
+}
+
+func TestWithGenerationGap(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		r := NewReaper(1, 1, 0)
+		assert.Equal(t, time.Second, r.generationGap)
+	})
+	t.Run("GenerationGap", func(t *testing.T) {
+		r := NewReaper(1, 1, 0, WithGenerationGap(3*time.Second))
+		assert.Equal(t, 3*time.Second, r.generationGap)
+	})
+	t.Run("NonPositive", func(t *testing.T) {
+		assert.Panics(t, func() { NewReaper(1, 1, 0, WithGenerationGap(0)) })
+	})
+}
+
+func TestWithMemoryRecovery(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		r := NewReaper(1, 1, 45)
+		assert.Equal(t, 45, r.recoveryPercent())
+		assert.Equal(t, uint64(0), r.recoveryBytes())
+	})
+	t.Run("MemoryRecovery", func(t *testing.T) {
+		r := NewReaper(1, 1, 45, WithAvailableMemoryBytes(1<<30), WithMemoryRecovery(60, 2<<30))
+		assert.Equal(t, 60, r.recoveryPercent())
+		assert.Equal(t, uint64(2<<30), r.recoveryBytes())
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		assert.Panics(t, func() { NewReaper(1, 1, 0, WithMemoryRecovery(101, 0)) })
+	})
+}
+
+func TestWithConfigSources(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		r := NewReaper(1, 1, 0)
+		assert.Equal(t, SourceDefault, r.sources["interval"])
+	})
+	t.Run("ConfigSources", func(t *testing.T) {
+		sources := map[string]ConfigSource{"interval": SourceEnv}
+		r := NewReaper(1, 1, 0, WithConfigSources(sources))
+		assert.Equal(t, SourceEnv, r.sources["interval"])
+		assert.Equal(t, SourceDefault, r.sources["dry_run"])
+	})
+	t.Run("Invalid", func(t *testing.T) {
+		assert.Panics(t, func() { NewReaper(1, 1, 0, WithConfigSources(map[string]ConfigSource{"scope": SourceEnv})) })
+	})
+}
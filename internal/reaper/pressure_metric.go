@@ -0,0 +1,59 @@
+package reaper
+
+import (
+	"fmt"
+	"nginx-reaper/internal/procps"
+	"strings"
+)
+
+// PressureMetric defines which memory pressure stall average the Reaper compares against the limit.
+type PressureMetric uint32
+
+// Memory pressure metrics.
+const (
+	SomeAvg10 PressureMetric = iota // SomeAvg10 is the share of time some tasks stalled over the last 10 seconds.
+	SomeAvg60                       // SomeAvg60 is the share of time some tasks stalled over the last 60 seconds.
+	FullAvg10                       // FullAvg10 is the share of time all tasks stalled over the last 10 seconds.
+	FullAvg60                       // FullAvg60 is the share of time all tasks stalled over the last 60 seconds.
+)
+
+// PressureMetric name to PressureMetric mapping.
+var pressureMetrics = map[string]PressureMetric{
+	"some_avg10": SomeAvg10,
+	"some_avg60": SomeAvg60,
+	"full_avg10": FullAvg10,
+	"full_avg60": FullAvg60,
+}
+
+// ParsePressureMetric converts case-insensitive string to PressureMetric. Returns error if invalid.
+// E.g. "full_avg10" becomes FullAvg10.
+func ParsePressureMetric(name string) (PressureMetric, error) {
+	if m, ok := pressureMetrics[strings.ToLower(name)]; ok {
+		return m, nil
+	}
+	return 0, fmt.Errorf("invalid pressure metric: %q", name)
+}
+
+// String returns the name of the PressureMetric.
+func (m PressureMetric) String() string {
+	for name, metric := range pressureMetrics {
+		if metric == m {
+			return name
+		}
+	}
+	return fmt.Sprintf("PressureMetric(%d)", m)
+}
+
+// Value returns the value of the PressureMetric from the specified memory pressure.
+func (m PressureMetric) Value(p *procps.MemoryPressure) float64 {
+	switch m {
+	case SomeAvg60:
+		return p.SomeAvg60
+	case FullAvg10:
+		return p.FullAvg10
+	case FullAvg60:
+		return p.FullAvg60
+	default:
+		return p.SomeAvg10
+	}
+}
@@ -0,0 +1,87 @@
+package reaper
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/log"
+	"nginx-reaper/internal/procps"
+	"testing"
+)
+
+func TestParsePressureMetric(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  string
+		want    PressureMetric
+		wantErr bool
+	}{
+		{
+			name:    "Empty",
+			metric:  "",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid",
+			metric:  "some_avg300",
+			wantErr: true,
+		},
+		{
+			name:   "SomeAvg10",
+			metric: "some_avg10",
+			want:   SomeAvg10,
+		},
+		{
+			name:   "FullAvg60",
+			metric: "FULL_AVG60",
+			want:   FullAvg60,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePressureMetric(tt.metric)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPressureMetric_String(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric PressureMetric
+		want   string
+	}{
+		{
+			name:   "SomeAvg60",
+			metric: SomeAvg60,
+			want:   "some_avg60",
+		},
+		{
+			name:   "FullAvg10",
+			metric: FullAvg10,
+			want:   "full_avg10",
+		},
+		{
+			name:   "Invalid",
+			metric: 42,
+			want:   "PressureMetric(42)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.metric.String())
+		})
+	}
+}
+
+func TestPressureMetric_Value(t *testing.T) {
+	p := &procps.MemoryPressure{SomeAvg10: 1, SomeAvg60: 2, FullAvg10: 3, FullAvg60: 4}
+	assert.Equal(t, 1.0, SomeAvg10.Value(p))
+	assert.Equal(t, 2.0, SomeAvg60.Value(p))
+	assert.Equal(t, 3.0, FullAvg10.Value(p))
+	assert.Equal(t, 4.0, FullAvg60.Value(p))
+}
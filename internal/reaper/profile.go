@@ -0,0 +1,181 @@
+package reaper
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nginx-reaper/internal/procps"
+	"nginx-reaper/internal/procps/option"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Profile defines how the master, worker and draining worker processes of a process family are matched.
+type Profile struct {
+	Name   string        // Name of the Profile, used as the profile label of the metrics.
+	Master option.Option // Master matches master processes.
+	Worker option.Option // Worker matches worker processes among the children of a master.
+	// Draining matches draining workers among the workers of a master. If nil, all workers but the newest
+	// are draining, as the old processes of HAProxy in master-worker mode.
+	Draining option.Option
+	// ForkedWorkers indicates that the workers keep the command line of their master, as HAProxy, so that
+	// the processes matching Master whose parent matches Master as well are workers.
+	ForkedWorkers bool
+}
+
+// Built-in profiles. OpenResty, Tengine and freenginx keep the Nginx process titles, so their masters are told apart
+// by the name in the path of the executable, which Nginx appends to the master process title.
+var (
+	ProfileNginx = &Profile{
+		Name:     "nginx",
+		Master:   OptionNginxMaster,
+		Worker:   OptionNginxWorker,
+		Draining: OptionNginxWorkerShutdown,
+	}
+	ProfileOpenResty = titleProfile("openresty", "nginx", option.Cmdline("openresty"))
+	ProfileTengine   = titleProfile("tengine", "nginx", option.Cmdline("tengine"))
+	ProfileFreenginx = titleProfile("freenginx", "nginx", option.Cmdline("freenginx"))
+	ProfileAngie     = titleProfile("angie", "angie", nil)
+	ProfileHAProxy   = &Profile{
+		Name:          "haproxy",
+		Master:        option.And(option.Name("haproxy"), option.CmdlineRegexp(regexp.MustCompile(`\s-Ws?(\s|$)`))),
+		Worker:        option.Name("haproxy"),
+		ForkedWorkers: true,
+	}
+)
+
+// Profile name to Profile mapping of the built-in profiles.
+var profiles = map[string]*Profile{
+	ProfileNginx.Name:     ProfileNginx,
+	ProfileOpenResty.Name: ProfileOpenResty,
+	ProfileTengine.Name:   ProfileTengine,
+	ProfileFreenginx.Name: ProfileFreenginx,
+	ProfileAngie.Name:     ProfileAngie,
+	ProfileHAProxy.Name:   ProfileHAProxy,
+}
+
+// titleProfile creates a Profile matching the process titles of Nginx and its forks, e.g. "nginx: master process".
+// The master additionally matches the specified option, unless nil.
+func titleProfile(name string, title string, master option.Option) *Profile {
+	masterOptions := []option.Option{option.Cmdline(title + ": master process")}
+	if master != nil {
+		masterOptions = append(masterOptions, master)
+	}
+	return &Profile{
+		Name:     name,
+		Master:   option.And(masterOptions...),
+		Worker:   option.Cmdline(title + ": worker process"),
+		Draining: option.Cmdline(title + ": worker process is shutting down"),
+	}
+}
+
+// String returns the name of the Profile.
+func (p *Profile) String() string {
+	return p.Name
+}
+
+// title returns the name of the Profile starting with an upper case letter, e.g. "Nginx", to start log messages.
+func (p *Profile) title() string {
+	if p.Name == "" {
+		return p.Name
+	}
+	return strings.ToUpper(p.Name[:1]) + p.Name[1:]
+}
+
+// draining returns the draining workers among the workers of a master.
+func (p *Profile) draining(workers []*procps.Process) []*procps.Process {
+	if p.Draining != nil {
+		return procpsFilter(workers, p.Draining)
+	}
+	if len(workers) == 0 {
+		return nil
+	}
+	newest := slices.MaxFunc(workers, func(a, b *procps.Process) int {
+		return cmp.Compare(a.CreateTime(), b.CreateTime())
+	})
+	var draining []*procps.Process
+	for _, worker := range workers {
+		if worker != newest {
+			draining = append(draining, worker)
+		}
+	}
+	return draining
+}
+
+// ParseProfiles converts a comma-separated list of case-insensitive profile names to profiles, looking up
+// the custom profiles first and then the built-in profiles. Returns error if invalid.
+// E.g. "openresty,nginx" becomes [ProfileOpenResty, ProfileNginx].
+func ParseProfiles(names string, custom ...*Profile) ([]*Profile, error) {
+	var result []*Profile
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		i := slices.IndexFunc(custom, func(p *Profile) bool { return p.Name == name })
+		profile, ok := profiles[name]
+		if i >= 0 {
+			profile, ok = custom[i], true
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid profile: %q", name)
+		}
+		if slices.Contains(result, profile) {
+			return nil, fmt.Errorf("duplicate profile: %q", name)
+		}
+		result = append(result, profile)
+	}
+	return result, nil
+}
+
+// ParseCustomProfiles parses a JSON list of user-defined profiles. Returns error if invalid.
+// Each profile has a name and process specifications of option.ParseSpec for the master, the workers and
+// the draining workers, e.g. [{"name": "myproxy", "master": {"cmdline": "myproxy: master"},
+// "worker": {"cmdline": "myproxy: worker"}, "draining": {"cmdline": "myproxy: worker draining"}}].
+// Without the draining specification, all workers but the newest are draining.
+func ParseCustomProfiles(text string) ([]*Profile, error) {
+	var specs []struct {
+		Name     string          `json:"name"`
+		Master   json.RawMessage `json:"master"`
+		Worker   json.RawMessage `json:"worker"`
+		Draining json.RawMessage `json:"draining"`
+	}
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&specs); err != nil {
+		return nil, fmt.Errorf("invalid custom profiles: %w", err)
+	}
+
+	var result []*Profile
+	for _, spec := range specs {
+		name := strings.ToLower(strings.TrimSpace(spec.Name))
+		if name == "" {
+			return nil, errors.New("invalid custom profiles: empty name")
+		}
+		if slices.ContainsFunc(result, func(p *Profile) bool { return p.Name == name }) {
+			return nil, fmt.Errorf("invalid custom profiles: duplicate profile %q", name)
+		}
+		if len(spec.Master) == 0 || len(spec.Worker) == 0 {
+			return nil, fmt.Errorf("invalid custom profile %q: master and worker are required", name)
+		}
+		profile := &Profile{Name: name}
+		for _, field := range []struct {
+			spec   json.RawMessage
+			option *option.Option
+		}{
+			{spec.Master, &profile.Master},
+			{spec.Worker, &profile.Worker},
+			{spec.Draining, &profile.Draining},
+		} {
+			if len(field.spec) == 0 {
+				continue
+			}
+			s, err := option.ParseSpec(string(field.spec))
+			if err != nil {
+				return nil, fmt.Errorf("invalid custom profile %q: %w", name, err)
+			}
+			*field.option = s.Option
+		}
+		result = append(result, profile)
+	}
+	return result, nil
+}
@@ -0,0 +1,265 @@
+package reaper
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/log"
+	"nginx-reaper/internal/procps"
+	"os"
+	"testing"
+)
+
+type fakeProcess struct {
+	cmdline string
+	name    string
+	cgroups []string
+	err     error // Error of the methods reading /proc on first use.
+}
+
+func (p *fakeProcess) Cmdline() string                { return p.cmdline }
+func (p *fakeProcess) Ppid() int32                    { return 0 }
+func (p *fakeProcess) Name() string                   { return p.name }
+func (p *fakeProcess) State() string                  { return "S" }
+func (p *fakeProcess) CreateTime() int64              { return 0 }
+func (p *fakeProcess) RSS() uint64                    { return 0 }
+func (p *fakeProcess) Exe() (string, error)           { return "", nil }
+func (p *fakeProcess) UID() (uint32, error)           { return 0, nil }
+func (p *fakeProcess) GID() (uint32, error)           { return 0, nil }
+func (p *fakeProcess) CgroupPaths() ([]string, error) { return p.cgroups, p.err }
+func (p *fakeProcess) NSPid() (int32, error)          { return 0, nil }
+
+func TestProfile_Options(t *testing.T) {
+	tests := []struct {
+		name         string
+		profile      *Profile
+		process      *fakeProcess
+		wantMaster   bool
+		wantWorker   bool
+		wantDraining bool
+	}{
+		{
+			name:       "NginxMaster",
+			profile:    ProfileNginx,
+			process:    &fakeProcess{cmdline: "nginx: master process /usr/sbin/nginx -g daemon off;", name: "nginx"},
+			wantMaster: true,
+		},
+		{
+			name:         "NginxDraining",
+			profile:      ProfileNginx,
+			process:      &fakeProcess{cmdline: "nginx: worker process is shutting down", name: "nginx"},
+			wantWorker:   true,
+			wantDraining: true,
+		},
+		{
+			name:       "OpenRestyMaster",
+			profile:    ProfileOpenResty,
+			process:    &fakeProcess{cmdline: "nginx: master process /usr/local/openresty/nginx/sbin/nginx", name: "nginx"},
+			wantMaster: true,
+		},
+		{
+			name:    "OpenRestyNginxMaster",
+			profile: ProfileOpenResty,
+			process: &fakeProcess{cmdline: "nginx: master process /usr/sbin/nginx", name: "nginx"},
+		},
+		{
+			name:       "AngieWorker",
+			profile:    ProfileAngie,
+			process:    &fakeProcess{cmdline: "angie: worker process", name: "angie"},
+			wantWorker: true,
+		},
+		{
+			name:       "HAProxyMaster",
+			profile:    ProfileHAProxy,
+			process:    &fakeProcess{cmdline: "haproxy -Ws -f /usr/local/etc/haproxy/haproxy.cfg", name: "haproxy"},
+			wantMaster: true,
+			wantWorker: true,
+		},
+		{
+			// Workers are forked by the master and keep its command line, so they are told apart by their parent.
+			name:    "HAProxyWorker",
+			profile: ProfileHAProxy,
+			process: &fakeProcess{
+				cmdline: "haproxy -Ws -f /usr/local/etc/haproxy/haproxy.cfg -sf 7 -x sockpair@5",
+				name:    "haproxy",
+			},
+			wantMaster: true,
+			wantWorker: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantMaster, tt.profile.Master(tt.process))
+			assert.Equal(t, tt.wantWorker, tt.profile.Worker(tt.process))
+			if tt.profile.Draining != nil {
+				assert.Equal(t, tt.wantDraining, tt.profile.Draining(tt.process))
+			}
+		})
+	}
+}
+
+func TestProfile_draining(t *testing.T) {
+	pid1Proc, _ := procps.NewProcess(1)
+	currentProc, _ := procps.NewProcess(int32(os.Getpid()))
+
+	t.Run("Draining", func(t *testing.T) {
+		mockProcpsFilter := MockProcpsFilter{}
+		mockProcpsFilter.On("Call").Return([]*procps.Process{currentProc})
+		procpsFilter = mockProcpsFilter.Call
+		defer func() { procpsFilter = procps.Filter }()
+
+		got := ProfileNginx.draining([]*procps.Process{pid1Proc, currentProc})
+		assert.Equal(t, []*procps.Process{currentProc}, got)
+		mockProcpsFilter.AssertNumberOfCalls(t, "Call", 1)
+	})
+	t.Run("Newest", func(t *testing.T) {
+		got := ProfileHAProxy.draining([]*procps.Process{currentProc, pid1Proc})
+		assert.Equal(t, []*procps.Process{pid1Proc}, got)
+	})
+	t.Run("Empty", func(t *testing.T) {
+		assert.Empty(t, ProfileHAProxy.draining(nil))
+	})
+}
+
+func TestProfile_title(t *testing.T) {
+	assert.Equal(t, "Nginx", ProfileNginx.title())
+	assert.Equal(t, "Haproxy", ProfileHAProxy.title())
+	assert.Equal(t, "", (&Profile{}).title())
+	assert.Equal(t, "openresty", ProfileOpenResty.String())
+}
+
+func TestParseProfiles(t *testing.T) {
+	custom := &Profile{Name: "nginx"}
+	tests := []struct {
+		name    string
+		names   string
+		custom  []*Profile
+		want    []*Profile
+		wantErr bool
+	}{
+		{
+			name:  "Nginx",
+			names: "nginx",
+			want:  []*Profile{ProfileNginx},
+		},
+		{
+			name:  "List",
+			names: " OpenResty, tengine,freenginx,angie,haproxy,nginx",
+			want: []*Profile{ProfileOpenResty, ProfileTengine, ProfileFreenginx, ProfileAngie, ProfileHAProxy,
+				ProfileNginx},
+		},
+		{
+			name:   "Custom",
+			names:  "nginx",
+			custom: []*Profile{custom},
+			want:   []*Profile{custom},
+		},
+		{
+			name:    "Empty",
+			names:   "",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid",
+			names:   "nginx,envoy",
+			wantErr: true,
+		},
+		{
+			name:    "Duplicate",
+			names:   "nginx,NGINX",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProfiles(tt.names, tt.custom...)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseCustomProfiles(t *testing.T) {
+	envoy := &fakeProcess{cmdline: "envoy -c /etc/envoy/envoy.yaml --restart-epoch 1", name: "envoy"}
+	tests := []struct {
+		name         string
+		text         string
+		wantNames    []string
+		wantDraining bool
+		wantErr      bool
+	}{
+		{
+			name: "Empty",
+			text: "[]",
+		},
+		{
+			name:      "Envoy",
+			text:      `[{"name": "Envoy", "master": {"name": "hot-restarter.py"}, "worker": {"name": "envoy"}}]`,
+			wantNames: []string{"envoy"},
+		},
+		{
+			name: "Draining",
+			text: `[{"name": "envoy", "master": {"name": "hot-restarter.py"}, "worker": {"name": "envoy"},
+				"draining": {"cmdline_regexp": "--restart-epoch [0-9]+"}}]`,
+			wantNames:    []string{"envoy"},
+			wantDraining: true,
+		},
+		{
+			name:    "InvalidJSON",
+			text:    `{"name": "envoy"}`,
+			wantErr: true,
+		},
+		{
+			name:    "UnknownField",
+			text:    `[{"name": "envoy", "master": {}, "worker": {}, "drain": {}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "NoName",
+			text:    `[{"master": {}, "worker": {}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "NoWorker",
+			text:    `[{"name": "envoy", "master": {}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "Duplicate",
+			text:    `[{"name": "envoy", "master": {}, "worker": {}}, {"name": "Envoy", "master": {}, "worker": {}}]`,
+			wantErr: true,
+		},
+		{
+			name:    "InvalidSpec",
+			text:    `[{"name": "envoy", "master": {"pid": 1}, "worker": {}}]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCustomProfiles(tt.text)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+				assert.Nil(t, got)
+				return
+			}
+			assert.NoError(t, err)
+			var names []string
+			for _, profile := range got {
+				names = append(names, profile.Name)
+				assert.False(t, profile.Master(envoy))
+				assert.True(t, profile.Worker(envoy))
+				if tt.wantDraining {
+					assert.True(t, profile.Draining(envoy))
+				} else {
+					assert.Nil(t, profile.Draining)
+				}
+			}
+			assert.Equal(t, tt.wantNames, names)
+		})
+	}
+}
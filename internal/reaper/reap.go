@@ -0,0 +1,122 @@
+package reaper
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"nginx-reaper/internal/log"
+	"nginx-reaper/internal/procps"
+	"time"
+)
+
+// Reasons of the termination decisions reported by Reap.
+const (
+	reasonMaxShutdownWorkers = "max_shutdown_workers"
+	reasonAvailableMemory    = "available_memory"
+	reasonMemoryPressure     = "memory_pressure"
+	reasonMaxShutdownAge     = "max_shutdown_age"
+)
+
+// ReapOverrides are one-off overrides of the configuration parameters for a run triggered by Reap.
+type ReapOverrides struct {
+	MaxShutdownWorkers *int  `json:"max_shutdown_workers"`
+	DryRun             *bool `json:"dry_run"`
+}
+
+// ReapDecision is the decision to terminate a shutting down worker in a run triggered by Reap.
+type ReapDecision struct {
+	Pid     int32  `json:"pid"`
+	Master  int32  `json:"master"`
+	Profile string `json:"profile"`
+	Reason  string `json:"reason"` // Reason of the decision, e.g. "available_memory".
+	Result  string `json:"result"` // LabelTerminated, LabelError or LabelDryRun.
+}
+
+// ReapReport is the report of a run triggered by Reap.
+type ReapReport struct {
+	Start              time.Time      `json:"start"`
+	DurationSeconds    float64        `json:"duration_seconds"`
+	MaxShutdownWorkers int            `json:"max_shutdown_workers"`
+	DryRun             bool           `json:"dry_run"`
+	Decisions          []ReapDecision `json:"decisions"`
+	Error              string         `json:"error,omitempty"` // Error that stopped the run, if any.
+}
+
+// Reap runs the Reaper right away, outside the schedule, with the one-off overrides of the JSON object,
+// e.g. {"max_shutdown_workers": 2, "dry_run": true}, and returns the report of the decisions made.
+// Returns ConfigErrors if the overrides are invalid, in which case the Reaper does not run.
+func (r *Reaper) Reap(body json.RawMessage) (*ReapReport, error) {
+	var overrides ReapOverrides
+	if len(bytes.TrimSpace(body)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&overrides); err != nil {
+			return nil, ConfigErrors{{Message: err.Error()}}
+		}
+	}
+	if overrides.MaxShutdownWorkers != nil {
+		if err := checkPositive(*overrides.MaxShutdownWorkers); err != nil {
+			return nil, ConfigErrors{{Parameter: "max_shutdown_workers", Message: err.Error()}}
+		}
+	}
+
+	r.collectorRuns.WithLabelValues(LabelRequest).Inc()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// The overrides apply to this run only.
+	maxShutdownWorkers, dryRun := r.maxShutdownWorkers, r.dryRun
+	defer func() { r.maxShutdownWorkers, r.dryRun = maxShutdownWorkers, dryRun }()
+	if overrides.MaxShutdownWorkers != nil {
+		r.maxShutdownWorkers = *overrides.MaxShutdownWorkers
+	}
+	if overrides.DryRun != nil {
+		r.dryRun = *overrides.DryRun
+	}
+
+	// A dry run does not change what the next runs do, e.g. when workers were first seen shutting down.
+	if r.dryRun {
+		shutdownSince, recovering := r.shutdownSince, maps.Clone(r.recovering)
+		defer func() {
+			r.setShutdownSince(shutdownSince)
+			r.recovering = recovering
+			r.setRecoveryMetric()
+		}()
+	}
+
+	report := &ReapReport{
+		Start:              timeNow(),
+		MaxShutdownWorkers: r.maxShutdownWorkers,
+		DryRun:             r.dryRun,
+		Decisions:          []ReapDecision{},
+	}
+	r.report = report
+	defer func() { r.report = nil }()
+
+	log.Warningf("Executing Nginx Reaper on request with max workers to keep %v and dry run %v",
+		r.maxShutdownWorkers, r.dryRun)
+	r.runLocked()
+	report.DurationSeconds = timeNow().Sub(report.Start).Seconds()
+	return report, nil
+}
+
+// decide adds the decision about the worker to the report of the current run, if triggered by Reap.
+func (r *Reaper) decide(worker *procps.Process, owner owner, result string) {
+	if r.report == nil {
+		return
+	}
+	r.report.Decisions = append(r.report.Decisions, ReapDecision{
+		Pid:     worker.Pid,
+		Master:  owner.master,
+		Profile: owner.profile.Name,
+		Reason:  r.reason,
+		Result:  result,
+	})
+}
+
+// reportError adds the error that stopped the current run to its report, if triggered by Reap.
+func (r *Reaper) reportError(err error) {
+	if r.report != nil {
+		r.report.Error = err.Error()
+	}
+}
@@ -0,0 +1,160 @@
+package reaper
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/procps"
+	"testing"
+)
+
+func TestReaper_Reap(t *testing.T) {
+	decisions := func(result string) []ReapDecision {
+		decision := ReapDecision{Profile: "nginx", Reason: reasonMaxShutdownWorkers, Result: result}
+		return []ReapDecision{decision, decision}
+	}
+	tests := []struct {
+		name     string
+		body     string
+		max      int
+		wantErr  bool
+		want     []ReapDecision
+		wantMax  int
+		wantDry  bool
+		wantCall int
+	}{
+		{
+			name:    "UnknownOverride",
+			body:    `{"max_workers": 1}`,
+			max:     1,
+			wantErr: true,
+		},
+		{
+			name:    "InvalidOverride",
+			body:    `{"max_shutdown_workers": 0}`,
+			max:     1,
+			wantErr: true,
+		},
+		{
+			name:     "NoOverrides",
+			max:      1,
+			want:     decisions(LabelTerminated),
+			wantMax:  1,
+			wantCall: 2,
+		},
+		{
+			name:    "Overrides",
+			body:    `{"max_shutdown_workers": 1, "dry_run": true}`,
+			max:     255,
+			want:    decisions(LabelDryRun),
+			wantMax: 1,
+			wantDry: true,
+		},
+		{
+			name:    "WithinLimit",
+			body:    ` {} `,
+			max:     255,
+			want:    []ReapDecision{},
+			wantMax: 255,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workers := []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}}
+			mockProcpsPgrep := MockProcpsPgrep{}
+			mockProcpsPgrep.On("Call").Return([]*procps.Process{{Pid: 0}}, workers)
+			procpsPgrep = mockProcpsPgrep.Call
+			defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+			mockProcpsFilter := MockProcpsFilter{}
+			mockProcpsFilter.On("Call").Return(workers)
+			procpsFilter = mockProcpsFilter.Call
+			defer func() { procpsFilter = procps.Filter }()
+
+			mockProcpsSignal := MockProcpsSignal{}
+			mockProcpsSignal.On("Call").Return(nil)
+			procpsSignal = mockProcpsSignal.Call
+			defer func() { procpsSignal = procps.Signal }()
+
+			mockProcpsWaitExit := MockProcpsWaitExit{exited: []bool{true}}
+			mockProcpsWaitExit.On("Call")
+			procpsWaitExit = mockProcpsWaitExit.Call
+			defer func() { procpsWaitExit = procps.WaitExit }()
+
+			r := NewReaper(1, tt.max, 0)
+			got, err := r.Reap(json.RawMessage(tt.body))
+			if tt.wantErr {
+				var errs ConfigErrors
+				assert.ErrorAs(t, err, &errs)
+				assert.Nil(t, got)
+				assert.Equal(t, 0, getCounterValueInt(r.collectorRuns, LabelRequest))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Decisions)
+			assert.Equal(t, tt.wantMax, got.MaxShutdownWorkers)
+			assert.Equal(t, tt.wantDry, got.DryRun)
+			assert.Empty(t, got.Error)
+			mockProcpsSignal.AssertNumberOfCalls(t, "Call", tt.wantCall)
+			assert.Equal(t, 1, getCounterValueInt(r.collectorRuns, LabelRequest))
+
+			// The overrides apply to the run triggered by Reap only.
+			assert.Equal(t, tt.max, r.maxShutdownWorkers)
+			assert.False(t, r.dryRun)
+			assert.Nil(t, r.report)
+		})
+	}
+}
+
+func TestReaper_ReapSnapshotError(t *testing.T) {
+	procpsNewSnapshot = func() (*procps.Snapshot, error) { return nil, errors.New("no processes") }
+	defer func() { procpsNewSnapshot = procps.NewSnapshot }()
+
+	got, err := NewReaper(1, 1, 0).Reap(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "no processes", got.Error)
+	assert.Empty(t, got.Decisions)
+}
+
+func TestReaper_ReapDryRunState(t *testing.T) {
+	masters, workers := []*procps.Process{{Pid: 1}}, []*procps.Process{{Pid: 2}, {Pid: 3}}
+	mockProcpsPgrep := MockProcpsPgrep{}
+	mockProcpsPgrep.On("Call").Return(masters, workers, masters, workers)
+	procpsPgrep = mockProcpsPgrep.Call
+	defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+	mockProcpsFilter := MockProcpsFilter{}
+	mockProcpsFilter.On("Call").Return(workers)
+	procpsFilter = mockProcpsFilter.Call
+	defer func() { procpsFilter = procps.Filter }()
+
+	mockNewMemoryInfo := MockNewMemoryInfo{}
+	mockNewMemoryInfo.On("Call").Return(&procps.MemoryInfo{Total: 100, Available: 10})
+	procpsNewMemoryInfo = mockNewMemoryInfo.Call
+	defer func() { procpsNewMemoryInfo = procps.NewMemoryInfo }()
+
+	mockProcpsSignal := MockProcpsSignal{}
+	mockProcpsSignal.On("Call").Return(nil)
+	procpsSignal = mockProcpsSignal.Call
+	defer func() { procpsSignal = procps.Signal }()
+
+	mockProcpsWaitExit := MockProcpsWaitExit{exited: []bool{true}}
+	mockProcpsWaitExit.On("Call")
+	procpsWaitExit = mockProcpsWaitExit.Call
+	defer func() { procpsWaitExit = procps.WaitExit }()
+
+	// The dry run neither remembers the shutting down workers nor starts the recovery.
+	r := NewReaper(1, 255, 20, WithMemoryRecovery(40, 0))
+	got, err := r.Reap(json.RawMessage(`{"dry_run": true}`))
+	assert.NoError(t, err)
+	assert.Len(t, got.Decisions, 2)
+	assert.Empty(t, r.shutdownSince)
+	assert.Empty(t, r.recovering)
+	assert.Equal(t, 0, getGaugeValue(r.collectorRecovery))
+
+	got, err = r.Reap(nil)
+	assert.NoError(t, err)
+	assert.Len(t, got.Decisions, 2)
+	assert.Len(t, r.shutdownSince, 2)
+	assert.Equal(t, map[int]bool{1: true}, r.recovering)
+}
@@ -2,11 +2,18 @@
 package reaper
 
 import (
+	"cmp"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
 	"nginx-reaper/internal/log"
+	"nginx-reaper/internal/memevents"
 	"nginx-reaper/internal/procps"
 	"nginx-reaper/internal/procps/option"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -19,6 +26,10 @@ const (
 	LabelShutdown   = "shutdown"
 	LabelError      = "error"
 	LabelTerminated = "terminated"
+	LabelDryRun     = "dry_run"
+	LabelSchedule   = "schedule"
+	LabelEvent      = "event"
+	LabelRequest    = "request"
 )
 
 var (
@@ -26,133 +37,705 @@ var (
 	OptionNginxWorker         = option.Cmdline(NginxWorker)
 	OptionNginxWorkerShutdown = option.Cmdline(NginxWorkerShutdown)
 
-	procpsFilter        = procps.Filter
-	procpsPgrep         = procps.Pgrep
-	procpsTerminate     = procps.Terminate
-	procpsNewMemoryInfo = procps.NewMemoryInfo
+	// Default process match of the masters and workers, any process.
+	matchAny, _ = option.ParseSpec("")
+
+	procpsFilter             = procps.Filter
+	procpsNewSnapshot        = procps.NewSnapshot
+	procpsPgrep              = (*procps.Snapshot).Pgrep
+	procpsReadPidFile        = procps.ReadPidFile
+	procpsSignal             = procps.Signal
+	procpsWaitExit           = procps.WaitExit
+	procpsNewMemoryInfo      = procps.NewMemoryInfo
+	procpsReadCgroupMemory   = procps.ReadCgroupMemory
+	procpsReadSystemMemory   = procps.ReadSystemMemory
+	procpsReadMemoryPressure = procps.ReadMemoryPressure
+	memeventsWatch           = func(pid int, threshold uint64) (eventWatcher, error) {
+		return memevents.Watch(pid, threshold)
+	}
+
+	timeNow = time.Now
 )
 
+// eventWatcher delivers memory events, see memevents.Watcher.
+type eventWatcher interface {
+	Events() <-chan memevents.Event
+	Err() error
+	Close() error
+}
+
+// workerKey identifies a worker process, the creation time guards against pid reuse.
+type workerKey struct {
+	pid        int32
+	createTime int64
+}
+
+// owner is the master and the profile of a shutting down worker.
+type owner struct {
+	master  int32
+	profile *Profile
+}
+
+// workerKeyOf returns the workerKey of the specified worker.
+func workerKeyOf(worker *procps.Process) workerKey {
+	return workerKey{pid: worker.Pid, createTime: worker.CreateTime()}
+}
+
 type Reaper struct {
 	interval               time.Duration
 	maxShutdownWorkers     int
 	availableMemoryPercent int
+	availableMemoryBytes   uint64
+	memoryCalculation      procps.MemoryCalculation
+	victimPolicy           VictimPolicy
+	maxShutdownAge         time.Duration
+	escalation             Escalation
+	dryRun                 bool
+	scope                  Scope
+	memoryEvents           bool
+	eventDebounce          time.Duration
+	pressureMetric         PressureMetric
+	memoryPressurePercent  int
+	processMatch           *option.Spec
+	profiles               []*Profile
+	discovery              *MasterDiscovery
+	cgroup                 *CgroupFilter
+	reapMode               ReapMode
+	generationGap          time.Duration
+	recoveryMemoryPercent  int
+	recoveryMemoryBytes    uint64
+
+	// Sources of the configuration parameters by name, the default source if missing.
+	sources map[string]ConfigSource
+
+	// Serializes scheduled and event-triggered runs and configuration changes.
+	mu sync.Mutex
+	// Watcher of memory events of the cgroup of the Nginx masters, nil until subscribed.
+	watcher eventWatcher
+
+	// Whether the memory pressure rule has already terminated a worker in the current run.
+	pressureTerminated bool
+
+	// Nginx masters by pid whose workers are terminated until the available memory recovers.
+	recovering map[int]bool
+
+	// Reason of the last termination decision, and the report of the current run triggered by Reap, if any.
+	reason string
+	report *ReapReport
+
+	// Start of the run in progress, and time and interval of the last completed run, for the health checks.
+	runs runTimes
+
+	// Configuration and draining workers reported by the HTTP endpoints.
+	view view
+
+	// Time when the Reaper first saw each worker shutting down.
+	shutdownSince map[workerKey]time.Time
 
 	// Metrics
 	collectorRunning  *prometheus.GaugeVec
 	collectorShutdown *prometheus.CounterVec
+	collectorSignals  *prometheus.CounterVec
+	collectorRuns     *prometheus.CounterVec
+
+	collectorGenerationWorkers *prometheus.GaugeVec
+	collectorGenerationAge     *prometheus.GaugeVec
+	collectorGenerationRSS     *prometheus.GaugeVec
+	collectorRecovery          prometheus.Gauge
+	collectorFreed             *prometheus.HistogramVec
 }
 
-// NewReaper creates a new Reaper instance with the specified configuration parameters.
-func NewReaper(interval time.Duration, maxShutdownWorkers int, availableMemoryPercent int) *Reaper {
-	if interval <= 0 {
-		log.Panicf("Non-positive interval %v", interval)
+// NewReaper creates a new Reaper instance with the specified configuration parameters and options.
+func NewReaper(interval time.Duration, maxShutdownWorkers int, availableMemoryPercent int, options ...Option) *Reaper {
+	if err := checkPositive(interval); err != nil {
+		log.Panicf("Invalid interval: %v", err)
 	}
-	if maxShutdownWorkers <= 0 {
-		log.Panicf("Non-positive maxShutdownWorkers %v", maxShutdownWorkers)
+	if err := checkPositive(maxShutdownWorkers); err != nil {
+		log.Panicf("Invalid maxShutdownWorkers: %v", err)
 	}
-	if availableMemoryPercent < 0 || availableMemoryPercent > 100 {
-		log.Panicf("Invalid availableMemoryPercent %v", availableMemoryPercent)
+	if err := checkPercent(availableMemoryPercent); err != nil {
+		log.Panicf("Invalid availableMemoryPercent: %v", err)
 	}
 
 	nginxReaper := &Reaper{
 		interval:               interval,
 		maxShutdownWorkers:     maxShutdownWorkers,
 		availableMemoryPercent: availableMemoryPercent,
+		victimPolicy:           OldestFirst,
+		processMatch:           matchAny,
+		profiles:               []*Profile{ProfileNginx},
+		discovery:              &MasterDiscovery{},
+		cgroup:                 &CgroupFilter{},
+		generationGap:          defaultGenerationGap,
+		escalation: Escalation{
+			{Signal: syscall.SIGTERM, Timeout: defaultStepTimeout},
+			{Signal: syscall.SIGKILL, Timeout: defaultStepTimeout},
+		},
 
 		collectorRunning: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "nginx_workers_running_current",
-				Help: "Current number of running Nginx workers by status",
+				Help: "Current number of running Nginx workers by profile and status",
 			},
-			[]string{"status"},
+			[]string{"profile", "status"},
 		),
 
 		collectorShutdown: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "nginx_workers_shutdown_total",
-				Help: "Total number of shutdown Nginx workers by status",
+				Help: "Total number of shutdown Nginx workers by profile and status",
+			},
+			[]string{"profile", "status"},
+		),
+
+		collectorSignals: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "nginx_workers_signals_total",
+				Help: "Total number of signals sent to shutting down Nginx workers by profile and signal",
+			},
+			[]string{"profile", "signal"},
+		),
+
+		collectorRuns: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "nginx_reaper_runs_total",
+				Help: "Total number of Reaper runs by trigger",
+			},
+			[]string{"trigger"},
+		),
+
+		collectorGenerationWorkers: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nginx_worker_generation_workers",
+				Help: "Current number of shutting down Nginx workers by profile, master and generation",
+			},
+			[]string{"profile", "master", "generation"},
+		),
+
+		collectorGenerationAge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nginx_worker_generation_age_seconds",
+				Help: "Current age of the oldest shutting down Nginx worker by profile, master and generation",
+			},
+			[]string{"profile", "master", "generation"},
+		),
+
+		collectorGenerationRSS: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "nginx_worker_generation_rss_bytes",
+				Help: "Current resident set size of shutting down Nginx workers by profile, master and generation",
 			},
-			[]string{"status"},
+			[]string{"profile", "master", "generation"},
+		),
+
+		collectorRecovery: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "nginx_reaper_memory_recovery",
+				Help: "Whether the Reaper terminates Nginx workers until the available memory recovers",
+			},
+		),
+
+		collectorFreed: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "nginx_workers_freed_memory_bytes",
+				Help:    "Available memory freed per terminated Nginx worker by profile",
+				Buckets: prometheus.ExponentialBuckets(1<<20, 2, 12),
+			},
+			[]string{"profile"},
 		),
 	}
 
+	for _, option := range options {
+		option(nginxReaper)
+	}
+
+	// The health checks count the intervals until the first run from the creation.
+	nginxReaper.runs.complete(timeNow(), nginxReaper.interval)
+
 	// Initialize Prometheus metrics to zero values.
-	nginxReaper.collectorRunning.WithLabelValues(LabelActive).Add(0)
-	nginxReaper.collectorRunning.WithLabelValues(LabelShutdown).Add(0)
-	nginxReaper.collectorShutdown.WithLabelValues(LabelError).Add(0)
-	nginxReaper.collectorShutdown.WithLabelValues(LabelTerminated).Add(0)
+	for _, profile := range nginxReaper.profiles {
+		nginxReaper.collectorRunning.WithLabelValues(profile.Name, LabelActive).Add(0)
+		nginxReaper.collectorRunning.WithLabelValues(profile.Name, LabelShutdown).Add(0)
+		nginxReaper.collectorShutdown.WithLabelValues(profile.Name, LabelError).Add(0)
+		nginxReaper.collectorShutdown.WithLabelValues(profile.Name, LabelTerminated).Add(0)
+		nginxReaper.collectorShutdown.WithLabelValues(profile.Name, LabelDryRun).Add(0)
+		for _, step := range nginxReaper.escalation {
+			nginxReaper.collectorSignals.WithLabelValues(profile.Name, unix.SignalName(step.Signal)).Add(0)
+		}
+	}
+	nginxReaper.collectorRuns.WithLabelValues(LabelSchedule).Add(0)
+	nginxReaper.collectorRuns.WithLabelValues(LabelEvent).Add(0)
+	nginxReaper.collectorRuns.WithLabelValues(LabelRequest).Add(0)
 
+	nginxReaper.updateConfigView()
 	return nginxReaper
 }
 
 // Interval returns the interval at which the Reaper runs.
 func (r *Reaper) Interval() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	return r.interval
 }
 
 // String returns a string representation of the Reaper.
 func (r *Reaper) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	return fmt.Sprintf(
-		"Nginx Reaper with configuration: interval %v, max workers to keep %v, target available memory %v%%",
-		r.interval, r.maxShutdownWorkers, r.availableMemoryPercent,
+		"Nginx Reaper with configuration: interval %v, max workers to keep %v, "+
+			"target available memory %v%% and %v bytes by %v, victim policy %v, max shutdown age %v, escalation %v, "+
+			"dry run %v, scope %v, memory events %v with %v debounce, memory pressure %v limit %v%%, process match %v, profiles %v, "+
+			"master discovery %v, cgroup %v, reap mode %v with %v generation gap, "+
+			"memory recovery %v%% and %v bytes",
+		r.interval, r.maxShutdownWorkers, r.availableMemoryPercent, r.availableMemoryBytes, r.memoryCalculation,
+		r.victimPolicy.Name(),
+		r.maxShutdownAge, r.escalation, r.dryRun, r.scope, r.memoryEvents, r.eventDebounce,
+		r.pressureMetric, r.memoryPressurePercent, r.processMatch, r.profiles, r.discovery, r.cgroup,
+		r.reapMode, r.generationGap, r.recoveryPercent(), r.recoveryBytes(),
 	)
 }
 
 // Metrics returns a slice of Prometheus collectors managed by the Reaper.
 func (r *Reaper) Metrics() []prometheus.Collector {
-	return []prometheus.Collector{r.collectorRunning, r.collectorShutdown}
+	return []prometheus.Collector{
+		r.collectorRunning, r.collectorShutdown, r.collectorSignals, r.collectorRuns,
+		r.collectorGenerationWorkers, r.collectorGenerationAge, r.collectorGenerationRSS, r.collectorRecovery,
+		r.collectorFreed,
+	}
 }
 
-// Run executes the Reaper logic.
+// Run executes the Reaper logic on schedule.
 func (r *Reaper) Run() bool {
-	for _, master := range procpsPgrep(OptionNginxMaster) {
+	r.collectorRuns.WithLabelValues(LabelSchedule).Inc()
+	return r.run()
+}
+
+// run executes the Reaper logic, one run at a time.
+func (r *Reaper) run() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.runLocked()
+}
+
+// runLocked executes the Reaper logic while the caller holds the mutex.
+func (r *Reaper) runLocked() bool {
+	r.runs.start(timeNow())
+	defer func() { r.runs.complete(timeNow(), r.interval) }()
+
+	now := timeNow()
+	r.pressureTerminated = false
+	shutdownSince := make(map[workerKey]time.Time)
 
-		workers := procpsPgrep(OptionNginxWorker, option.Parent(master.Pid))
-		workersShutdown := procpsFilter(workers, OptionNginxWorkerShutdown)
+	// Master and profile of each shutting down worker, and groups of workers sharing the same limits.
+	owners := make(map[*procps.Process]owner)
+	var groups [][]*procps.Process
+	active := make(map[*Profile]int)
+	shutdown := make(map[*Profile]int)
 
-		r.collectorRunning.WithLabelValues(LabelActive).Set(float64(len(workers) - len(workersShutdown)))
-		r.collectorRunning.WithLabelValues(LabelShutdown).Set(float64(len(workersShutdown)))
+	// Read each process once, all masters and workers of the run are matched against the same snapshot.
+	// Matched processes are signaled through their pidfds until the snapshot is closed at the end of the run.
+	snapshot, err := procpsNewSnapshot()
+	if err != nil {
+		log.Errorf("Failed to read processes: %v", err)
+		r.reportError(err)
+		return true
+	}
+	defer func() { _ = snapshot.Close() }()
 
-		// Maybe terminate workers.
-		for i, l := 0, len(workersShutdown); i < l && r.shouldTerminate(int(master.Pid), l-i); i++ {
-			if i == 0 {
-				// Sort workers by creation time once, to terminate the oldest first.
-				procps.SortByCreateTime(workersShutdown)
+	match, err := r.match(snapshot)
+	if err != nil {
+		log.Errorf("Failed to match processes of cgroup %v: %v", r.cgroup, err)
+		r.reportError(err)
+		return true
+	}
+
+	// Generations of the previous run that are no longer running are forgotten.
+	r.collectorGenerationWorkers.Reset()
+	r.collectorGenerationAge.Reset()
+	r.collectorGenerationRSS.Reset()
+
+	// Each master is managed by the first matching profile.
+	claimed := make(map[int32]bool)
+	for _, profile := range r.profiles {
+		masters := r.discovery.masters(snapshot, profile, match)
+		for _, master := range masters {
+			if claimed[master.Pid] {
+				continue
+			}
+			claimed[master.Pid] = true
+			if r.memoryEvents && r.watcher == nil {
+				r.watch(int(master.Pid))
 			}
-			worker := workersShutdown[i]
-			log.Warningf("Terminating nginx worker process %v", procps.NewProcessInfo(worker))
-			err := procpsTerminate(worker)
-			if err == nil {
-				r.collectorShutdown.WithLabelValues(LabelTerminated).Inc()
-				time.Sleep(1 * time.Second)
+
+			workers := procpsPgrep(snapshot, profile.Worker, option.Parent(master.Pid), match)
+			workersShutdown := profile.draining(workers)
+
+			active[profile] += len(workers) - len(workersShutdown)
+			shutdown[profile] += len(workersShutdown)
+			r.setGenerationMetrics(generationsOf(workersShutdown, owner{master.Pid, profile}, r.generationGap), now)
+
+			// Remember when the workers were first seen shutting down, and terminate workers draining for too long.
+			for _, worker := range workersShutdown {
+				owners[worker] = owner{master: master.Pid, profile: profile}
+				key := workerKeyOf(worker)
+				if since, ok := r.shutdownSince[key]; ok {
+					shutdownSince[key] = since
+				} else {
+					shutdownSince[key] = now
+				}
+			}
+			workersShutdown = r.terminateExpired(snapshot, workersShutdown, owner{master.Pid, profile}, shutdownSince, now)
+
+			if r.scope == ScopeGlobal && len(groups) > 0 {
+				groups[0] = append(groups[0], workersShutdown...)
 			} else {
-				r.collectorShutdown.WithLabelValues(LabelError).Inc()
-				log.Errorf("Failed to terminate nginx worker process %v: %v", worker.Pid, err)
+				groups = append(groups, workersShutdown)
 			}
 		}
 	}
+
+	for _, profile := range r.profiles {
+		r.collectorRunning.WithLabelValues(profile.Name, LabelActive).Set(float64(active[profile]))
+		r.collectorRunning.WithLabelValues(profile.Name, LabelShutdown).Set(float64(shutdown[profile]))
+	}
+
+	// Maybe terminate workers.
+	for _, workers := range groups {
+		r.reap(snapshot, workers, owners)
+	}
+
+	// Forget workers that are no longer running, and the recovery of masters that are no longer running.
+	r.setShutdownSince(shutdownSince)
+	for pid := range r.recovering {
+		if !claimed[int32(pid)] {
+			delete(r.recovering, pid)
+		}
+	}
+	r.setRecoveryMetric()
 	return true
 }
 
+// setRecoveryMetric sets the metric indicating whether the workers of any master are terminated in recovery.
+func (r *Reaper) setRecoveryMetric() {
+	if len(r.recovering) > 0 {
+		r.collectorRecovery.Set(1)
+	} else {
+		r.collectorRecovery.Set(0)
+	}
+}
+
+// setGenerationMetrics sets the metrics of the generations of a master, numbered from the oldest starting at 1.
+func (r *Reaper) setGenerationMetrics(generations []*generation, now time.Time) {
+	for i, g := range generations {
+		labels := []string{g.profile.Name, strconv.Itoa(int(g.master)), strconv.Itoa(i + 1)}
+		age := now.Sub(time.UnixMilli(g.createTime()))
+		r.collectorGenerationWorkers.WithLabelValues(labels...).Set(float64(len(g.workers)))
+		r.collectorGenerationAge.WithLabelValues(labels...).Set(age.Seconds())
+		r.collectorGenerationRSS.WithLabelValues(labels...).Set(float64(g.rss()))
+	}
+}
+
+// match returns an Option that matches the masters and workers managed by the Reaper in the snapshot,
+// i.e. the processes matching the process match within the cgroup.
+func (r *Reaper) match(snapshot *procps.Snapshot) (option.Option, error) {
+	cgroupMatch, err := r.cgroup.option(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return option.And(r.processMatch.Option, cgroupMatch), nil
+}
+
+// watch subscribes to memory events of the cgroup of the specified Nginx master.
+// On failure, the next run subscribes again.
+func (r *Reaper) watch(pid int) {
+	watcher, err := memeventsWatch(pid, r.memoryThreshold(pid))
+	if err != nil {
+		log.Errorf("Failed to watch memory events of nginx master process %d: %v", pid, err)
+		return
+	}
+	r.watcher = watcher
+	go r.handleEvents(watcher)
+}
+
+// handleEvents runs the Reaper on memory events until the watcher stops.
+// Events received within eventDebounce after the end of the previous event-triggered run are skipped.
+func (r *Reaper) handleEvents(watcher eventWatcher) {
+	var last time.Time
+	for event := range watcher.Events() {
+		if timeNow().Sub(last) < r.eventDebounce {
+			log.Debugf("Skipping memory event %v within %v debounce", event, r.eventDebounce)
+			continue
+		}
+		log.Infof("Executing %v on memory event %v", r, event)
+		r.collectorRuns.WithLabelValues(LabelEvent).Inc()
+		r.run()
+		last = timeNow()
+	}
+	log.Errorf("Stopped watching memory events: %v", watcher.Err())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.watcher = nil
+}
+
+// memoryThreshold returns the cgroup memory usage in bytes above which the available memory is below
+// the target, or zero if unknown. Only cgroup v1 uses the threshold, cgroup v2 notifies memory.high and memory.max.
+func (r *Reaper) memoryThreshold(pid int) uint64 {
+	c, err := procpsReadCgroupMemory(pid)
+	if err != nil {
+		return 0
+	}
+	limit := c.Limit
+	target := max(limit/100*uint64(r.availableMemoryPercent), r.availableMemoryBytes)
+	if target == 0 || target >= limit {
+		return 0
+	}
+	return limit - target
+}
+
+// reap terminates workers in the order of the victim policy while the termination conditions are met.
+// The available memory is checked for the master of the worker to be terminated next.
+func (r *Reaper) reap(snapshot *procps.Snapshot, workers []*procps.Process, owners map[*procps.Process]owner) {
+	if len(workers) == 0 {
+		return
+	}
+	if r.reapMode == ReapGeneration {
+		r.reapGenerations(snapshot, workers, owners)
+		return
+	}
+	r.victimPolicy.Sort(workers)
+	for i, l := 0, len(workers); i < l && r.shouldTerminate(int(owners[workers[i]].master), l-i); i++ {
+		r.terminateAll(snapshot, workers[i:i+1], owners[workers[i]])
+	}
+}
+
+// reapGenerations terminates whole generations of workers from the oldest while the termination conditions are met.
+// The available memory is checked for the master of the generation to be terminated next.
+func (r *Reaper) reapGenerations(
+	snapshot *procps.Snapshot, workers []*procps.Process, owners map[*procps.Process]owner,
+) {
+	var masters []owner
+	workersOf := make(map[owner][]*procps.Process)
+	for _, worker := range workers {
+		o := owners[worker]
+		if _, ok := workersOf[o]; !ok {
+			masters = append(masters, o)
+		}
+		workersOf[o] = append(workersOf[o], worker)
+	}
+	var generations []*generation
+	for _, o := range masters {
+		generations = append(generations, generationsOf(workersOf[o], o, r.generationGap)...)
+	}
+	slices.SortStableFunc(generations, func(a, b *generation) int {
+		return cmp.Compare(a.createTime(), b.createTime())
+	})
+
+	remaining := len(workers)
+	for _, g := range generations {
+		if !r.shouldTerminate(int(g.master), remaining) {
+			return
+		}
+		log.Warningf("Terminating generation of %d %s worker processes of master process %d created at %v",
+			len(g.workers), g.profile, g.master, time.UnixMilli(g.createTime()).Format(time.RFC3339))
+		r.terminateAll(snapshot, g.workers, g.owner)
+		remaining -= len(g.workers)
+	}
+}
+
+// terminateExpired terminates workers shutting down for longer than maxShutdownAge.
+// Returns the remaining workers.
+func (r *Reaper) terminateExpired(snapshot *procps.Snapshot,
+	workers []*procps.Process, owner owner, shutdownSince map[workerKey]time.Time, now time.Time,
+) []*procps.Process {
+	if r.maxShutdownAge == 0 {
+		return workers
+	}
+	var remaining []*procps.Process
+	for _, worker := range workers {
+		age := now.Sub(shutdownSince[workerKeyOf(worker)])
+		if age > r.maxShutdownAge {
+			log.Warningf("%v worker process %d is shutting down for %v and exceeds %v limit",
+				owner.profile.title(), worker.Pid, age, r.maxShutdownAge)
+			r.reason = reasonMaxShutdownAge
+			r.terminateAll(snapshot, []*procps.Process{worker}, owner)
+		} else {
+			remaining = append(remaining, worker)
+		}
+	}
+	return remaining
+}
+
+// terminateAll terminates the specified workers of the master at once, and observes the available memory of the
+// master freed per terminated worker, from before the first signal until the terminated workers exited.
+// The workers are logged with their parents as read by the snapshot.
+func (r *Reaper) terminateAll(snapshot *procps.Snapshot, workers []*procps.Process, owner owner) {
+	if r.dryRun {
+		for _, worker := range workers {
+			r.terminate(snapshot, worker, owner.profile)
+			r.decide(worker, owner, LabelDryRun)
+		}
+		return
+	}
+
+	before := procpsNewMemoryInfo(int(owner.master), r.memoryCalculation).Available
+	results := make([]bool, len(workers))
+	var wg sync.WaitGroup
+	for i, worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = r.terminate(snapshot, worker, owner.profile)
+		}()
+	}
+	wg.Wait()
+
+	terminated := 0
+	for i, worker := range workers {
+		if results[i] {
+			terminated++
+			r.decide(worker, owner, LabelTerminated)
+		} else {
+			r.decide(worker, owner, LabelError)
+		}
+	}
+	if terminated == 0 {
+		return
+	}
+
+	// Memory allocated by other processes in the meantime may outweigh the freed memory, which counts as none.
+	after := procpsNewMemoryInfo(int(owner.master), r.memoryCalculation).Available
+	freed := uint64(0)
+	if after > before {
+		freed = (after - before) / uint64(terminated)
+	}
+	log.Infof("Available memory %d bytes freed per terminated %s worker process", freed, owner.profile)
+	for range terminated {
+		r.collectorFreed.WithLabelValues(owner.profile.Name).Observe(float64(freed))
+	}
+}
+
+// terminate terminates the specified worker of the profile and updates metrics.
+// In dry run mode, only logs and counts the worker that would be terminated.
+// Returns a bool indicating whether the worker was terminated and exited.
+func (r *Reaper) terminate(snapshot *procps.Snapshot, worker *procps.Process, profile *Profile) bool {
+	if r.dryRun {
+		log.Warningf("Would terminate %s worker process %v", profile, snapshot.ProcessInfo(worker))
+		r.collectorShutdown.WithLabelValues(profile.Name, LabelDryRun).Inc()
+		return false
+	}
+	log.Warningf("Terminating %s worker process %v", profile, snapshot.ProcessInfo(worker))
+	if err := r.escalate(worker, profile); err != nil {
+		r.collectorShutdown.WithLabelValues(profile.Name, LabelError).Inc()
+		log.Errorf("Failed to terminate %s worker process %v: %v", profile, worker.Pid, err)
+		return false
+	}
+	r.collectorShutdown.WithLabelValues(profile.Name, LabelTerminated).Inc()
+	return true
+}
+
+// escalate sends the signals of the escalation sequence to the specified worker until it exits.
+// Returns error if a signal cannot be sent or the worker is still running after the last step.
+func (r *Reaper) escalate(worker *procps.Process, profile *Profile) error {
+	for _, step := range r.escalation {
+		name := unix.SignalName(step.Signal)
+		if err := procpsSignal(worker, step.Signal); err != nil {
+			return err
+		}
+		r.collectorSignals.WithLabelValues(profile.Name, name).Inc()
+		if procpsWaitExit(worker, step.Timeout) {
+			return nil
+		}
+		log.Warningf("%v worker process %d is still running %v after %v",
+			profile.title(), worker.Pid, step.Timeout, name)
+	}
+	return fmt.Errorf("still running after %v", r.escalation)
+}
+
+// recoveryPercent returns the available memory percent up to which workers are terminated in recovery.
+func (r *Reaper) recoveryPercent() int {
+	return max(r.availableMemoryPercent, r.recoveryMemoryPercent)
+}
+
+// recoveryBytes returns the available memory in bytes up to which workers are terminated in recovery.
+func (r *Reaper) recoveryBytes() uint64 {
+	return max(r.availableMemoryBytes, r.recoveryMemoryBytes)
+}
+
+// startRecovery starts the recovery of the cgroup of the specified Nginx master, if the recovery limits are higher
+// than the limits of the available memory.
+func (r *Reaper) startRecovery(pid int) {
+	enabled := r.recoveryPercent() > r.availableMemoryPercent || r.recoveryBytes() > r.availableMemoryBytes
+	if !enabled || r.recovering[pid] {
+		return
+	}
+	if r.recovering == nil {
+		r.recovering = make(map[int]bool)
+	}
+	log.Warningf("Terminating workers of nginx master process %d until available memory recovers to %d%% and %d bytes",
+		pid, r.recoveryPercent(), r.recoveryBytes())
+	r.recovering[pid] = true
+}
+
 // shouldTerminate returns a bool indicating whether Nginx workers should be terminated.
 func (r *Reaper) shouldTerminate(pid int, workers int) bool {
 	// Check the number of workers.
 	if workers > r.maxShutdownWorkers {
 		log.Warningf("Number of nginx workers shutting down %d exceeds limit %d", workers, r.maxShutdownWorkers)
+		r.reason = reasonMaxShutdownWorkers
 		return true
 	}
 	log.Debugf("Number of nginx workers shutting down %d within limit %d", workers, r.maxShutdownWorkers)
 
-	// Check available memory.
-	m := procpsNewMemoryInfo(pid)
+	// Check available memory. In recovery, against the higher recovery limits until memory recovers.
+	m := procpsNewMemoryInfo(pid, r.memoryCalculation)
 	percent := m.AvailableMemoryPercent()
-	if percent < r.availableMemoryPercent {
-		log.Warningf("Available memory %d/%d bytes is %d%% and less than %d%% limit",
-			m.Available, m.Total, percent, r.availableMemoryPercent)
+	percentLimit, bytesLimit, limit := r.availableMemoryPercent, r.availableMemoryBytes, "limit"
+	if r.recovering[pid] {
+		percentLimit, bytesLimit, limit = r.recoveryPercent(), r.recoveryBytes(), "recovery limit"
+	}
+	if percent < percentLimit {
+		log.Warningf("Available memory %d/%d bytes is %d%% and less than %d%% %s",
+			m.Available, m.Total, percent, percentLimit, limit)
+		r.startRecovery(pid)
+		r.reason = reasonAvailableMemory
 		return true
 	}
-	log.Debugf("Available memory %d/%d bytes is %d%% and within %d%% limit",
-		m.Available, m.Total, percent, r.availableMemoryPercent)
+	log.Debugf("Available memory %d/%d bytes is %d%% and within %d%% %s",
+		m.Available, m.Total, percent, percentLimit, limit)
+
+	if m.Available < bytesLimit {
+		log.Warningf("Available memory %d/%d bytes is less than %d bytes %s",
+			m.Available, m.Total, bytesLimit, limit)
+		r.startRecovery(pid)
+		r.reason = reasonAvailableMemory
+		return true
+	}
+	log.Debugf("Available memory %d/%d bytes is within %d bytes %s",
+		m.Available, m.Total, bytesLimit, limit)
+
+	if r.recovering[pid] {
+		log.Infof("Available memory %d/%d bytes recovered for nginx master process %d", m.Available, m.Total, pid)
+		delete(r.recovering, pid)
+	}
+
+	// Check memory pressure. The averages decay slowly after a termination, so at most one worker per run.
+	if r.memoryPressurePercent > 0 && !r.pressureTerminated {
+		p, err := procpsReadMemoryPressure(pid)
+		if err != nil {
+			log.Errorf("Failed to read memory pressure: %v", err)
+			return false
+		}
+		value := r.pressureMetric.Value(p)
+		if value > float64(r.memoryPressurePercent) {
+			log.Warningf("Memory pressure %v %.2f%% exceeds %d%% limit", r.pressureMetric, value, r.memoryPressurePercent)
+			r.pressureTerminated = true
+			r.reason = reasonMemoryPressure
+			return true
+		}
+		log.Debugf("Memory pressure %v %.2f%% within %d%% limit", r.pressureMetric, value, r.memoryPressurePercent)
+	}
 
 	return false
 }
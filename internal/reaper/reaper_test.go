@@ -5,13 +5,18 @@ import (
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
-	"github.com/shirou/gopsutil/v3/process"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	stdlog "log"
 	"math"
 	"math/rand"
+	"nginx-reaper/internal/memevents"
 	"nginx-reaper/internal/procps"
 	"nginx-reaper/internal/procps/option"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -20,9 +25,9 @@ type MockProcpsPgrep struct {
 	mock.Mock
 }
 
-func (m *MockProcpsPgrep) Call(...option.Option) []*process.Process {
+func (m *MockProcpsPgrep) Call(*procps.Snapshot, ...option.Option) []*procps.Process {
 	args := m.Called()
-	return args.Get(len(m.Calls) - 1).([]*process.Process)
+	return args.Get(len(m.Calls) - 1).([]*procps.Process)
 }
 
 func TestReaper(t *testing.T) {
@@ -102,7 +107,7 @@ func TestReaper(t *testing.T) {
 				assert.Equal(t, tt.want.interval, got.Interval())
 				assert.Equal(t, tt.want.maxShutdownWorkers, got.maxShutdownWorkers)
 				assert.Equal(t, stringFrom(got), got.String())
-				assert.Equal(t, 2, len(got.Metrics()))
+				assert.Equal(t, 9, len(got.Metrics()))
 			}
 		})
 	}
@@ -110,8 +115,16 @@ func TestReaper(t *testing.T) {
 
 func stringFrom(r *Reaper) string {
 	return fmt.Sprintf(
-		"Nginx Reaper with configuration: interval %v, max workers to keep %v, target available memory %v%%",
-		r.interval, r.maxShutdownWorkers, r.availableMemoryPercent,
+		"Nginx Reaper with configuration: interval %v, max workers to keep %v, "+
+			"target available memory %v%% and %v bytes by %v, victim policy %v, max shutdown age %v, escalation %v, "+
+			"dry run %v, scope %v, memory events %v with %v debounce, memory pressure %v limit %v%%, process match %v, profiles %v, "+
+			"master discovery %v, cgroup %v, reap mode %v with %v generation gap, "+
+			"memory recovery %v%% and %v bytes",
+		r.interval, r.maxShutdownWorkers, r.availableMemoryPercent, r.availableMemoryBytes, r.memoryCalculation,
+		r.victimPolicy.Name(),
+		r.maxShutdownAge, r.escalation, r.dryRun, r.scope, r.memoryEvents, r.eventDebounce,
+		r.pressureMetric, r.memoryPressurePercent, r.processMatch, r.profiles, r.discovery, r.cgroup,
+		r.reapMode, r.generationGap, r.recoveryPercent(), r.recoveryBytes(),
 	)
 }
 
@@ -119,37 +132,63 @@ type MockProcpsFilter struct {
 	mock.Mock
 }
 
-func (m *MockProcpsFilter) Call([]*process.Process, ...option.Option) []*process.Process {
+func (m *MockProcpsFilter) Call([]*procps.Process, ...option.Option) []*procps.Process {
 	args := m.Called()
-	return args.Get(0).([]*process.Process)
+	return args.Get((len(m.Calls) - 1) % len(args)).([]*procps.Process)
 }
 
-type MockProcpsTerminate struct {
+type MockProcpsSignal struct {
 	mock.Mock
 }
 
-func (m *MockProcpsTerminate) Call(*process.Process) error {
+func (m *MockProcpsSignal) Call(*procps.Process, syscall.Signal) error {
 	args := m.Called()
 	return args.Error(0)
 }
 
+// MockProcpsWaitExit returns the exited values in turn, also to concurrent terminations.
+type MockProcpsWaitExit struct {
+	mock.Mock
+	mu     sync.Mutex
+	calls  int
+	exited []bool
+}
+
+func (m *MockProcpsWaitExit) Call(*procps.Process, time.Duration) bool {
+	m.Called()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	return m.exited[(m.calls-1)%len(m.exited)]
+}
+
 func TestReaper_Run(t *testing.T) {
 	type fields struct {
 		interval               time.Duration
 		maxShutdownWorkers     int
 		availableMemoryPercent int
+		maxShutdownAge         time.Duration
+		shutdownFor            time.Duration
+		dryRun                 bool
 	}
 	type procs struct {
-		masters         []*process.Process
-		workers         []*process.Process
-		workersShutdown []*process.Process
+		masters         []*procps.Process
+		workers         []*procps.Process
+		workersShutdown []*procps.Process
+		exited          []bool
+	}
+	type want struct {
+		terminate int
+		sigterm   int
+		sigkill   int
+		err       bool
+		dryRun    int
 	}
 	tests := []struct {
-		name    string
-		fields  fields
-		procs   procs
-		want    int
-		wantErr bool
+		name   string
+		fields fields
+		procs  procs
+		want   want
 	}{
 		{
 			name: "Terminate",
@@ -158,11 +197,15 @@ func TestReaper_Run(t *testing.T) {
 				maxShutdownWorkers: 1,
 			},
 			procs: procs{
-				masters:         []*process.Process{{Pid: 0}},
-				workers:         []*process.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}, {Pid: 0}},
-				workersShutdown: []*process.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}},
+				masters:         []*procps.Process{{Pid: 0}},
+				workers:         []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}, {Pid: 0}},
+				workersShutdown: []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}},
+				exited:          []bool{true},
+			},
+			want: want{
+				terminate: 2,
+				sigterm:   2,
 			},
-			want: 2,
 		},
 		{
 			name: "TerminateError",
@@ -171,12 +214,103 @@ func TestReaper_Run(t *testing.T) {
 				maxShutdownWorkers: 1,
 			},
 			procs: procs{
-				masters:         []*process.Process{{Pid: 0}},
-				workers:         []*process.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}, {Pid: 0}},
-				workersShutdown: []*process.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}},
+				masters:         []*procps.Process{{Pid: 0}},
+				workers:         []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}, {Pid: 0}},
+				workersShutdown: []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}},
+				exited:          []bool{true},
+			},
+			want: want{
+				terminate: 2,
+				err:       true,
+			},
+		},
+		{
+			name: "Escalate",
+			fields: fields{
+				interval:           1,
+				maxShutdownWorkers: 1,
+			},
+			procs: procs{
+				masters:         []*procps.Process{{Pid: 0}},
+				workers:         []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}, {Pid: 0}},
+				workersShutdown: []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}},
+				exited:          []bool{false, true},
+			},
+			want: want{
+				terminate: 2,
+				sigterm:   2,
+				sigkill:   2,
+			},
+		},
+		{
+			name: "EscalateError",
+			fields: fields{
+				interval:           1,
+				maxShutdownWorkers: 1,
+			},
+			procs: procs{
+				masters:         []*procps.Process{{Pid: 0}},
+				workers:         []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}, {Pid: 0}},
+				workersShutdown: []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}},
+				exited:          []bool{false},
+			},
+			want: want{
+				terminate: 2,
+				sigterm:   2,
+				sigkill:   2,
+				err:       true,
+			},
+		},
+		{
+			name: "DryRun",
+			fields: fields{
+				interval:           1,
+				maxShutdownWorkers: 1,
+				dryRun:             true,
+			},
+			procs: procs{
+				masters:         []*procps.Process{{Pid: 0}},
+				workers:         []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}, {Pid: 0}},
+				workersShutdown: []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}},
+				exited:          []bool{true},
+			},
+			want: want{
+				dryRun: 2,
+			},
+		},
+		{
+			name: "TerminateExpired",
+			fields: fields{
+				interval:           1,
+				maxShutdownWorkers: 3,
+				maxShutdownAge:     time.Minute,
+				shutdownFor:        time.Hour,
+			},
+			procs: procs{
+				masters:         []*procps.Process{{Pid: 0}},
+				workers:         []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}, {Pid: 0}},
+				workersShutdown: []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}},
+				exited:          []bool{true},
+			},
+			want: want{
+				terminate: 3,
+				sigterm:   3,
+			},
+		},
+		{
+			name: "NotExpired",
+			fields: fields{
+				interval:           1,
+				maxShutdownWorkers: 3,
+				maxShutdownAge:     time.Minute,
+				shutdownFor:        time.Second,
+			},
+			procs: procs{
+				masters:         []*procps.Process{{Pid: 0}},
+				workers:         []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}, {Pid: 0}},
+				workersShutdown: []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}},
+				exited:          []bool{true},
 			},
-			want:    2,
-			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
@@ -184,56 +318,345 @@ func TestReaper_Run(t *testing.T) {
 			mockProcpsPgrep := MockProcpsPgrep{}
 			mockProcpsPgrep.On("Call").Return(tt.procs.masters, tt.procs.workers)
 			procpsPgrep = mockProcpsPgrep.Call
-			defer func() { procpsPgrep = procps.Pgrep }()
+			defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
 
 			mockProcpsFilter := MockProcpsFilter{}
 			mockProcpsFilter.On("Call").Return(tt.procs.workersShutdown)
 			procpsFilter = mockProcpsFilter.Call
 			defer func() { procpsFilter = procps.Filter }()
 
-			mockProcpsTerminate := MockProcpsTerminate{}
-			if tt.wantErr {
-				mockProcpsTerminate.On("Call").Return(errors.New(tt.name))
+			mockProcpsSignal := MockProcpsSignal{}
+			if tt.want.err && tt.want.sigterm == 0 {
+				mockProcpsSignal.On("Call").Return(errors.New(tt.name))
 			} else {
-				mockProcpsTerminate.On("Call").Return(nil)
+				mockProcpsSignal.On("Call").Return(nil)
 			}
-			procpsTerminate = mockProcpsTerminate.Call
-			defer func() { procpsTerminate = procps.Terminate }()
+			procpsSignal = mockProcpsSignal.Call
+			defer func() { procpsSignal = procps.Signal }()
 
-			r := NewReaper(tt.fields.interval, tt.fields.maxShutdownWorkers, tt.fields.availableMemoryPercent)
+			mockProcpsWaitExit := MockProcpsWaitExit{exited: tt.procs.exited}
+			mockProcpsWaitExit.On("Call")
+			procpsWaitExit = mockProcpsWaitExit.Call
+			defer func() { procpsWaitExit = procps.WaitExit }()
+
+			r := NewReaper(tt.fields.interval, tt.fields.maxShutdownWorkers, tt.fields.availableMemoryPercent,
+				WithMaxShutdownAge(tt.fields.maxShutdownAge), WithDryRun(tt.fields.dryRun))
+			r.shutdownSince = map[workerKey]time.Time{
+				workerKeyOf(tt.procs.workersShutdown[0]): time.Now().Add(-tt.fields.shutdownFor),
+			}
 
 			assert.True(t, r.Run())
-			mockProcpsTerminate.AssertNumberOfCalls(t, "Call", tt.want)
+			mockProcpsSignal.AssertNumberOfCalls(t, "Call", max(tt.want.terminate, tt.want.sigterm+tt.want.sigkill))
+			assert.Len(t, r.shutdownSince, 1)
 
 			active := len(tt.procs.workers) - len(tt.procs.workersShutdown)
 			shutdown := len(tt.procs.workersShutdown)
-			terminated := shutdown - tt.fields.maxShutdownWorkers
-			if tt.wantErr {
-				assert.Equal(t, active, getGaugeValueInt(r.collectorRunning, LabelActive))
-				assert.Equal(t, shutdown, getGaugeValueInt(r.collectorRunning, LabelShutdown))
-				assert.Equal(t, terminated, getCounterValueInt(r.collectorShutdown, LabelError))
-				assert.Equal(t, 0, getCounterValueInt(r.collectorShutdown, LabelTerminated))
+			assert.Equal(t, active, getGaugeValueInt(r.collectorRunning, "nginx", LabelActive))
+			assert.Equal(t, shutdown, getGaugeValueInt(r.collectorRunning, "nginx", LabelShutdown))
+			assert.Equal(t, tt.want.sigterm, getCounterValueInt(r.collectorSignals, "nginx", "SIGTERM"))
+			assert.Equal(t, tt.want.sigkill, getCounterValueInt(r.collectorSignals, "nginx", "SIGKILL"))
+			assert.Equal(t, tt.want.dryRun, getCounterValueInt(r.collectorShutdown, "nginx", LabelDryRun))
+			if tt.want.err {
+				assert.Equal(t, tt.want.terminate, getCounterValueInt(r.collectorShutdown, "nginx", LabelError))
+				assert.Equal(t, 0, getCounterValueInt(r.collectorShutdown, "nginx", LabelTerminated))
 			} else {
-				assert.Equal(t, active, getGaugeValueInt(r.collectorRunning, LabelActive))
-				assert.Equal(t, shutdown, getGaugeValueInt(r.collectorRunning, LabelShutdown))
-				assert.Equal(t, 0, getCounterValueInt(r.collectorShutdown, LabelError))
-				assert.Equal(t, terminated, getCounterValueInt(r.collectorShutdown, LabelTerminated))
+				assert.Equal(t, 0, getCounterValueInt(r.collectorShutdown, "nginx", LabelError))
+				assert.Equal(t, tt.want.terminate, getCounterValueInt(r.collectorShutdown, "nginx", LabelTerminated))
+			}
+		})
+	}
+}
+
+func TestReaper_RunScope(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope Scope
+		want  int
+	}{
+		{
+			name:  "Master",
+			scope: ScopeMaster,
+		},
+		{
+			name:  "Global",
+			scope: ScopeGlobal,
+			want:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			masters := []*procps.Process{{Pid: 1}, {Pid: 2}}
+			workers1 := []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}}
+			workers2 := []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}}
+
+			mockProcpsPgrep := MockProcpsPgrep{}
+			mockProcpsPgrep.On("Call").Return(masters, workers1, workers2)
+			procpsPgrep = mockProcpsPgrep.Call
+			defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+			mockProcpsFilter := MockProcpsFilter{}
+			mockProcpsFilter.On("Call").Return(workers1[1:], workers2[1:])
+			procpsFilter = mockProcpsFilter.Call
+			defer func() { procpsFilter = procps.Filter }()
+
+			mockProcpsSignal := MockProcpsSignal{}
+			mockProcpsSignal.On("Call").Return(nil)
+			procpsSignal = mockProcpsSignal.Call
+			defer func() { procpsSignal = procps.Signal }()
+
+			mockProcpsWaitExit := MockProcpsWaitExit{exited: []bool{true}}
+			mockProcpsWaitExit.On("Call")
+			procpsWaitExit = mockProcpsWaitExit.Call
+			defer func() { procpsWaitExit = procps.WaitExit }()
+
+			r := NewReaper(1, 2, 0, WithScope(tt.scope))
+
+			assert.True(t, r.Run())
+			mockProcpsSignal.AssertNumberOfCalls(t, "Call", tt.want)
+			assert.Equal(t, 2, getGaugeValueInt(r.collectorRunning, "nginx", LabelActive))
+			assert.Equal(t, 4, getGaugeValueInt(r.collectorRunning, "nginx", LabelShutdown))
+			assert.Equal(t, tt.want, getCounterValueInt(r.collectorShutdown, "nginx", LabelTerminated))
+		})
+	}
+}
+
+type MockEventWatcher struct {
+	events chan memevents.Event
+}
+
+func (m *MockEventWatcher) Events() <-chan memevents.Event {
+	return m.events
+}
+
+func (m *MockEventWatcher) Err() error {
+	return errors.New("stopped")
+}
+
+func (m *MockEventWatcher) Close() error {
+	return nil
+}
+
+type MockMemeventsWatch struct {
+	mock.Mock
+}
+
+func (m *MockMemeventsWatch) Call(pid int, threshold uint64) (eventWatcher, error) {
+	args := m.Called(pid, threshold)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(eventWatcher), args.Error(1)
+}
+
+type MockProcpsReadCgroupMemory struct {
+	mock.Mock
+}
+
+func (m *MockProcpsReadCgroupMemory) Call(int) (*procps.CgroupMemory, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*procps.CgroupMemory), args.Error(1)
+}
+
+// See https://github.com/stretchr/testify#mock-package
+type MockProcpsNewSnapshot struct {
+	mock.Mock
+}
+
+func (m *MockProcpsNewSnapshot) Call() (*procps.Snapshot, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*procps.Snapshot), args.Error(1)
+}
+
+func TestReaper_RunSnapshotError(t *testing.T) {
+	mockProcpsNewSnapshot := MockProcpsNewSnapshot{}
+	mockProcpsNewSnapshot.On("Call").Return(nil, errors.New("SnapshotError"))
+	procpsNewSnapshot = mockProcpsNewSnapshot.Call
+	defer func() { procpsNewSnapshot = procps.NewSnapshot }()
+
+	mockProcpsPgrep := MockProcpsPgrep{}
+	procpsPgrep = mockProcpsPgrep.Call
+	defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+	r := NewReaper(time.Second, 1, 0)
+	assert.True(t, r.Run())
+	assert.False(t, nginxMasterRunning(NewReaper(1, 1, 0)))
+	mockProcpsNewSnapshot.AssertNumberOfCalls(t, "Call", 2)
+	mockProcpsPgrep.AssertNotCalled(t, "Call")
+}
+
+func TestReaper_RunProcessMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want bool
+	}{
+		{name: "Default", spec: "", want: true},
+		{name: "Match", spec: `{"not": {"name": "nginx"}}`, want: true},
+		{name: "NotMatch", spec: `{"name": "nginx"}`, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The process match is the last option of each Pgrep call.
+			var got []bool
+			procpsPgrep = func(_ *procps.Snapshot, options ...option.Option) []*procps.Process {
+				got = append(got, options[len(options)-1](&procps.Process{Pid: 7}))
+				return []*procps.Process{{Pid: 7}}
 			}
+			defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+			spec, err := option.ParseSpec(tt.spec)
+			assert.NoError(t, err)
+			r := NewReaper(time.Second, 1, 0, WithProcessMatch(spec))
+			assert.True(t, r.Run())
+			assert.Equal(t, []bool{tt.want, tt.want}, got)
+		})
+	}
+}
+
+func TestReaper_RunMemoryEvents(t *testing.T) {
+	procpsPgrep = func(*procps.Snapshot, ...option.Option) []*procps.Process { return []*procps.Process{{Pid: 7}} }
+	defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+	mockProcpsFilter := MockProcpsFilter{}
+	mockProcpsFilter.On("Call").Return([]*procps.Process{})
+	procpsFilter = mockProcpsFilter.Call
+	defer func() { procpsFilter = procps.Filter }()
+
+	mockProcpsReadCgroupMemory := MockProcpsReadCgroupMemory{}
+	mockProcpsReadCgroupMemory.On("Call").Return(&procps.CgroupMemory{Limit: 1000}, nil)
+	procpsReadCgroupMemory = mockProcpsReadCgroupMemory.Call
+	defer func() { procpsReadCgroupMemory = procps.ReadCgroupMemory }()
+
+	watcher := &MockEventWatcher{events: make(chan memevents.Event)}
+	mockMemeventsWatch := MockMemeventsWatch{}
+	mockMemeventsWatch.On("Call", 7, uint64(900)).Return(watcher, nil)
+	memeventsWatch = mockMemeventsWatch.Call
+	defer func() {
+		memeventsWatch = func(pid int, threshold uint64) (eventWatcher, error) { return memevents.Watch(pid, threshold) }
+	}()
+
+	r := NewReaper(1, 1, 10, WithMemoryEvents(true, time.Hour))
+
+	// Subscribe on the first run.
+	assert.True(t, r.Run())
+	assert.True(t, r.Run())
+	mockMemeventsWatch.AssertNumberOfCalls(t, "Call", 1)
+	assert.Equal(t, 2, getCounterValueInt(r.collectorRuns, LabelSchedule))
+
+	// Run on event, and skip events within the debounce duration.
+	watcher.events <- memevents.Event{Name: memevents.EventHigh}
+	watcher.events <- memevents.Event{Name: memevents.EventHigh}
+	watcher.events <- memevents.Event{Name: memevents.EventMax}
+	assert.Equal(t, 1, getCounterValueInt(r.collectorRuns, LabelEvent))
+
+	// Subscribe again on the next run when the watcher stops.
+	close(watcher.events)
+	assert.Eventually(t, func() bool {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.watcher == nil
+	}, time.Second, time.Millisecond)
+	assert.True(t, r.Run())
+	mockMemeventsWatch.AssertNumberOfCalls(t, "Call", 2)
+}
+
+func TestReaper_RunMemoryEventsError(t *testing.T) {
+	procpsPgrep = func(*procps.Snapshot, ...option.Option) []*procps.Process { return []*procps.Process{{Pid: 7}} }
+	defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+	mockProcpsFilter := MockProcpsFilter{}
+	mockProcpsFilter.On("Call").Return([]*procps.Process{})
+	procpsFilter = mockProcpsFilter.Call
+	defer func() { procpsFilter = procps.Filter }()
+
+	mockProcpsReadCgroupMemory := MockProcpsReadCgroupMemory{}
+	mockProcpsReadCgroupMemory.On("Call").Return(nil, errors.New("no cgroup"))
+	procpsReadCgroupMemory = mockProcpsReadCgroupMemory.Call
+	defer func() { procpsReadCgroupMemory = procps.ReadCgroupMemory }()
+
+	mockMemeventsWatch := MockMemeventsWatch{}
+	mockMemeventsWatch.On("Call", 7, uint64(0)).Return(nil, errors.New("no cgroup"))
+	memeventsWatch = mockMemeventsWatch.Call
+	defer func() {
+		memeventsWatch = func(pid int, threshold uint64) (eventWatcher, error) { return memevents.Watch(pid, threshold) }
+	}()
+
+	r := NewReaper(1, 1, 10, WithMemoryEvents(true, time.Hour))
+
+	// Retry on every run.
+	assert.True(t, r.Run())
+	assert.True(t, r.Run())
+	mockMemeventsWatch.AssertNumberOfCalls(t, "Call", 2)
+	assert.Nil(t, r.watcher)
+}
+
+func TestReaper_memoryThreshold(t *testing.T) {
+	tests := []struct {
+		name    string
+		percent int
+		bytes   uint64
+		limit   uint64
+		err     error
+		want    uint64
+	}{
+		{
+			name:    "Percent",
+			percent: 10,
+			limit:   1000,
+			want:    900,
+		},
+		{
+			name:    "Bytes",
+			percent: 10,
+			bytes:   200,
+			limit:   1000,
+			want:    800,
+		},
+		{
+			name:  "NoTarget",
+			limit: 1000,
+		},
+		{
+			name:  "TargetAboveLimit",
+			bytes: 2000,
+			limit: 1000,
+		},
+		{
+			name:    "Error",
+			percent: 10,
+			err:     errors.New("no cgroup"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockProcpsReadCgroupMemory := MockProcpsReadCgroupMemory{}
+			mockProcpsReadCgroupMemory.On("Call").Return(&procps.CgroupMemory{Limit: tt.limit}, tt.err)
+			procpsReadCgroupMemory = mockProcpsReadCgroupMemory.Call
+			defer func() { procpsReadCgroupMemory = procps.ReadCgroupMemory }()
+
+			r := NewReaper(1, 1, tt.percent, WithAvailableMemoryBytes(tt.bytes))
+			assert.Equal(t, tt.want, r.memoryThreshold(1))
 		})
 	}
 }
 
-func getCounterValueInt(metric *prometheus.CounterVec, label string) int {
+func getCounterValueInt(metric *prometheus.CounterVec, labels ...string) int {
 	m := &dto.Metric{}
-	if err := metric.WithLabelValues(label).Write(m); err != nil {
+	if err := metric.WithLabelValues(labels...).Write(m); err != nil {
 		return 0
 	}
 	return int(m.Counter.GetValue())
 }
 
-func getGaugeValueInt(metric *prometheus.GaugeVec, label string) int {
+func getGaugeValueInt(metric *prometheus.GaugeVec, labels ...string) int {
 	m := &dto.Metric{}
-	if err := metric.WithLabelValues(label).Write(m); err != nil {
+	if err := metric.WithLabelValues(labels...).Write(m); err != nil {
 		return 0
 	}
 	return int(m.Gauge.GetValue())
@@ -244,7 +667,7 @@ type MockNewMemoryInfo struct {
 	mock.Mock
 }
 
-func (m *MockNewMemoryInfo) Call(int) *procps.MemoryInfo {
+func (m *MockNewMemoryInfo) Call(int, procps.MemoryCalculation) *procps.MemoryInfo {
 	args := m.Called()
 	return args.Get(0).(*procps.MemoryInfo)
 }
@@ -253,6 +676,7 @@ func TestReaper_shouldTerminate(t *testing.T) {
 	type fields struct {
 		maxShutdownWorkers     int
 		availableMemoryPercent int
+		availableMemoryBytes   uint64
 		Total                  uint64
 		Available              uint64
 	}
@@ -324,12 +748,57 @@ func TestReaper_shouldTerminate(t *testing.T) {
 			workers: 3,
 			want:    true,
 		},
+		{
+			name: "AvailableMemoryBytesEquals",
+			fields: fields{
+				maxShutdownWorkers:   255,
+				availableMemoryBytes: 50,
+				Total:                100,
+				Available:            50,
+			},
+			workers: 3,
+		},
+		{
+			name: "AvailableMemoryBytesLess",
+			fields: fields{
+				maxShutdownWorkers:   255,
+				availableMemoryBytes: 50,
+				Total:                100,
+				Available:            49,
+			},
+			workers: 3,
+			want:    true,
+		},
+		{
+			name: "AvailableMemoryBytesAndPercent",
+			fields: fields{
+				maxShutdownWorkers:     255,
+				availableMemoryPercent: 10,
+				availableMemoryBytes:   1 << 30,
+				Total:                  16 << 30,
+				Available:              2 << 30,
+			},
+			workers: 3,
+		},
+		{
+			name: "AvailableMemoryBytesNotPercent",
+			fields: fields{
+				maxShutdownWorkers:     255,
+				availableMemoryPercent: 10,
+				availableMemoryBytes:   1 << 30,
+				Total:                  8 << 30,
+				Available:              1<<30 - 1,
+			},
+			workers: 3,
+			want:    true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := &Reaper{
 				maxShutdownWorkers:     tt.fields.maxShutdownWorkers,
 				availableMemoryPercent: tt.fields.availableMemoryPercent,
+				availableMemoryBytes:   tt.fields.availableMemoryBytes,
 			}
 			var mockNewMemoryInfo MockNewMemoryInfo
 			mockNewMemoryInfo.On("Call").Return(
@@ -345,3 +814,337 @@ func TestReaper_shouldTerminate(t *testing.T) {
 		})
 	}
 }
+
+func TestReaper_shouldTerminateRecovery(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   []Option
+		available []uint64 // Available memory of 100 bytes on consecutive checks.
+		want      []bool
+	}{
+		{
+			name:      "NoRecovery",
+			available: []uint64{40, 50, 61, 50},
+			want:      []bool{true, false, false, false},
+		},
+		{
+			name:      "RecoveryPercent",
+			options:   []Option{WithMemoryRecovery(60, 0)},
+			available: []uint64{40, 50, 61, 50, 44},
+			want:      []bool{true, true, false, false, true},
+		},
+		{
+			name:      "RecoveryBytes",
+			options:   []Option{WithMemoryRecovery(0, 60)},
+			available: []uint64{40, 59, 60},
+			want:      []bool{true, true, false},
+		},
+		{
+			name:      "RecoveryBelowLimit",
+			options:   []Option{WithMemoryRecovery(30, 0)},
+			available: []uint64{40, 50},
+			want:      []bool{true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReaper(1, 255, 45, tt.options...)
+			var got []bool
+			for _, available := range tt.available {
+				procpsNewMemoryInfo = func(int, procps.MemoryCalculation) *procps.MemoryInfo {
+					return &procps.MemoryInfo{Total: 100, Available: available}
+				}
+				got = append(got, r.shouldTerminate(7, 1))
+			}
+			procpsNewMemoryInfo = procps.NewMemoryInfo
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReaper_RunRecovery(t *testing.T) {
+	procpsNewMemoryInfo = func(int, procps.MemoryCalculation) *procps.MemoryInfo {
+		return &procps.MemoryInfo{Total: 100, Available: 40}
+	}
+	defer func() { procpsNewMemoryInfo = procps.NewMemoryInfo }()
+	r := NewReaper(1, 255, 45, WithMemoryRecovery(60, 0))
+	assert.True(t, r.shouldTerminate(7, 1))
+
+	// The gauge shows the recovery while the master is running.
+	mockProcpsPgrep := MockProcpsPgrep{}
+	mockProcpsPgrep.On("Call").Return([]*procps.Process{{Pid: 7}}, []*procps.Process{}, []*procps.Process{})
+	procpsPgrep = mockProcpsPgrep.Call
+	defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+	assert.True(t, r.Run())
+	assert.Equal(t, 1, getGaugeValue(r.collectorRecovery))
+	assert.True(t, r.Run())
+	assert.Equal(t, 0, getGaugeValue(r.collectorRecovery))
+	assert.Empty(t, r.recovering)
+}
+
+func getGaugeValue(gauge prometheus.Gauge) int {
+	m := &dto.Metric{}
+	if err := gauge.Write(m); err != nil {
+		return 0
+	}
+	return int(m.Gauge.GetValue())
+}
+
+type MockProcpsReadMemoryPressure struct {
+	mock.Mock
+}
+
+func (m *MockProcpsReadMemoryPressure) Call(int) (*procps.MemoryPressure, error) {
+	args := m.Called()
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*procps.MemoryPressure), args.Error(1)
+}
+
+func TestReaper_shouldTerminatePressure(t *testing.T) {
+	pressure := &procps.MemoryPressure{SomeAvg10: 30, SomeAvg60: 10, FullAvg10: 15, FullAvg60: 5}
+
+	tests := []struct {
+		name     string
+		metric   PressureMetric
+		percent  int
+		pressure *procps.MemoryPressure
+		err      error
+		want     []bool
+	}{
+		{
+			name:     "Disabled",
+			pressure: pressure,
+			want:     []bool{false},
+		},
+		{
+			name:     "Within",
+			metric:   SomeAvg60,
+			percent:  10,
+			pressure: pressure,
+			want:     []bool{false, false},
+		},
+		{
+			name:     "ExceedsOncePerRun",
+			metric:   FullAvg10,
+			percent:  10,
+			pressure: pressure,
+			want:     []bool{true, false},
+		},
+		{
+			name:    "Error",
+			metric:  SomeAvg10,
+			percent: 10,
+			err:     errors.New("no pressure"),
+			want:    []bool{false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mockNewMemoryInfo MockNewMemoryInfo
+			mockNewMemoryInfo.On("Call").Return(&procps.MemoryInfo{Total: 100, Available: 100})
+			procpsNewMemoryInfo = mockNewMemoryInfo.Call
+			defer func() { procpsNewMemoryInfo = procps.NewMemoryInfo }()
+
+			var mockProcpsReadMemoryPressure MockProcpsReadMemoryPressure
+			mockProcpsReadMemoryPressure.On("Call").Return(tt.pressure, tt.err)
+			procpsReadMemoryPressure = mockProcpsReadMemoryPressure.Call
+			defer func() { procpsReadMemoryPressure = procps.ReadMemoryPressure }()
+
+			r := NewReaper(1, 255, 0, WithMemoryPressure(tt.metric, tt.percent))
+			for _, want := range tt.want {
+				assert.Equal(t, want, r.shouldTerminate(0, 3))
+			}
+
+			// The next run resets the limit of one termination per run.
+			procpsPgrep = func(*procps.Snapshot, ...option.Option) []*procps.Process { return nil }
+			defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+			assert.True(t, r.Run())
+			assert.False(t, r.pressureTerminated)
+		})
+	}
+}
+
+func TestReaper_RunProfiles(t *testing.T) {
+	// The master 1 matches both profiles and is handled by the first one only.
+	openrestyMasters := []*procps.Process{{Pid: 1}}
+	openrestyWorkers := []*procps.Process{{Pid: 0}, {Pid: 0}}
+	nginxMasters := []*procps.Process{{Pid: 1}, {Pid: 2}}
+	nginxWorkers := []*procps.Process{{Pid: 0}, {Pid: 0}, {Pid: 0}}
+
+	mockProcpsPgrep := MockProcpsPgrep{}
+	mockProcpsPgrep.On("Call").Return(openrestyMasters, openrestyWorkers, nginxMasters, nginxWorkers)
+	procpsPgrep = mockProcpsPgrep.Call
+	defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+	mockProcpsFilter := MockProcpsFilter{}
+	mockProcpsFilter.On("Call").Return(openrestyWorkers[1:], nginxWorkers[1:])
+	procpsFilter = mockProcpsFilter.Call
+	defer func() { procpsFilter = procps.Filter }()
+
+	r := NewReaper(1, 255, 0, WithProfiles(ProfileOpenResty, ProfileNginx))
+
+	assert.True(t, r.Run())
+	mockProcpsPgrep.AssertNumberOfCalls(t, "Call", 4)
+	assert.Equal(t, 1, getGaugeValueInt(r.collectorRunning, "openresty", LabelActive))
+	assert.Equal(t, 1, getGaugeValueInt(r.collectorRunning, "openresty", LabelShutdown))
+	assert.Equal(t, 1, getGaugeValueInt(r.collectorRunning, "nginx", LabelActive))
+	assert.Equal(t, 2, getGaugeValueInt(r.collectorRunning, "nginx", LabelShutdown))
+}
+
+func TestReaper_RunCgroupFilterError(t *testing.T) {
+	mockProcpsPgrep := MockProcpsPgrep{}
+	procpsPgrep = mockProcpsPgrep.Call
+	defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+	// The reference process is not running, no process is matched outside the cgroup.
+	r := NewReaper(time.Second, 1, 0, WithCgroupFilter(&CgroupFilter{Pid: 2147483647}))
+	assert.True(t, r.Run())
+	assert.False(t, nginxMasterRunning(r))
+	mockProcpsPgrep.AssertNotCalled(t, "Call")
+}
+
+func TestReaper_RunGenerations(t *testing.T) {
+	tests := []struct {
+		name string
+		mode ReapMode
+		want int
+	}{
+		{
+			name: "Worker",
+			mode: ReapWorker,
+			want: 1,
+		},
+		{
+			name: "Generation",
+			mode: ReapGeneration,
+			want: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workers := startGenerations(t)
+
+			mockProcpsPgrep := MockProcpsPgrep{}
+			mockProcpsPgrep.On("Call").Return([]*procps.Process{{Pid: 1}}, workers)
+			procpsPgrep = mockProcpsPgrep.Call
+			defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+			mockProcpsSignal := MockProcpsSignal{}
+			mockProcpsSignal.On("Call").Return(nil)
+			procpsSignal = mockProcpsSignal.Call
+			defer func() { procpsSignal = procps.Signal }()
+
+			mockProcpsWaitExit := MockProcpsWaitExit{exited: []bool{true}}
+			mockProcpsWaitExit.On("Call")
+			procpsWaitExit = mockProcpsWaitExit.Call
+			defer func() { procpsWaitExit = procps.WaitExit }()
+
+			// All workers are shutting down, the oldest generation has two of them.
+			r := NewReaper(1, 2, 0, WithProfiles(&Profile{
+				Name:     "nginx",
+				Master:   ProfileNginx.Master,
+				Worker:   ProfileNginx.Worker,
+				Draining: matchAny.Option,
+			}), WithReapMode(tt.mode), WithGenerationGap(300*time.Millisecond))
+
+			assert.True(t, r.Run())
+			mockProcpsSignal.AssertNumberOfCalls(t, "Call", tt.want)
+			assert.Equal(t, tt.want, getCounterValueInt(r.collectorShutdown, "nginx", LabelTerminated))
+			assert.Equal(t, 2, getGaugeValueInt(r.collectorGenerationWorkers, "nginx", "1", "1"))
+			assert.Equal(t, 1, getGaugeValueInt(r.collectorGenerationWorkers, "nginx", "1", "2"))
+			assert.Less(t, 0, getGaugeValueInt(r.collectorGenerationRSS, "nginx", "1", "1"))
+			assert.GreaterOrEqual(t, getGaugeValueInt(r.collectorGenerationAge, "nginx", "1", "1"),
+				getGaugeValueInt(r.collectorGenerationAge, "nginx", "1", "2"))
+		})
+	}
+}
+
+func getHistogramValues(metric *prometheus.HistogramVec, labels ...string) (count uint64, sum float64) {
+	m := &dto.Metric{}
+	if err := metric.WithLabelValues(labels...).(prometheus.Histogram).Write(m); err != nil {
+		return 0, 0
+	}
+	return m.Histogram.GetSampleCount(), m.Histogram.GetSampleSum()
+}
+
+func TestReaper_terminateAll(t *testing.T) {
+	tests := []struct {
+		name      string
+		dryRun    bool
+		signalErr error
+		before    uint64
+		after     uint64
+		wantCount uint64
+		wantSum   float64
+	}{
+		{
+			name:      "Freed",
+			before:    100,
+			after:     300,
+			wantCount: 2,
+			wantSum:   200,
+		},
+		{
+			name:      "Allocated",
+			before:    300,
+			after:     100,
+			wantCount: 2,
+		},
+		{
+			name:      "Error",
+			signalErr: errors.New("no signal"),
+		},
+		{
+			name:   "DryRun",
+			dryRun: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mockNewMemoryInfo MockNewMemoryInfo
+			mockNewMemoryInfo.On("Call").Return(&procps.MemoryInfo{Total: 1000, Available: tt.before}).Once()
+			mockNewMemoryInfo.On("Call").Return(&procps.MemoryInfo{Total: 1000, Available: tt.after}).Once()
+			procpsNewMemoryInfo = mockNewMemoryInfo.Call
+			defer func() { procpsNewMemoryInfo = procps.NewMemoryInfo }()
+
+			mockProcpsSignal := MockProcpsSignal{}
+			mockProcpsSignal.On("Call").Return(tt.signalErr)
+			procpsSignal = mockProcpsSignal.Call
+			defer func() { procpsSignal = procps.Signal }()
+
+			mockProcpsWaitExit := MockProcpsWaitExit{exited: []bool{true}}
+			mockProcpsWaitExit.On("Call")
+			procpsWaitExit = mockProcpsWaitExit.Call
+			defer func() { procpsWaitExit = procps.WaitExit }()
+
+			r := NewReaper(1, 1, 0, WithDryRun(tt.dryRun))
+			r.terminateAll(&procps.Snapshot{}, []*procps.Process{{Pid: 0}, {Pid: 0}}, owner{1, ProfileNginx})
+
+			count, sum := getHistogramValues(r.collectorFreed, "nginx")
+			assert.Equal(t, tt.wantCount, count)
+			assert.Equal(t, tt.wantSum, sum)
+			if tt.dryRun {
+				mockNewMemoryInfo.AssertNotCalled(t, "Call")
+				mockProcpsSignal.AssertNotCalled(t, "Call")
+			}
+		})
+	}
+}
+
+func TestReaper_terminate(t *testing.T) {
+	worker, err := procps.NewProcess(int32(os.Getpid()))
+	assert.NoError(t, err)
+
+	var b strings.Builder
+	stdlog.SetOutput(&b)
+	defer stdlog.SetOutput(os.Stderr)
+
+	// The parent is not read from /proc again, so a parent missing from the snapshot is not logged.
+	r := NewReaper(1, 1, 0, WithDryRun(true))
+	assert.False(t, r.terminate(&procps.Snapshot{}, worker, ProfileNginx))
+	assert.Contains(t, b.String(), fmt.Sprintf("Would terminate nginx worker process {\"pid\":%d,", worker.Pid))
+	assert.NotContains(t, b.String(), `"parent"`)
+}
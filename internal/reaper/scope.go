@@ -0,0 +1,40 @@
+package reaper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Scope defines whether the limits of the Reaper apply to each Nginx master separately or to all of them.
+type Scope uint32
+
+// Reaper scopes.
+const (
+	ScopeMaster Scope = iota // ScopeMaster applies the limits to the workers of each Nginx master separately.
+	ScopeGlobal              // ScopeGlobal applies the limits to the workers of all Nginx masters together.
+)
+
+// Scope name to Scope mapping.
+var scopes = map[string]Scope{
+	"master": ScopeMaster,
+	"global": ScopeGlobal,
+}
+
+// ParseScope converts case-insensitive string to Scope. Returns error if invalid.
+// E.g. "global" becomes ScopeGlobal.
+func ParseScope(name string) (Scope, error) {
+	if s, ok := scopes[strings.ToLower(name)]; ok {
+		return s, nil
+	}
+	return 0, fmt.Errorf("invalid scope: %q", name)
+}
+
+// String returns the name of the Scope.
+func (s Scope) String() string {
+	for name, scope := range scopes {
+		if scope == s {
+			return name
+		}
+	}
+	return fmt.Sprintf("Scope(%d)", s)
+}
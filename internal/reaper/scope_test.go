@@ -0,0 +1,78 @@
+package reaper
+
+import (
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/log"
+	"testing"
+)
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   string
+		want    Scope
+		wantErr bool
+	}{
+		{
+			name:    "Empty",
+			scope:   "",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid",
+			scope:   "pod",
+			wantErr: true,
+		},
+		{
+			name:  "Master",
+			scope: "master",
+			want:  ScopeMaster,
+		},
+		{
+			name:  "Global",
+			scope: "GLOBAL",
+			want:  ScopeGlobal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScope(tt.scope)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestScope_String(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope Scope
+		want  string
+	}{
+		{
+			name:  "Master",
+			scope: ScopeMaster,
+			want:  "master",
+		},
+		{
+			name:  "Global",
+			scope: ScopeGlobal,
+			want:  "global",
+		},
+		{
+			name:  "Invalid",
+			scope: 42,
+			want:  "Scope(42)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.scope.String())
+		})
+	}
+}
@@ -3,7 +3,6 @@ package reaper
 import (
 	"fmt"
 	"nginx-reaper/internal/log"
-	"nginx-reaper/internal/procps"
 	"nginx-reaper/internal/ticker"
 	"os"
 	"os/signal"
@@ -13,6 +12,7 @@ import (
 type ShutdownHandler struct {
 	shutdownInterval time.Duration
 	shutdownTimeout  time.Duration
+	reaper           *Reaper
 }
 
 // Interval at which the ShutdownHandler checks whether a Nginx master process is still running.
@@ -30,23 +30,35 @@ func (s *ShutdownHandler) String() string {
 // Decreases shutdownTimeout by shutdownInterval on each call.
 func (s *ShutdownHandler) Run() bool {
 	s.shutdownTimeout -= s.shutdownInterval
-	return s.shutdownTimeout >= s.shutdownInterval && nginxMasterRunning()
+	return s.shutdownTimeout >= s.shutdownInterval && nginxMasterRunning(s.reaper)
 }
 
-// nginxMasterRunning returns a bool indicating whether a Nginx master process is still running.
-func nginxMasterRunning() bool {
-	masters := procpsPgrep(OptionNginxMaster)
-	if len(masters) == 0 {
+// nginxMasterRunning returns a bool indicating whether a master process managed by the Reaper is still running.
+func nginxMasterRunning(r *Reaper) bool {
+	snapshot, err := procpsNewSnapshot()
+	if err != nil {
+		log.Errorf("Failed to read processes: %v", err)
 		return false
 	}
-	for _, master := range masters {
-		log.Infof("Nginx master process is still running %v", procps.NewProcessInfo(master))
+	defer func() { _ = snapshot.Close() }()
+	match, err := r.match(snapshot)
+	if err != nil {
+		log.Errorf("Failed to match processes of cgroup %v: %v", r.cgroup, err)
+		return false
+	}
+	running := false
+	for _, profile := range r.profiles {
+		for _, master := range r.discovery.masters(snapshot, profile, match) {
+			log.Infof("%v master process is still running %v", profile.title(), snapshot.ProcessInfo(master))
+			running = true
+		}
 	}
-	return true
+	return running
 }
 
 // WaitShutdown listens for the specified signal and starts the graceful shutdown process when received.
-func WaitShutdown(shutdownInterval time.Duration, shutdownTimeout time.Duration, sig os.Signal) {
+// The shutdown waits for the master processes managed by the Reaper.
+func WaitShutdown(shutdownInterval time.Duration, shutdownTimeout time.Duration, sig os.Signal, nginxReaper *Reaper) {
 	channel := make(chan os.Signal, 1)
 	signal.Notify(channel, sig)
 
@@ -54,10 +66,11 @@ func WaitShutdown(shutdownInterval time.Duration, shutdownTimeout time.Duration,
 	received := <-channel
 	log.Infof("Nginx Reaper %v", received)
 
-	if nginxMasterRunning() {
+	if nginxMasterRunning(nginxReaper) {
 		handler := &ShutdownHandler{
 			shutdownInterval: shutdownInterval,
 			shutdownTimeout:  shutdownTimeout,
+			reaper:           nginxReaper,
 		}
 		ticker.Start(handler)
 	}
@@ -2,7 +2,6 @@ package reaper
 
 import (
 	"fmt"
-	"github.com/shirou/gopsutil/v3/process"
 	"github.com/stretchr/testify/assert"
 	"math/rand"
 	"nginx-reaper/internal/procps"
@@ -38,7 +37,7 @@ func TestShutdownHandler_Run(t *testing.T) {
 	tests := []struct {
 		name    string
 		fields  fields
-		masters []*process.Process
+		masters []*procps.Process
 		want    bool
 	}{
 		{
@@ -50,7 +49,7 @@ func TestShutdownHandler_Run(t *testing.T) {
 				shutdownInterval: timeout,
 				shutdownTimeout:  timeout,
 			},
-			masters: []*process.Process{{Pid: 0}},
+			masters: []*procps.Process{{Pid: 0}},
 		},
 		{
 			name: "IntervalLessTimeout",
@@ -58,7 +57,7 @@ func TestShutdownHandler_Run(t *testing.T) {
 				shutdownInterval: timeout / 2,
 				shutdownTimeout:  timeout,
 			},
-			masters: []*process.Process{{Pid: 0}},
+			masters: []*procps.Process{{Pid: 0}},
 			want:    true,
 		},
 	}
@@ -67,11 +66,12 @@ func TestShutdownHandler_Run(t *testing.T) {
 			s := &ShutdownHandler{
 				shutdownInterval: tt.fields.shutdownInterval,
 				shutdownTimeout:  tt.fields.shutdownTimeout,
+				reaper:           NewReaper(1, 1, 0),
 			}
 			mockProcpsPgrep := MockProcpsPgrep{}
 			mockProcpsPgrep.On("Call").Return(tt.masters)
 			procpsPgrep = mockProcpsPgrep.Call
-			defer func() { procpsPgrep = procps.Pgrep }()
+			defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
 
 			assert.Equal(t, tt.want, s.Run())
 			assert.Equal(t, s.shutdownTimeout, tt.fields.shutdownTimeout-tt.fields.shutdownInterval)
@@ -82,7 +82,7 @@ func TestShutdownHandler_Run(t *testing.T) {
 func Test_nginxMasterRunning(t *testing.T) {
 	tests := []struct {
 		name    string
-		masters []*process.Process
+		masters []*procps.Process
 		want    bool
 	}{
 		{
@@ -90,12 +90,12 @@ func Test_nginxMasterRunning(t *testing.T) {
 		},
 		{
 			name:    "HasMaster",
-			masters: []*process.Process{{Pid: 0}},
+			masters: []*procps.Process{{Pid: 0}},
 			want:    true,
 		},
 		{
 			name:    "HasMasters",
-			masters: []*process.Process{{Pid: 0}, {Pid: 0}},
+			masters: []*procps.Process{{Pid: 0}, {Pid: 0}},
 			want:    true,
 		},
 	}
@@ -104,9 +104,9 @@ func Test_nginxMasterRunning(t *testing.T) {
 			mockProcpsPgrep := MockProcpsPgrep{}
 			mockProcpsPgrep.On("Call").Return(tt.masters)
 			procpsPgrep = mockProcpsPgrep.Call
-			defer func() { procpsPgrep = procps.Pgrep }()
+			defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
 
-			assert.Equal(t, tt.want, nginxMasterRunning())
+			assert.Equal(t, tt.want, nginxMasterRunning(NewReaper(1, 1, 0)))
 		})
 	}
 }
@@ -144,16 +144,16 @@ func TestWaitShutdown(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mockProcpsPgrep := MockProcpsPgrep{}
-			mockProcpsPgrep.On("Call").Return([]*process.Process{{Pid: 0}}, []*process.Process{})
+			mockProcpsPgrep.On("Call").Return([]*procps.Process{{Pid: 0}}, []*procps.Process{})
 			procpsPgrep = mockProcpsPgrep.Call
-			defer func() { procpsPgrep = procps.Pgrep }()
+			defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
 
 			go func() {
 				time.Sleep(1 * time.Second)
 				assert.NoError(t, syscall.Kill(os.Getpid(), tt.args.sig))
 			}()
 
-			WaitShutdown(tt.args.shutdownInterval, tt.args.shutdownTimeout, tt.args.sig)
+			WaitShutdown(tt.args.shutdownInterval, tt.args.shutdownTimeout, tt.args.sig, NewReaper(1, 1, 0))
 
 			mockProcpsPgrep.AssertNumberOfCalls(t, "Call", tt.want)
 		})
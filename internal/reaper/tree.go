@@ -0,0 +1,121 @@
+package reaper
+
+import (
+	"fmt"
+	"io"
+	"nginx-reaper/internal/procps"
+	"nginx-reaper/internal/procps/option"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ProcessNode is a master or a worker process in the ProcessTree of the Reaper.
+type ProcessNode struct {
+	*procps.ProcessInfo
+	Profile         string         `json:"profile,omitempty"`         // Profile of the master.
+	Status          string         `json:"status,omitempty"`          // LabelActive or LabelShutdown for workers.
+	AgeSeconds      float64        `json:"ageSeconds"`                // Time since the process was created.
+	DrainingSeconds float64        `json:"drainingSeconds,omitempty"` // Time since first seen shutting down.
+	Workers         []*ProcessNode `json:"workers,omitempty"`         // Workers of the master.
+}
+
+// ProcessTree is the forest of the masters managed by the Reaper and their workers.
+type ProcessTree []*ProcessNode
+
+// Tree returns the masters managed by the Reaper and their active and shutting down workers, as the Reaper sees
+// them in a new snapshot of the running processes. Returns error if the processes cannot be read.
+func (r *Reaper) Tree() (ProcessTree, error) {
+	snapshot, err := procpsNewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = snapshot.Close() }()
+	match, err := r.match(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	// Draining durations of the last run, the map is replaced by each run. Does not wait for a run in progress.
+	r.view.mu.Lock()
+	shutdownSince := r.view.shutdownSince
+	r.view.mu.Unlock()
+
+	now := timeNow()
+	ageOf := func(proc *procps.Process) float64 {
+		return now.Sub(time.UnixMilli(proc.CreateTime())).Seconds()
+	}
+
+	tree := ProcessTree{}
+	claimed := make(map[int32]bool)
+	for _, profile := range r.profiles {
+		for _, master := range r.discovery.masters(snapshot, profile, match) {
+			if claimed[master.Pid] {
+				continue
+			}
+			claimed[master.Pid] = true
+			node := &ProcessNode{
+				ProcessInfo: procps.FromProcess(master),
+				Profile:     profile.Name,
+				AgeSeconds:  ageOf(master),
+			}
+
+			workers := procpsPgrep(snapshot, profile.Worker, option.Parent(master.Pid), match)
+			draining := make(map[*procps.Process]bool)
+			for _, worker := range profile.draining(workers) {
+				draining[worker] = true
+			}
+			for _, worker := range workers {
+				child := &ProcessNode{
+					ProcessInfo: procps.FromProcess(worker),
+					Status:      LabelActive,
+					AgeSeconds:  ageOf(worker),
+				}
+				if draining[worker] {
+					child.Status = LabelShutdown
+					if since, ok := shutdownSince[workerKeyOf(worker)]; ok {
+						child.DrainingSeconds = now.Sub(since).Seconds()
+					}
+				}
+				node.Workers = append(node.Workers, child)
+			}
+			tree = append(tree, node)
+		}
+	}
+	return tree, nil
+}
+
+// WriteText writes the ProcessTree as plain text in the style of "ps --forest", e.g.
+//
+//	PID  STATE  AGE     DRAINING  RSS       VMS        COMMAND
+//	64   S      2h0m0s  -         10485760  104857600  nginx: master process /usr/sbin/nginx
+//	101  S      1h0m0s  2m30s     52428800  104857600   \_ nginx: worker process is shutting down
+func (t ProcessTree) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "PID\tSTATE\tAGE\tDRAINING\tRSS\tVMS\tCOMMAND")
+	var write func(node *ProcessNode, depth int)
+	write = func(node *ProcessNode, depth int) {
+		draining := "-"
+		if node.DrainingSeconds > 0 {
+			draining = secondsString(node.DrainingSeconds)
+		}
+		command := node.Cmdline
+		if depth > 0 {
+			command = strings.Repeat("    ", depth-1) + " \\_ " + command
+		}
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%d\t%s\n", node.Pid, node.State,
+			secondsString(node.AgeSeconds), draining, node.RSS, node.VMS, command)
+		for _, worker := range node.Workers {
+			write(worker, depth+1)
+		}
+	}
+	for _, master := range t {
+		write(master, 0)
+	}
+	return tw.Flush()
+}
+
+// secondsString returns the seconds as a duration rounded to seconds, e.g. "1h2m3s".
+func secondsString(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
@@ -0,0 +1,114 @@
+package reaper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"nginx-reaper/internal/procps"
+	"testing"
+	"time"
+)
+
+func TestReaper_Tree(t *testing.T) {
+	masters := []*procps.Process{{Pid: 1}}
+	workers := []*procps.Process{{Pid: 2}, {Pid: 3}, {Pid: 4}}
+
+	mockProcpsPgrep := MockProcpsPgrep{}
+	mockProcpsPgrep.On("Call").Return(masters, workers)
+	procpsPgrep = mockProcpsPgrep.Call
+	defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+	mockProcpsFilter := MockProcpsFilter{}
+	mockProcpsFilter.On("Call").Return(workers[1:])
+	procpsFilter = mockProcpsFilter.Call
+	defer func() { procpsFilter = procps.Filter }()
+
+	now := time.UnixMilli(0).Add(time.Hour)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	// The Reaper saw the worker 3 shutting down 90 seconds ago, but not yet the worker 4.
+	r := NewReaper(1, 1, 0)
+	r.setShutdownSince(map[workerKey]time.Time{workerKeyOf(workers[1]): now.Add(-90 * time.Second)})
+
+	got, err := r.Tree()
+	assert.NoError(t, err)
+	body, err := json.Marshal(got)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{
+		"pid": 1, "profile": "nginx", "ageSeconds": 3600,
+		"workers": [
+			{"pid": 2, "status": "active", "ageSeconds": 3600},
+			{"pid": 3, "status": "shutdown", "ageSeconds": 3600, "drainingSeconds": 90},
+			{"pid": 4, "status": "shutdown", "ageSeconds": 3600}
+		]
+	}]`, string(body))
+}
+
+func TestReaper_TreeDuringRun(t *testing.T) {
+	mockProcpsPgrep := MockProcpsPgrep{}
+	mockProcpsPgrep.On("Call").Return([]*procps.Process{{Pid: 1}}, []*procps.Process{})
+	procpsPgrep = mockProcpsPgrep.Call
+	defer func() { procpsPgrep = (*procps.Snapshot).Pgrep }()
+
+	// A run in progress holds the mutex, e.g. while escalating the signals.
+	r := NewReaper(1, 1, 0)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	done := make(chan ProcessTree)
+	go func() {
+		tree, _ := r.Tree()
+		done <- tree
+	}()
+	select {
+	case tree := <-done:
+		assert.Len(t, tree, 1)
+	case <-time.After(time.Second):
+		assert.Fail(t, "Tree waits for the run in progress")
+	}
+}
+
+func TestReaper_TreeError(t *testing.T) {
+	procpsNewSnapshot = func() (*procps.Snapshot, error) { return nil, errors.New("no processes") }
+	defer func() { procpsNewSnapshot = procps.NewSnapshot }()
+
+	got, err := NewReaper(1, 1, 0).Tree()
+	assert.Error(t, err)
+	assert.Nil(t, got)
+}
+
+func TestProcessTree_WriteText(t *testing.T) {
+	tree := ProcessTree{
+		{
+			ProcessInfo: &procps.ProcessInfo{
+				Pid: 64, State: "S", RSS: 1024, VMS: 4096, Cmdline: "nginx: master process /usr/sbin/nginx",
+			},
+			Profile:    "nginx",
+			AgeSeconds: 7200,
+			Workers: []*ProcessNode{
+				{
+					ProcessInfo: &procps.ProcessInfo{Pid: 100, State: "S", RSS: 2048, VMS: 4096, Cmdline: "nginx: worker process"},
+					Status:      LabelActive,
+					AgeSeconds:  60.4,
+				},
+				{
+					ProcessInfo: &procps.ProcessInfo{
+						Pid: 101, State: "S", RSS: 2048, VMS: 4096, Cmdline: "nginx: worker process is shutting down",
+					},
+					Status:          LabelShutdown,
+					AgeSeconds:      3600,
+					DrainingSeconds: 150,
+				},
+			},
+		},
+	}
+	var b bytes.Buffer
+	assert.NoError(t, tree.WriteText(&b))
+	assert.Equal(t, ""+
+		"PID  STATE  AGE     DRAINING  RSS   VMS   COMMAND\n"+
+		"64   S      2h0m0s  -         1024  4096  nginx: master process /usr/sbin/nginx\n"+
+		"100  S      1m0s    -         2048  4096   \\_ nginx: worker process\n"+
+		"101  S      1h0m0s  2m30s     2048  4096   \\_ nginx: worker process is shutting down\n",
+		b.String())
+}
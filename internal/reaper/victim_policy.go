@@ -0,0 +1,85 @@
+package reaper
+
+import (
+	"fmt"
+	"nginx-reaper/internal/procps"
+	"strings"
+)
+
+// VictimPolicy is an interface that defines the order in which shutting down Nginx workers are terminated.
+type VictimPolicy interface {
+	Name() string                 // Name returns the name of the VictimPolicy.
+	Sort(procs []*procps.Process) // Sort orders processes so that the first process is terminated first.
+}
+
+// Built-in victim policies.
+var (
+	// OldestFirst terminates the oldest workers first, the default policy.
+	OldestFirst VictimPolicy = &victimPolicy{name: "oldest-first", sort: procps.SortByCreateTime}
+
+	// NewestFirst terminates the newest workers first.
+	NewestFirst VictimPolicy = &victimPolicy{name: "newest-first", sort: sortByNewest}
+
+	// LargestRSSFirst terminates workers with the largest resident set size first to free the most memory per kill.
+	LargestRSSFirst VictimPolicy = &victimPolicy{name: "largest-rss-first", sort: sortByLargestRSS}
+
+	// FewestConnectionsFirst terminates workers with the fewest open connections first to drop the fewest clients.
+	FewestConnectionsFirst VictimPolicy = &victimPolicy{name: "fewest-connections-first", sort: sortByFewestConnections}
+)
+
+// VictimPolicy name to VictimPolicy mapping.
+var victimPolicies = map[string]VictimPolicy{
+	OldestFirst.Name():            OldestFirst,
+	NewestFirst.Name():            NewestFirst,
+	LargestRSSFirst.Name():        LargestRSSFirst,
+	FewestConnectionsFirst.Name(): FewestConnectionsFirst,
+}
+
+// ParseVictimPolicy converts case-insensitive string to VictimPolicy. Returns error if invalid.
+// E.g. "largest-rss-first" becomes LargestRSSFirst.
+func ParseVictimPolicy(name string) (VictimPolicy, error) {
+	if p, ok := victimPolicies[strings.ToLower(name)]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("invalid victim policy: %q", name)
+}
+
+// victimPolicy is a VictimPolicy implementation based on a sort function.
+type victimPolicy struct {
+	name string
+	sort func([]*procps.Process)
+}
+
+// Name returns the name of the victimPolicy.
+func (p *victimPolicy) Name() string {
+	return p.name
+}
+
+// Sort orders processes using the sort function of the victimPolicy.
+func (p *victimPolicy) Sort(procs []*procps.Process) {
+	p.sort(procs)
+}
+
+// String returns a string representation of the victimPolicy.
+func (p *victimPolicy) String() string {
+	return p.name
+}
+
+// sortByNewest sorts processes by creation time in descending order.
+func sortByNewest(procs []*procps.Process) {
+	procps.SortBy(procs, func(proc *procps.Process) (int64, error) {
+		return -proc.CreateTime(), nil
+	})
+}
+
+// sortByLargestRSS sorts processes by resident set size in descending order.
+func sortByLargestRSS(procs []*procps.Process) {
+	procps.SortBy(procs, func(proc *procps.Process) (int64, error) {
+		return -int64(proc.RSS()), nil
+	})
+}
+
+// sortByFewestConnections sorts processes by number of open sockets in ascending order.
+func sortByFewestConnections(procs []*procps.Process) {
+	procps.SortBy(procs, procps.NumSockets)
+}
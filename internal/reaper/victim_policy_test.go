@@ -0,0 +1,113 @@
+package reaper
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"nginx-reaper/internal/log"
+	"nginx-reaper/internal/procps"
+	"os"
+	"testing"
+)
+
+func TestParseVictimPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		want    VictimPolicy
+		wantErr bool
+	}{
+		{
+			name:    "Empty",
+			policy:  "",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid",
+			policy:  "random",
+			wantErr: true,
+		},
+		{
+			name:   "OldestFirst",
+			policy: "oldest-first",
+			want:   OldestFirst,
+		},
+		{
+			name:   "NewestFirst",
+			policy: "Newest-First",
+			want:   NewestFirst,
+		},
+		{
+			name:   "LargestRSSFirst",
+			policy: "LARGEST-RSS-FIRST",
+			want:   LargestRSSFirst,
+		},
+		{
+			name:   "FewestConnectionsFirst",
+			policy: "fewest-connections-first",
+			want:   FewestConnectionsFirst,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVictimPolicy(tt.policy)
+			assert.Equal(t, tt.want, got)
+			if tt.wantErr {
+				log.Error(err)
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want.Name(), got.(*victimPolicy).String())
+			}
+		})
+	}
+}
+
+func TestVictimPolicy_Sort(t *testing.T) {
+	pid1Proc, _ := procps.NewProcess(1)
+	currentProc, _ := procps.NewProcess(int32(os.Getpid()))
+	parentProc, _ := procps.NewProcess(currentProc.Ppid())
+	noProc := &procps.Process{Pid: -2}
+
+	// Make sure the current process has more open sockets than its parent.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+
+	tests := []struct {
+		name      string
+		policy    VictimPolicy
+		processes []*procps.Process
+		want      []*procps.Process
+	}{
+		{
+			name:      "OldestFirst",
+			policy:    OldestFirst,
+			processes: []*procps.Process{parentProc, currentProc, pid1Proc},
+			want:      []*procps.Process{pid1Proc, parentProc, currentProc},
+		},
+		{
+			name:      "NewestFirst",
+			policy:    NewestFirst,
+			processes: []*procps.Process{noProc, parentProc, pid1Proc, currentProc},
+			want:      []*procps.Process{currentProc, parentProc, pid1Proc, noProc},
+		},
+		{
+			name:      "LargestRSSFirst",
+			policy:    LargestRSSFirst,
+			processes: []*procps.Process{noProc, currentProc},
+			want:      []*procps.Process{currentProc, noProc},
+		},
+		{
+			name:      "FewestConnectionsFirst",
+			policy:    FewestConnectionsFirst,
+			processes: []*procps.Process{noProc, currentProc},
+			want:      []*procps.Process{currentProc, noProc},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.policy.Sort(tt.processes)
+			assert.Equal(t, tt.want, tt.processes)
+		})
+	}
+}
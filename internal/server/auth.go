@@ -0,0 +1,290 @@
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"nginx-reaper/internal/log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope defines which endpoints a credential grants access to.
+type Scope uint32
+
+// Authorization scopes.
+const (
+	ScopeRead  Scope = iota // ScopeRead grants access to the read endpoints, e.g. GET /config and GET /workers.
+	ScopeWrite              // ScopeWrite grants access to the read and the control endpoints, e.g. POST /reap.
+)
+
+// Scope name to Scope mapping.
+var authScopes = map[string]Scope{
+	"read":  ScopeRead,
+	"write": ScopeWrite,
+}
+
+// ParseScope converts case-insensitive string to Scope. Returns error if invalid.
+// E.g. "read" becomes ScopeRead.
+func ParseScope(name string) (Scope, error) {
+	if s, ok := authScopes[strings.ToLower(name)]; ok {
+		return s, nil
+	}
+	return 0, fmt.Errorf("invalid scope: %q", name)
+}
+
+// String returns the name of the Scope.
+func (s Scope) String() string {
+	for name, scope := range authScopes {
+		if scope == s {
+			return name
+		}
+	}
+	return fmt.Sprintf("Scope(%d)", s)
+}
+
+// ParseClientScopes converts a comma-separated list of client certificate names and optionally their scopes,
+// ScopeWrite by default, to a mapping of the names to the scopes, or nil if the list is empty. Returns error if a scope
+// is invalid, with an empty mapping granting no scope, so that a mapping with a typo never grants ScopeWrite to every
+// client certificate. E.g. "dashboard=read,oncall@example.com" grants ScopeRead to "dashboard" and ScopeWrite to
+// "oncall@example.com".
+func ParseClientScopes(value string) (map[string]Scope, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	scopes := make(map[string]Scope)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, scope := entry, ScopeWrite
+		// The scope follows the last "=", as a distinguished name or a URI may contain "=".
+		if i := strings.LastIndex(entry, "="); i >= 0 {
+			var err error
+			if scope, err = ParseScope(strings.TrimSpace(entry[i+1:])); err != nil {
+				return map[string]Scope{}, fmt.Errorf("invalid client scopes: %w", err)
+			}
+			name = strings.TrimSpace(entry[:i])
+		}
+		scopes[name] = scope
+	}
+	return scopes, nil
+}
+
+// Credentials required by requests to the endpoints. Without a bearer token or a verified client certificate,
+// the control endpoints are forbidden. The read endpoints are open unless readAuth is set.
+var (
+	authMutex    sync.RWMutex
+	token        string           // Bearer token of ScopeWrite.
+	tokens       *tokenFile       // Bearer tokens read from a file, if any.
+	readAuth     bool             // Whether the read endpoints require ScopeRead.
+	clientScopes map[string]Scope // Scopes of the client certificate names, or nil if all grant ScopeWrite.
+)
+
+// SetToken sets the bearer token of ScopeWrite required by requests to the control endpoints.
+func SetToken(t string) {
+	authMutex.Lock()
+	defer authMutex.Unlock()
+	token = t
+}
+
+// SetTokenFile sets the file of the bearer tokens, e.g. a mounted Kubernetes Secret. The file is re-read when it
+// changes. Each line contains a token and optionally its scope, "write" by default, e.g. "s3cr3t read".
+// Empty lines and lines starting with "#" are ignored.
+func SetTokenFile(path string) {
+	authMutex.Lock()
+	defer authMutex.Unlock()
+	if path == "" {
+		tokens = nil
+	} else {
+		tokens = &tokenFile{path: path}
+	}
+}
+
+// SetReadAuth sets whether requests to the read endpoints require credentials of ScopeRead.
+func SetReadAuth(required bool) {
+	authMutex.Lock()
+	defer authMutex.Unlock()
+	readAuth = required
+}
+
+// SetClientScopes sets the scopes granted by the verified client certificates by their names, the subject common
+// name or a DNS, email or URI subject alternative name. The certificate is granted the highest scope of its names,
+// and none if no name is listed. If nil, every verified client certificate grants ScopeWrite.
+func SetClientScopes(scopes map[string]Scope) {
+	authMutex.Lock()
+	defer authMutex.Unlock()
+	clientScopes = scopes
+}
+
+// NewTLSConfig returns the TLS configuration of the server. If the file of the client CA certificates is specified,
+// the client certificates are verified, and verified client certificates grant the scope set by SetClientScopes.
+// Requests without a client certificate are still accepted, e.g. by the metrics endpoint. Returns error if the file
+// cannot be read.
+func NewTLSConfig(clientCAFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAFile == "" {
+		return config, nil
+	}
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %q", clientCAFile)
+	}
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	return config, nil
+}
+
+// authorized returns a bool indicating whether the request has a verified client certificate or a bearer token
+// in the Authorization header, granting the scope. Otherwise, responds with the error.
+func authorized(w http.ResponseWriter, r *http.Request, scope Scope) bool {
+	authMutex.RLock()
+	file, want, names, open := tokens, token, clientScopes, scope == ScopeRead && !readAuth
+	authMutex.RUnlock()
+	if open {
+		return true
+	}
+
+	// A client certificate lacking the scope is rejected, unless a bearer token is given as well.
+	certScope, certified := certificateScope(r, names)
+	if certified && certScope >= scope {
+		return true
+	}
+	if certified && r.Header.Get("Authorization") == "" {
+		writeError(w, r, http.StatusForbidden, fmt.Errorf("client certificate of scope %v, %v required", certScope, scope))
+		return false
+	}
+	granted := make(map[string]Scope)
+	if file != nil {
+		granted = file.read()
+	}
+	if want != "" {
+		granted[want] = ScopeWrite
+	}
+	if len(granted) == 0 {
+		writeError(w, r, http.StatusForbidden, errors.New("no bearer token configured"))
+		return false
+	}
+
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	matched, found := ScopeRead, false
+	for t, s := range granted {
+		// Compare all tokens in constant time.
+		if subtle.ConstantTimeCompare([]byte(got), []byte(t)) == 1 {
+			matched, found = s, true
+		}
+	}
+	switch {
+	case !ok || !found:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="nginx-reaper"`)
+		writeError(w, r, http.StatusUnauthorized, errors.New("invalid bearer token"))
+		return false
+	case matched < scope:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="nginx-reaper", error="insufficient_scope"`)
+		writeError(w, r, http.StatusForbidden, fmt.Errorf("bearer token of scope %v, %v required", matched, scope))
+		return false
+	}
+	return true
+}
+
+// certificateScope returns the highest scope the names grant to the verified client certificate of the request, and
+// a bool indicating whether any is granted. If names is nil, a verified client certificate grants ScopeWrite.
+func certificateScope(r *http.Request, names map[string]Scope) (Scope, bool) {
+	// The TLS handshake verified the client certificate with the client CA certificates.
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ScopeRead, false
+	}
+	if names == nil {
+		return ScopeWrite, true
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	certNames := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	certNames = append(certNames, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		certNames = append(certNames, uri.String())
+	}
+	granted, found := ScopeRead, false
+	for _, name := range certNames {
+		if s, ok := names[name]; ok && name != "" {
+			granted, found = max(granted, s), true
+		}
+	}
+	return granted, found
+}
+
+// tokenFile is a file of bearer tokens, re-read when its modification time or size changes.
+type tokenFile struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	size    int64
+	tokens  map[string]Scope
+}
+
+// read returns a copy of the bearer tokens of the file, re-reading the file if it changed. If the file cannot be
+// read, no tokens are returned until it can.
+func (f *tokenFile) read() map[string]Scope {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err == nil && (!info.ModTime().Equal(f.modTime) || info.Size() != f.size || f.tokens == nil) {
+		var tokens map[string]Scope
+		if tokens, err = readTokens(f.path); err == nil {
+			log.Infof("Read %d bearer tokens from %q", len(tokens), f.path)
+			f.modTime, f.size, f.tokens = info.ModTime(), info.Size(), tokens
+		}
+	}
+	if err != nil {
+		log.Errorf("Failed to read bearer tokens: %v", err)
+		f.modTime, f.size, f.tokens = time.Time{}, 0, nil
+	}
+
+	tokens := make(map[string]Scope, len(f.tokens))
+	for t, s := range f.tokens {
+		tokens[t] = s
+	}
+	return tokens
+}
+
+// readTokens reads the bearer tokens and their scopes from the file. Returns error if the file cannot be read or
+// a line is invalid.
+func readTokens(path string) (map[string]Scope, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	tokens := make(map[string]Scope)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		scope := ScopeWrite
+		switch len(fields) {
+		case 1:
+		case 2:
+			if scope, err = ParseScope(fields[1]); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+		default:
+			return nil, fmt.Errorf("%s:%d: invalid token line", path, line)
+		}
+		tokens[fields[0]] = scope
+	}
+	return tokens, scanner.Err()
+}
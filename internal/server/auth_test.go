@@ -0,0 +1,471 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Scope
+		wantErr bool
+	}{
+		{name: "read", want: ScopeRead},
+		{name: "WRITE", want: ScopeWrite},
+		{name: "admin", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScope(tt.name)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestScope_String(t *testing.T) {
+	assert.Equal(t, "read", ScopeRead.String())
+	assert.Equal(t, "write", ScopeWrite.String())
+	assert.Equal(t, "Scope(2)", Scope(2).String())
+}
+
+func TestParseClientScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]Scope
+		wantErr bool
+	}{
+		{
+			name:  "Scopes",
+			value: " dashboard = read ,oncall@example.com,, spiffe://cluster/ns/ops?role=admin=write",
+			want: map[string]Scope{
+				"dashboard":                          ScopeRead,
+				"oncall@example.com":                 ScopeWrite,
+				"spiffe://cluster/ns/ops?role=admin": ScopeWrite,
+			},
+		},
+		{
+			name:  "Empty",
+			value: " ",
+		},
+		{
+			name:  "NoNames",
+			value: ",",
+			want:  map[string]Scope{},
+		},
+		{
+			name:    "InvalidScope",
+			value:   "oncall,dashboard=admin",
+			want:    map[string]Scope{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClientScopes(tt.value)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_authorized(t *testing.T) {
+	// A mapping with a typo in a scope grants no scope to any client certificate.
+	invalidScopes, err := ParseClientScopes("oncall=wirte")
+	assert.Error(t, err)
+
+	type args struct {
+		token         string
+		tokenFile     string
+		readAuth      bool
+		verified      *x509.Certificate
+		clientScopes  map[string]Scope
+		scope         Scope
+		authorization string
+	}
+	type want struct {
+		authorized bool
+		code       int
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "NoToken",
+			args: args{
+				scope:         ScopeWrite,
+				authorization: "Bearer ",
+			},
+			want: want{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			name: "NoAuthorization",
+			args: args{
+				token: "secret",
+				scope: ScopeWrite,
+			},
+			want: want{
+				code: http.StatusUnauthorized,
+			},
+		},
+		{
+			name: "InvalidScheme",
+			args: args{
+				token:         "secret",
+				scope:         ScopeWrite,
+				authorization: "Basic secret",
+			},
+			want: want{
+				code: http.StatusUnauthorized,
+			},
+		},
+		{
+			name: "InvalidToken",
+			args: args{
+				token:         "secret",
+				scope:         ScopeWrite,
+				authorization: "Bearer secrets",
+			},
+			want: want{
+				code: http.StatusUnauthorized,
+			},
+		},
+		{
+			name: "Authorized",
+			args: args{
+				token:         "secret",
+				scope:         ScopeWrite,
+				authorization: "Bearer secret",
+			},
+			want: want{
+				authorized: true,
+				code:       http.StatusOK,
+			},
+		},
+		{
+			name: "ReadOpen",
+			args: args{
+				scope: ScopeRead,
+			},
+			want: want{
+				authorized: true,
+				code:       http.StatusOK,
+			},
+		},
+		{
+			name: "ReadUnauthorized",
+			args: args{
+				token:    "secret",
+				readAuth: true,
+				scope:    ScopeRead,
+			},
+			want: want{
+				code: http.StatusUnauthorized,
+			},
+		},
+		{
+			name: "ReadWithWriteToken",
+			args: args{
+				token:         "secret",
+				readAuth:      true,
+				scope:         ScopeRead,
+				authorization: "Bearer secret",
+			},
+			want: want{
+				authorized: true,
+				code:       http.StatusOK,
+			},
+		},
+		{
+			name: "FileReadToken",
+			args: args{
+				tokenFile:     "# tokens\nviewer read\n\noperator write\n",
+				readAuth:      true,
+				scope:         ScopeRead,
+				authorization: "Bearer viewer",
+			},
+			want: want{
+				authorized: true,
+				code:       http.StatusOK,
+			},
+		},
+		{
+			name: "FileInsufficientScope",
+			args: args{
+				tokenFile:     "viewer read\noperator\n",
+				scope:         ScopeWrite,
+				authorization: "Bearer viewer",
+			},
+			want: want{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			name: "FileWriteToken",
+			args: args{
+				tokenFile:     "viewer read\noperator\n",
+				scope:         ScopeWrite,
+				authorization: "Bearer operator",
+			},
+			want: want{
+				authorized: true,
+				code:       http.StatusOK,
+			},
+		},
+		{
+			name: "FileInvalid",
+			args: args{
+				tokenFile:     "operator admin\n",
+				scope:         ScopeWrite,
+				authorization: "Bearer operator",
+			},
+			want: want{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			name: "ClientCertificate",
+			args: args{
+				verified: &x509.Certificate{},
+				scope:    ScopeWrite,
+			},
+			want: want{
+				authorized: true,
+				code:       http.StatusOK,
+			},
+		},
+		{
+			name: "ReadOnlyClientCertificate",
+			args: args{
+				verified:     &x509.Certificate{Subject: pkix.Name{CommonName: "dashboard"}},
+				clientScopes: map[string]Scope{"dashboard": ScopeRead, "oncall": ScopeWrite},
+				scope:        ScopeWrite,
+			},
+			want: want{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			name: "ReadOnlyClientCertificateRead",
+			args: args{
+				token:        "secret",
+				readAuth:     true,
+				verified:     &x509.Certificate{Subject: pkix.Name{CommonName: "dashboard"}},
+				clientScopes: map[string]Scope{"dashboard": ScopeRead},
+				scope:        ScopeRead,
+			},
+			want: want{
+				authorized: true,
+				code:       http.StatusOK,
+			},
+		},
+		{
+			name: "ReadOnlyClientCertificateWithToken",
+			args: args{
+				token:         "secret",
+				verified:      &x509.Certificate{Subject: pkix.Name{CommonName: "dashboard"}},
+				clientScopes:  map[string]Scope{"dashboard": ScopeRead},
+				scope:         ScopeWrite,
+				authorization: "Bearer secret",
+			},
+			want: want{
+				authorized: true,
+				code:       http.StatusOK,
+			},
+		},
+		{
+			name: "ClientCertificateAlternativeName",
+			args: args{
+				verified: &x509.Certificate{
+					Subject:  pkix.Name{CommonName: "dashboard"},
+					DNSNames: []string{"oncall.example.com"},
+				},
+				clientScopes: map[string]Scope{"dashboard": ScopeRead, "oncall.example.com": ScopeWrite},
+				scope:        ScopeWrite,
+			},
+			want: want{
+				authorized: true,
+				code:       http.StatusOK,
+			},
+		},
+		{
+			name: "InvalidClientScopes",
+			args: args{
+				verified:     &x509.Certificate{Subject: pkix.Name{CommonName: "oncall"}},
+				clientScopes: invalidScopes,
+				scope:        ScopeWrite,
+			},
+			want: want{
+				code: http.StatusForbidden,
+			},
+		},
+		{
+			name: "UnlistedClientCertificate",
+			args: args{
+				token:        "secret",
+				verified:     &x509.Certificate{Subject: pkix.Name{CommonName: "other"}},
+				clientScopes: map[string]Scope{"dashboard": ScopeWrite},
+				scope:        ScopeWrite,
+			},
+			want: want{
+				code: http.StatusUnauthorized,
+			},
+		},
+	}
+	defer SetToken("")
+	defer SetTokenFile("")
+	defer SetReadAuth(false)
+	defer SetClientScopes(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetToken(tt.args.token)
+			SetReadAuth(tt.args.readAuth)
+			SetClientScopes(tt.args.clientScopes)
+			SetTokenFile("")
+			if tt.args.tokenFile != "" {
+				path := filepath.Join(t.TempDir(), "tokens")
+				assert.NoError(t, os.WriteFile(path, []byte(tt.args.tokenFile), 0o600))
+				SetTokenFile(path)
+			}
+
+			writer := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, reapPath, nil)
+			request.Header.Set("Authorization", tt.args.authorization)
+			if tt.args.verified != nil {
+				request.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.args.verified}}}
+			}
+			assert.Equal(t, tt.want.authorized, authorized(writer, request, tt.args.scope))
+			assert.Equal(t, tt.want.code, writer.Result().StatusCode)
+		})
+	}
+}
+
+func Test_tokenFile_read(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	file := &tokenFile{path: path}
+
+	// Missing file.
+	assert.Empty(t, file.read())
+
+	assert.NoError(t, os.WriteFile(path, []byte("old\n"), 0o600))
+	assert.Equal(t, map[string]Scope{"old": ScopeWrite}, file.read())
+
+	// Rotated token, re-read as the modification time changed.
+	assert.NoError(t, os.WriteFile(path, []byte("new read\n"), 0o600))
+	assert.NoError(t, os.Chtimes(path, time.Time{}, time.Now().Add(time.Minute)))
+	assert.Equal(t, map[string]Scope{"new": ScopeRead}, file.read())
+
+	// Removed file revokes the tokens.
+	assert.NoError(t, os.Remove(path))
+	assert.Empty(t, file.read())
+}
+
+func Test_readTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]Scope
+		wantErr bool
+	}{
+		{
+			name:    "Tokens",
+			content: "# comment\n  viewer  READ \n\noperator\nadmin write\n",
+			want:    map[string]Scope{"viewer": ScopeRead, "operator": ScopeWrite, "admin": ScopeWrite},
+		},
+		{
+			name:    "Empty",
+			content: "",
+			want:    map[string]Scope{},
+		},
+		{
+			name:    "InvalidScope",
+			content: "operator admin\n",
+			wantErr: true,
+		},
+		{
+			name:    "InvalidLine",
+			content: "operator write read\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens")
+			assert.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+			got, err := readTokens(path)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// writeCertificate writes a self-signed PEM certificate of localhost and its private key to temporary files and
+// returns their paths.
+func writeCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "nginx-reaper"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	t.Run("NoClientCA", func(t *testing.T) {
+		config, err := NewTLSConfig("")
+		assert.NoError(t, err)
+		assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+		assert.Nil(t, config.ClientCAs)
+	})
+	t.Run("ClientCA", func(t *testing.T) {
+		certFile, _ := writeCertificate(t)
+		config, err := NewTLSConfig(certFile)
+		assert.NoError(t, err)
+		assert.Equal(t, tls.VerifyClientCertIfGiven, config.ClientAuth)
+		assert.NotNil(t, config.ClientCAs)
+	})
+	t.Run("NotFound", func(t *testing.T) {
+		_, err := NewTLSConfig(filepath.Join(t.TempDir(), "ca.crt"))
+		assert.Error(t, err)
+	})
+	t.Run("NoCertificates", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ca.crt")
+		assert.NoError(t, os.WriteFile(path, []byte("invalid"), 0o600))
+		_, err := NewTLSConfig(path)
+		assert.Error(t, err)
+	})
+}
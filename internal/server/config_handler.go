@@ -1,28 +1,69 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"nginx-reaper/internal/log"
+	"sync"
 )
 
 const (
 	configPath  = "/config"
 	keyLogLevel = "log-level"
+
+	// Maximum size of the JSON body of requests, e.g. PATCH requests to the configPath endpoint.
+	maxBodyBytes = 1 << 20
+)
+
+// Values reported by GET requests to the configPath endpoint, by key.
+var (
+	configMutex  sync.RWMutex
+	configValues = make(map[string]any)
 )
 
+// SetConfigValue sets a value reported by GET requests to the configPath endpoint, e.g. the parsed Nginx
+// configuration. The value is encoded as JSON on each request.
+func SetConfigValue(key string, value any) {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	configValues[key] = value
+}
+
+// Patcher is a config value that can be changed by PATCH requests to the configPath endpoint, e.g. the Reaper.
+type Patcher interface {
+	// Patch changes the config value by the JSON value of its key in the request body.
+	Patch(body json.RawMessage) error
+}
+
 // configHandler responds to requests to the configPath endpoint.
-// E.g. "PUT /config?log-level=debug".
+// E.g. "GET /config", "PATCH /config" or "PUT /config?log-level=debug". GET requires ScopeRead, PATCH and PUT
+// require ScopeWrite.
 func configHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debugf("Request %v", r)
-	if r.URL.Path != configPath {
+	scope := ScopeWrite
+	if r.Method == http.MethodGet {
+		scope = ScopeRead
+	}
+	switch {
+	case r.URL.Path != configPath:
 		w.WriteHeader(http.StatusNotFound)
-	} else if r.Method != http.MethodPut {
+	case r.Method != http.MethodGet && r.Method != http.MethodPatch && r.Method != http.MethodPut:
 		w.WriteHeader(http.StatusMethodNotAllowed)
-	} else if err := setLogLevel(r); err != nil {
-		log.Errorf("Request %v failed: %v", r, err)
-		w.WriteHeader(http.StatusBadRequest)
-	} else {
-		w.WriteHeader(http.StatusNoContent)
+	case !authorized(w, r, scope):
+		// Responded with the error.
+	case r.Method == http.MethodGet:
+		writeConfig(w, r)
+	case r.Method == http.MethodPatch:
+		patchConfig(w, r)
+	default:
+		if err := setLogLevel(r); err != nil {
+			log.Errorf("Request %v failed: %v", r, err)
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
 	}
 }
 
@@ -36,3 +77,78 @@ func setLogLevel(r *http.Request) error {
 	log.SetLevel(l)
 	return nil
 }
+
+// writeConfig responds with the JSON object of the config values.
+func writeConfig(w http.ResponseWriter, r *http.Request) {
+	configMutex.RLock()
+	body, err := json.Marshal(configValues)
+	configMutex.RUnlock()
+	if err != nil {
+		log.Errorf("Request %v failed: %v", r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(body); err != nil {
+		log.Errorf("Request %v failed: %v", r, err)
+	}
+}
+
+// patchConfig changes the config values by the JSON object of the request body, e.g.
+// {"reaper": {"max_shutdown_workers": 8}}, and responds with the JSON object of the config values.
+// Only config values implementing Patcher can be changed.
+func patchConfig(w http.ResponseWriter, r *http.Request) {
+	var values map[string]json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&values); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	patchers := make(map[string]Patcher, len(values))
+	configMutex.RLock()
+	for key := range values {
+		if patcher, ok := configValues[key].(Patcher); ok {
+			patchers[key] = patcher
+		}
+	}
+	configMutex.RUnlock()
+
+	for key := range values {
+		if patchers[key] == nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Errorf("config value %q cannot be changed", key))
+			return
+		}
+	}
+	for key, value := range values {
+		if err := patchers[key].Patch(value); err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	writeConfig(w, r)
+}
+
+// writeError responds with the status and the JSON object of the error, including the details of errors
+// encoded as JSON, e.g. {"error": "invalid configuration: ...", "details": [...]}.
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	log.Errorf("Request %v failed: %v", r, err)
+	response := struct {
+		Error   string         `json:"error"`
+		Details json.Marshaler `json:"details,omitempty"`
+	}{Error: err.Error()}
+	var details json.Marshaler
+	if errors.As(err, &details) {
+		response.Details = details
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		log.Errorf("Request %v failed: %v", r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		log.Errorf("Request %v failed: %v", r, err)
+	}
+}
@@ -1,20 +1,52 @@
 package server
 
 import (
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"nginx-reaper/internal/log"
+	"strings"
 	"testing"
 	_ "unsafe"
 )
 
+// MockPatcher is a config value that can be changed by PATCH requests.
+type MockPatcher struct {
+	Workers int `json:"workers"`
+}
+
+func (m *MockPatcher) Patch(body json.RawMessage) error {
+	var values map[string]int
+	if err := json.Unmarshal(body, &values); err != nil {
+		return err
+	}
+	if values["workers"] <= 0 {
+		return MockPatchErrors{"workers"}
+	}
+	m.Workers = values["workers"]
+	return nil
+}
+
+// MockPatchErrors is an error with details encoded as JSON.
+type MockPatchErrors []string
+
+func (e MockPatchErrors) Error() string {
+	return "invalid " + strings.Join(e, ", ")
+}
+
+func (e MockPatchErrors) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string(e))
+}
+
 func Test_configHandler(t *testing.T) {
 	type args struct {
-		method string
-		target string
+		method        string
+		target        string
+		body          string
+		authorization string
 	}
 	type want struct {
 		code int
@@ -38,18 +70,82 @@ func Test_configHandler(t *testing.T) {
 		{
 			name: "MethodNotAllowed",
 			args: args{
-				method: http.MethodGet,
+				method: http.MethodPost,
 				target: configPath,
 			},
 			want: want{
 				code: http.StatusMethodNotAllowed,
 			},
 		},
+		{
+			name: "Get",
+			args: args{
+				method: http.MethodGet,
+				target: configPath,
+			},
+			want: want{
+				code: http.StatusOK,
+				body: `{"nginx":{"worker_processes":4},"reaper":{"workers":1}}`,
+			},
+		},
+		{
+			name: "PatchInvalidBody",
+			args: args{
+				method:        http.MethodPatch,
+				target:        configPath,
+				authorization: "Bearer secret",
+				body:          `[`,
+			},
+			want: want{
+				code: http.StatusBadRequest,
+				body: `{"error":"invalid request body: unexpected EOF"}`,
+			},
+		},
+		{
+			name: "PatchNotPatcher",
+			args: args{
+				method:        http.MethodPatch,
+				target:        configPath,
+				authorization: "Bearer secret",
+				body:          `{"nginx":{"worker_processes":8}}`,
+			},
+			want: want{
+				code: http.StatusBadRequest,
+				body: `{"error":"config value \"nginx\" cannot be changed"}`,
+			},
+		},
+		{
+			name: "PatchInvalid",
+			args: args{
+				method:        http.MethodPatch,
+				target:        configPath,
+				authorization: "Bearer secret",
+				body:          `{"reaper":{"workers":0}}`,
+			},
+			want: want{
+				code: http.StatusBadRequest,
+				body: `{"error":"invalid workers","details":["workers"]}`,
+			},
+		},
+		{
+			name: "Patch",
+			args: args{
+				method:        http.MethodPatch,
+				target:        configPath,
+				authorization: "Bearer secret",
+				body:          `{"reaper":{"workers":2}}`,
+			},
+			want: want{
+				code: http.StatusOK,
+				body: `{"nginx":{"worker_processes":4},"reaper":{"workers":2}}`,
+			},
+		},
 		{
 			name: "BadRequest",
 			args: args{
-				method: http.MethodPut,
-				target: configPath + "?" + keyLogLevel + "=xxx",
+				method:        http.MethodPut,
+				target:        configPath + "?" + keyLogLevel + "=xxx",
+				authorization: "Bearer secret",
 			},
 			want: want{
 				code: http.StatusBadRequest,
@@ -57,19 +153,55 @@ func Test_configHandler(t *testing.T) {
 		},
 		{
 			name: "NoContent",
+			args: args{
+				method:        http.MethodPut,
+				target:        configPath + "?" + keyLogLevel + "=debug",
+				authorization: "Bearer secret",
+			},
+			want: want{
+				code: http.StatusNoContent,
+			},
+		},
+		{
+			name: "PutUnauthorized",
 			args: args{
 				method: http.MethodPut,
 				target: configPath + "?" + keyLogLevel + "=debug",
 			},
 			want: want{
-				code: http.StatusNoContent,
+				code: http.StatusUnauthorized,
+				body: `{"error":"invalid bearer token"}`,
+			},
+		},
+		{
+			name: "PatchUnauthorized",
+			args: args{
+				method:        http.MethodPatch,
+				target:        configPath,
+				body:          `{"reaper":{"workers":3}}`,
+				authorization: "Bearer invalid",
+			},
+			want: want{
+				code: http.StatusUnauthorized,
+				body: `{"error":"invalid bearer token"}`,
 			},
 		},
 	}
+	SetConfigValue("nginx", map[string]int{"worker_processes": 4})
+	SetConfigValue("reaper", &MockPatcher{Workers: 1})
+	SetToken("secret")
+	defer SetToken("")
+	defer func() {
+		configMutex.Lock()
+		defer configMutex.Unlock()
+		clear(configValues)
+	}()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			writer := httptest.NewRecorder()
-			configHandler(writer, httptest.NewRequest(tt.args.method, tt.args.target, nil))
+			request := httptest.NewRequest(tt.args.method, tt.args.target, strings.NewReader(tt.args.body))
+			request.Header.Set("Authorization", tt.args.authorization)
+			configHandler(writer, request)
 			resp := writer.Result()
 			body, err := io.ReadAll(resp.Body)
 			assert.NoError(t, err)
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"nginx-reaper/internal/log"
+	"sync"
+)
+
+const (
+	livenessPath  = "/healthz"
+	readinessPath = "/readyz"
+)
+
+// Health is a health report returned by GET requests to the livenessPath and readinessPath endpoints, encoded as JSON.
+type Health interface {
+	Healthy() bool // Healthy returns whether all checks of the Health are healthy.
+}
+
+// Functions returning the health reports of the livenessPath and readinessPath endpoints, nil until set.
+var (
+	healthMutex sync.RWMutex
+	healthFuncs = make(map[string]func() Health)
+)
+
+// SetHealth sets the functions returning the health reports of GET requests to the livenessPath and readinessPath
+// endpoints, e.g. the health checks of the Reaper.
+func SetHealth(liveness, readiness func() Health) {
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	healthFuncs[livenessPath] = liveness
+	healthFuncs[readinessPath] = readiness
+}
+
+// healthHandler responds to requests to the livenessPath and readinessPath endpoints with the health report,
+// with status 200 if healthy and 503 otherwise. Responds as defaultHandler until the health functions are set.
+// E.g. "GET /readyz".
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	healthMutex.RLock()
+	healthFunc := healthFuncs[r.URL.Path]
+	healthMutex.RUnlock()
+
+	if healthFunc == nil {
+		defaultHandler(w, r)
+		return
+	}
+	log.Debugf("Request %v", r)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	health := healthFunc()
+	w.Header().Set("Content-Type", "application/json")
+	if health.Healthy() {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		log.Warningf("Request %v unhealthy: %+v", r.URL.Path, health)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(health); err != nil {
+		log.Errorf("Request %v failed: %v", r, err)
+	}
+}
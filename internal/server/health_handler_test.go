@@ -0,0 +1,91 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// MockHealth is a health report of a single check.
+type MockHealth map[string]bool
+
+func (m MockHealth) Healthy() bool {
+	return m["check"]
+}
+
+func Test_healthHandler(t *testing.T) {
+	type args struct {
+		method string
+		target string
+	}
+	type want struct {
+		code int
+		body string
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "Liveness",
+			args: args{
+				method: http.MethodGet,
+				target: livenessPath,
+			},
+			want: want{
+				code: http.StatusOK,
+				body: `{"check":true}` + "\n",
+			},
+		},
+		{
+			name: "Readiness",
+			args: args{
+				method: http.MethodGet,
+				target: readinessPath,
+			},
+			want: want{
+				code: http.StatusServiceUnavailable,
+				body: `{"check":false}` + "\n",
+			},
+		},
+		{
+			name: "MethodNotAllowed",
+			args: args{
+				method: http.MethodPost,
+				target: readinessPath,
+			},
+			want: want{
+				code: http.StatusMethodNotAllowed,
+			},
+		},
+	}
+	defer SetHealth(nil, nil)
+	SetHealth(
+		func() Health { return MockHealth{"check": true} },
+		func() Health { return MockHealth{"check": false} },
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := httptest.NewRecorder()
+			healthHandler(writer, httptest.NewRequest(tt.args.method, tt.args.target, nil))
+			resp := writer.Result()
+			body, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want.code, resp.StatusCode)
+			assert.Equal(t, tt.want.body, string(body))
+		})
+	}
+
+	t.Run("NotSet", func(t *testing.T) {
+		SetHealth(nil, nil)
+		writer := httptest.NewRecorder()
+		healthHandler(writer, httptest.NewRequest(http.MethodGet, readinessPath, nil))
+		body, err := io.ReadAll(writer.Result().Body)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, writer.Result().StatusCode)
+		assert.Equal(t, "ready", string(body))
+	})
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"nginx-reaper/internal/log"
+	"sync"
+	"time"
+)
+
+const reapPath = "/reap"
+
+// Function running the Reaper on POST requests to the reapPath endpoint, nil until set.
+var (
+	reapMutex sync.RWMutex
+	reapFunc  func(body json.RawMessage) (any, error)
+)
+
+// SetReapFunc sets the function running the Reaper with the JSON request body of POST requests to the reapPath
+// endpoint, e.g. the one-off overrides of Reaper.Reap. The returned report is encoded as JSON.
+func SetReapFunc(reap func(body json.RawMessage) (any, error)) {
+	reapMutex.Lock()
+	defer reapMutex.Unlock()
+	reapFunc = reap
+}
+
+// reapHandler responds to requests to the reapPath endpoint with the report of an immediate Reaper run.
+// E.g. "POST /reap" with the body {"max_shutdown_workers": 2}. Requires ScopeWrite.
+func reapHandler(w http.ResponseWriter, r *http.Request) {
+	log.Debugf("Request %v", r)
+	reapMutex.RLock()
+	reap := reapFunc
+	reapMutex.RUnlock()
+
+	switch {
+	case r.URL.Path != reapPath || reap == nil:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case r.Method != http.MethodPost:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	case !authorized(w, r, ScopeWrite):
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+
+	// The run may wait for a scheduled run and escalate the signals for longer than the write timeout, which counts
+	// from the request. The timeout applies to writing the report instead.
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		log.Debugf("Request %v write deadline not extended: %v", r, err)
+	}
+	report, err := reap(body)
+	if err := controller.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		log.Debugf("Request %v write deadline not extended: %v", r, err)
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Errorf("Request %v failed: %v", r, err)
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_reapHandler(t *testing.T) {
+	type args struct {
+		method        string
+		target        string
+		authorization string
+		body          string
+	}
+	type want struct {
+		code int
+		body string
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "NotFound",
+			args: args{
+				method: http.MethodPost,
+				target: reapPath + "/now",
+			},
+			want: want{
+				code: http.StatusNotFound,
+			},
+		},
+		{
+			name: "MethodNotAllowed",
+			args: args{
+				method: http.MethodGet,
+				target: reapPath,
+			},
+			want: want{
+				code: http.StatusMethodNotAllowed,
+			},
+		},
+		{
+			name: "Unauthorized",
+			args: args{
+				method: http.MethodPost,
+				target: reapPath,
+			},
+			want: want{
+				code: http.StatusUnauthorized,
+				body: `{"error":"invalid bearer token"}`,
+			},
+		},
+		{
+			name: "BadRequest",
+			args: args{
+				method:        http.MethodPost,
+				target:        reapPath,
+				authorization: "Bearer secret",
+				body:          `{"dry_run": 1}`,
+			},
+			want: want{
+				code: http.StatusBadRequest,
+				body: `{"error":"invalid overrides"}`,
+			},
+		},
+		{
+			name: "Reap",
+			args: args{
+				method:        http.MethodPost,
+				target:        reapPath,
+				authorization: "Bearer secret",
+				body:          `{"dry_run": true}`,
+			},
+			want: want{
+				code: http.StatusOK,
+				body: `{"dry_run":true}` + "\n",
+			},
+		},
+	}
+	SetToken("secret")
+	SetReapFunc(func(body json.RawMessage) (any, error) {
+		var overrides map[string]bool
+		if err := json.Unmarshal(body, &overrides); err != nil {
+			return nil, errors.New("invalid overrides")
+		}
+		return overrides, nil
+	})
+	defer SetToken("")
+	defer SetReapFunc(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := httptest.NewRecorder()
+			request := httptest.NewRequest(tt.args.method, tt.args.target, strings.NewReader(tt.args.body))
+			request.Header.Set("Authorization", tt.args.authorization)
+			reapHandler(writer, request)
+			resp := writer.Result()
+			body, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want.code, resp.StatusCode)
+			assert.Equal(t, tt.want.body, string(body))
+		})
+	}
+}
+
+func Test_reapHandlerSlowRun(t *testing.T) {
+	SetToken("secret")
+	SetReapFunc(func(json.RawMessage) (any, error) {
+		time.Sleep(300 * time.Millisecond)
+		return map[string]bool{"dry_run": false}, nil
+	})
+	defer SetToken("")
+	defer SetReapFunc(nil)
+
+	// The run takes longer than the write timeout of the server.
+	server := httptest.NewUnstartedServer(http.HandlerFunc(reapHandler))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+reapPath, nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := server.Client().Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `{"dry_run":false}`+"\n", string(body))
+}
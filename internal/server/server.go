@@ -10,12 +10,25 @@ import (
 	"time"
 )
 
+// Maximum duration of writing a response, see reapHandler for the responses of long runs.
+const writeTimeout = 10 * time.Second
+
 // CreateServer creates an HTTP server configured with the specified address, metrics, and default timeouts.
 func CreateServer(addr string, metrics ...prometheus.Collector) *http.Server {
 	// Handler for configuration requests.
 	var mux http.ServeMux
 	mux.HandleFunc(configPath, configHandler)
 
+	// Handler for process tree requests.
+	mux.HandleFunc(workersPath, workersHandler)
+
+	// Handler for immediate Reaper runs.
+	mux.HandleFunc(reapPath, reapHandler)
+
+	// Handlers for liveness and readiness probes.
+	mux.HandleFunc(livenessPath, healthHandler)
+	mux.HandleFunc(readinessPath, healthHandler)
+
 	// Handler for metrics requests.
 	registry := prometheus.NewRegistry()
 	registry.MustRegister(metrics...)
@@ -29,16 +42,28 @@ func CreateServer(addr string, metrics ...prometheus.Collector) *http.Server {
 		Handler:           &mux,
 		ReadTimeout:       10 * time.Second,
 		ReadHeaderTimeout: 10 * time.Second,
-		WriteTimeout:      10 * time.Second,
+		WriteTimeout:      writeTimeout,
 		IdleTimeout:       120 * time.Second,
 	}
 }
 
 // StartServer starts a specified HTTP server to listen and respond to incoming requests.
 func StartServer(server *http.Server) {
-	// ListenAndServe always returns a non-nil error.
+	listen(server, server.ListenAndServe)
+}
+
+// StartServerTLS starts a specified HTTPS server to listen and respond to incoming requests, with the certificate
+// and the private key files. The TLS configuration of the server, if any, is used, e.g. to verify client
+// certificates, see NewTLSConfig.
+func StartServerTLS(server *http.Server, certFile, keyFile string) {
+	listen(server, func() error { return server.ListenAndServeTLS(certFile, keyFile) })
+}
+
+// listen logs the address of the server and calls the serve function, until the server is closed.
+func listen(server *http.Server, serve func() error) {
+	// ListenAndServe and ListenAndServeTLS always return a non-nil error.
 	log.Infof("Server listening on %q", server.Addr)
-	if err := server.ListenAndServe(); err != nil {
+	if err := serve(); err != nil {
 		if errors.Is(err, http.ErrServerClosed) {
 			log.Infof("Server stopped listening on %q, %v", server.Addr, err)
 		} else {
@@ -48,7 +73,7 @@ func StartServer(server *http.Server) {
 }
 
 // defaultHandler responds with "ready" to all incoming requests and logs any errors that occur.
-// E.g. "GET /healthz".
+// E.g. "GET /".
 func defaultHandler(w http.ResponseWriter, r *http.Request) {
 	log.Debugf("Request %v", r)
 	if _, err := w.Write([]byte("ready")); err != nil {
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/tls"
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -25,10 +26,11 @@ func TestCreateServer(t *testing.T) {
 
 func TestStartServer(t *testing.T) {
 	type args struct {
-		server *http.Server
-		url    string
-		method string
-		body   io.Reader
+		server        *http.Server
+		url           string
+		method        string
+		body          io.Reader
+		authorization string
 	}
 	type want struct {
 		code      int
@@ -78,7 +80,7 @@ func TestStartServer(t *testing.T) {
 			args: args{
 				server: CreateServer(":11256"),
 				url:    "http://localhost:11256" + configPath,
-				method: http.MethodGet,
+				method: http.MethodPost,
 			},
 			want: want{
 				code: http.StatusMethodNotAllowed,
@@ -87,9 +89,10 @@ func TestStartServer(t *testing.T) {
 		{
 			name: "ConfigBadRequest",
 			args: args{
-				server: CreateServer(":11256"),
-				url:    "http://localhost:11256" + configPath,
-				method: http.MethodPut,
+				server:        CreateServer(":11256"),
+				url:           "http://localhost:11256" + configPath,
+				method:        http.MethodPut,
+				authorization: "Bearer secret",
 			},
 			want: want{
 				code: http.StatusBadRequest,
@@ -97,16 +100,31 @@ func TestStartServer(t *testing.T) {
 		},
 		{
 			name: "ConfigNoContent",
+			args: args{
+				server:        CreateServer(":11256"),
+				url:           "http://localhost:11256" + configPath + "?" + keyLogLevel + "=debug",
+				method:        http.MethodPut,
+				authorization: "Bearer secret",
+			},
+			want: want{
+				code: http.StatusNoContent,
+			},
+		},
+		{
+			name: "ConfigUnauthorized",
 			args: args{
 				server: CreateServer(":11256"),
 				url:    "http://localhost:11256" + configPath + "?" + keyLogLevel + "=debug",
 				method: http.MethodPut,
 			},
 			want: want{
-				code: http.StatusNoContent,
+				code: http.StatusUnauthorized,
+				body: `{"error":"invalid bearer token"}`,
 			},
 		},
 	}
+	SetToken("secret")
+	defer SetToken("")
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.want.wantPanic {
@@ -121,6 +139,7 @@ func TestStartServer(t *testing.T) {
 			// Send a request to the HTTP server.
 			req, err := http.NewRequest(tt.args.method, tt.args.url, tt.args.body)
 			assert.NoError(t, err)
+			req.Header.Set("Authorization", tt.args.authorization)
 
 			resp, err := http.DefaultClient.Do(req)
 			assert.NoError(t, err)
@@ -133,6 +152,52 @@ func TestStartServer(t *testing.T) {
 	}
 }
 
+func TestStartServerTLS(t *testing.T) {
+	certFile, keyFile := writeCertificate(t)
+	config, err := NewTLSConfig(certFile)
+	assert.NoError(t, err)
+
+	// The server certificate is its own client CA certificate.
+	server := CreateServer(":11257")
+	server.TLSConfig = config
+	go StartServerTLS(server, certFile, keyFile)
+	defer func() { _ = server.Close() }()
+	time.Sleep(100 * time.Millisecond)
+
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.NoError(t, err)
+	tests := []struct {
+		name         string
+		certificates []tls.Certificate
+		clientScopes map[string]Scope
+		want         int
+	}{
+		{name: "Anonymous", want: http.StatusForbidden},
+		{name: "Client", certificates: []tls.Certificate{certificate}, want: http.StatusNoContent},
+		{
+			name:         "ReadOnlyClient",
+			certificates: []tls.Certificate{certificate},
+			clientScopes: map[string]Scope{"nginx-reaper": ScopeRead},
+			want:         http.StatusForbidden,
+		},
+	}
+	defer SetClientScopes(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetClientScopes(tt.clientScopes)
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				RootCAs:      config.ClientCAs,
+				Certificates: tt.certificates,
+			}}}
+			req, err := http.NewRequest(http.MethodPut, "https://localhost:11257"+configPath+"?"+keyLogLevel+"=info", nil)
+			assert.NoError(t, err)
+			resp, err := client.Do(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, resp.StatusCode)
+		})
+	}
+}
+
 type ErrorWriter struct {
 	mock.Mock
 }
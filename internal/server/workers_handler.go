@@ -0,0 +1,76 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"nginx-reaper/internal/log"
+	"sync"
+)
+
+const (
+	workersPath = "/workers"
+	keyFormat   = "format"
+	formatJSON  = "json"
+	formatText  = "text"
+)
+
+// Tree is a process tree reported by GET requests to the workersPath endpoint, encoded as JSON or written as text.
+type Tree interface {
+	WriteText(w io.Writer) error // WriteText writes the Tree as plain text.
+}
+
+// Function returning the process tree reported by the workersPath endpoint, nil until set.
+var (
+	workersMutex sync.RWMutex
+	workersTree  func() (Tree, error)
+)
+
+// SetWorkersTree sets the function returning the process tree reported by GET requests to the workersPath endpoint,
+// e.g. the masters and workers managed by the Reaper.
+func SetWorkersTree(tree func() (Tree, error)) {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+	workersTree = tree
+}
+
+// workersHandler responds to requests to the workersPath endpoint with the process tree.
+// E.g. "GET /workers" responds with JSON and "GET /workers?format=text" with plain text. Requires ScopeRead.
+func workersHandler(w http.ResponseWriter, r *http.Request) {
+	log.Debugf("Request %v", r)
+	workersMutex.RLock()
+	treeFunc := workersTree
+	workersMutex.RUnlock()
+
+	format := r.URL.Query().Get(keyFormat)
+	switch {
+	case r.URL.Path != workersPath || treeFunc == nil:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case r.Method != http.MethodGet:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	case !authorized(w, r, ScopeRead):
+		return
+	case format != "" && format != formatJSON && format != formatText:
+		writeError(w, r, http.StatusBadRequest, errors.New("invalid format: "+format))
+		return
+	}
+
+	tree, err := treeFunc()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if format == formatText {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		err = tree.WriteText(w)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(tree)
+	}
+	if err != nil {
+		log.Errorf("Request %v failed: %v", r, err)
+	}
+}
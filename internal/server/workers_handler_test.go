@@ -0,0 +1,121 @@
+package server
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// MockTree is a process tree of a single process.
+type MockTree []int
+
+func (m MockTree) WriteText(w io.Writer) error {
+	_, err := io.WriteString(w, "PID\n1\n")
+	return err
+}
+
+func Test_workersHandler(t *testing.T) {
+	type args struct {
+		method string
+		target string
+		err    error
+	}
+	type want struct {
+		code int
+		body string
+	}
+	tests := []struct {
+		name string
+		args args
+		want want
+	}{
+		{
+			name: "NotFound",
+			args: args{
+				method: http.MethodGet,
+				target: workersPath + "/1",
+			},
+			want: want{
+				code: http.StatusNotFound,
+			},
+		},
+		{
+			name: "MethodNotAllowed",
+			args: args{
+				method: http.MethodPost,
+				target: workersPath,
+			},
+			want: want{
+				code: http.StatusMethodNotAllowed,
+			},
+		},
+		{
+			name: "BadRequest",
+			args: args{
+				method: http.MethodGet,
+				target: workersPath + "?" + keyFormat + "=xml",
+			},
+			want: want{
+				code: http.StatusBadRequest,
+				body: `{"error":"invalid format: xml"}`,
+			},
+		},
+		{
+			name: "Error",
+			args: args{
+				method: http.MethodGet,
+				target: workersPath,
+				err:    errors.New("no processes"),
+			},
+			want: want{
+				code: http.StatusInternalServerError,
+				body: `{"error":"no processes"}`,
+			},
+		},
+		{
+			name: "JSON",
+			args: args{
+				method: http.MethodGet,
+				target: workersPath,
+			},
+			want: want{
+				code: http.StatusOK,
+				body: "[1]\n",
+			},
+		},
+		{
+			name: "Text",
+			args: args{
+				method: http.MethodGet,
+				target: workersPath + "?" + keyFormat + "=" + formatText,
+			},
+			want: want{
+				code: http.StatusOK,
+				body: "PID\n1\n",
+			},
+		},
+	}
+	defer SetWorkersTree(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetWorkersTree(func() (Tree, error) { return MockTree{1}, tt.args.err })
+			writer := httptest.NewRecorder()
+			workersHandler(writer, httptest.NewRequest(tt.args.method, tt.args.target, nil))
+			resp := writer.Result()
+			body, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want.code, resp.StatusCode)
+			assert.Equal(t, tt.want.body, string(body))
+		})
+	}
+
+	t.Run("NotSet", func(t *testing.T) {
+		SetWorkersTree(nil)
+		writer := httptest.NewRecorder()
+		workersHandler(writer, httptest.NewRequest(http.MethodGet, workersPath, nil))
+		assert.Equal(t, http.StatusNotFound, writer.Result().StatusCode)
+	})
+}
@@ -15,7 +15,8 @@ type Job interface {
 
 // Start starts a ticker that executes the provided Job at a regular interval.
 func Start(job Job) {
-	ticker := time.NewTicker(job.Interval())
+	interval := job.Interval()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	log.Infof("Scheduled %v", job)
@@ -24,5 +25,11 @@ func Start(job Job) {
 		if !job.Run() {
 			break
 		}
+		// The interval of the Job may change at runtime, e.g. through the config endpoint.
+		if next := job.Interval(); next != interval {
+			log.Infof("Rescheduled %v", job)
+			interval = next
+			ticker.Reset(interval)
+		}
 	}
 }
@@ -8,16 +8,20 @@ import (
 
 type MockJob struct {
 	mock.Mock
+	intervals int
+	runs      int
 }
 
 func (m *MockJob) Interval() time.Duration {
 	args := m.Called()
-	return time.Duration(args.Int(0))
+	m.intervals++
+	return time.Duration(args.Int(min(m.intervals, len(args)) - 1))
 }
 
 func (m *MockJob) Run() bool {
 	args := m.Called()
-	return args.Bool(len(m.Calls) - 2)
+	m.runs++
+	return args.Bool(m.runs - 1)
 }
 
 func TestStart(t *testing.T) {
@@ -29,6 +33,10 @@ func TestStart(t *testing.T) {
 	runTwice.On("Interval").Return(1)
 	runTwice.On("Run").Return(true, false)
 
+	rescheduled := &MockJob{}
+	rescheduled.On("Interval").Return(1, 2)
+	rescheduled.On("Run").Return(true, true, false)
+
 	type want struct {
 		method string
 		calls  int
@@ -58,7 +66,7 @@ func TestStart(t *testing.T) {
 			want: []want{
 				{
 					method: "Interval",
-					calls:  1,
+					calls:  2,
 				},
 				{
 					method: "Run",
@@ -66,6 +74,20 @@ func TestStart(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Rescheduled",
+			job:  rescheduled,
+			want: []want{
+				{
+					method: "Interval",
+					calls:  3,
+				},
+				{
+					method: "Run",
+					calls:  3,
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {